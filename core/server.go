@@ -3,6 +3,7 @@ package core
 import (
 	"chatgpt-go/global"
 	"chatgpt-go/initialize"
+	"chatgpt-go/service"
 	"context"
 	"errors"
 	"fmt"
@@ -20,6 +21,10 @@ import (
 
 func RunServer() {
 
+	if err := service.InitClient(); err != nil {
+		log.Fatalf("InitClient error: %v", err)
+	}
+
 	router := initialize.Routers()
 
 	address := global.Config.System.Address
@@ -32,7 +37,7 @@ func RunServer() {
 		}
 	}()
 	pingServer("http://127.0.0.1" + address)
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	<-quit
 	log.Println("Server is shutting down...")
@@ -48,12 +53,16 @@ func RunServer() {
 
 }
 
+// initServer 创建 http server。
+// WriteTimeout 只约束普通接口，流式接口会在每次写入前自行延长写超时；
+// 不设置 ReadTimeout，它会在读超时后取消正在进行的流式请求。
 func initServer(address string, router *gin.Engine) *http.Server {
 	return &http.Server{
 		Addr:              address,
 		Handler:           router,
 		ReadHeaderTimeout: 20 * time.Second,
 		WriteTimeout:      20 * time.Second,
+		IdleTimeout:       120 * time.Second,
 		MaxHeaderBytes:    1 << 20,
 	}
 }
@@ -2,6 +2,7 @@ package core
 
 import (
 	"chatgpt-go/global"
+	"chatgpt-go/service"
 	"fmt"
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
@@ -22,6 +23,10 @@ func Viper() *viper.Viper {
 		fmt.Println("config file changed:", e.Name)
 		if err = v.Unmarshal(&global.Config); err != nil {
 			fmt.Println(err)
+			return
+		}
+		if err = service.ReloadClient(); err != nil {
+			fmt.Println("reload upstream client error:", err)
 		}
 	})
 	if err = v.Unmarshal(&global.Config); err != nil {
@@ -1,5 +1,7 @@
 package global
 
+import "time"
+
 var (
 	OpenAIKey string
 	Config    SystemConfig
@@ -15,7 +17,29 @@ type SystemConfig struct {
 		ReverseProxy   string
 		SocksHost      string
 		SocksPort      string
+		SocksUsername  string
+		SocksPassword  string
+		NoProxy        string
 		OpenAPIBaseURL string
 		DatabasePath   string
+		// 模型信息覆盖文件（YAML），为空时只使用内置的模型信息
+		ModelsFile string
+		// 流式响应的超时，格式如 60s、10m，未配置时使用默认值
+		StreamIdleTimeout  time.Duration
+		StreamTotalTimeout time.Duration
+		// 知识库使用的向量模型，为空时使用 text-embedding-3-small
+		EmbeddingModel string
+		// 知识库文档切分的片段长度和相邻片段的重叠长度（字符数），以及每次对话检索的片段数，为 0 时使用默认值
+		KnowledgeChunkSize    int
+		KnowledgeChunkOverlap int
+		KnowledgeTopK         int
+		// 语义缓存：问题与之前的问题足够相似（余弦相似度不低于阈值）且模型和上下文相同时，直接返回之前的回答
+		SemanticCache           bool
+		SemanticCacheThreshold  float64
+		SemanticCacheTTL        time.Duration
+		SemanticCacheMaxEntries int
+		// 生成的图片保存的目录，为空时使用工作目录下的 images；图片的默认尺寸，为空时使用接口的默认值
+		ImageDir  string
+		ImageSize string
 	}
 }
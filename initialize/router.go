@@ -17,6 +17,10 @@ func Routers() *gin.Engine {
 		panic(err)
 	}
 	//defer chatData.Close()
+	knowledge, err := routes.NewKnowledgeStorage(chatData)
+	if err != nil {
+		panic(err)
+	}
 
 	r := gin.Default()
 	r.Use(middleware.SetAuthorizationHeader())
@@ -26,13 +30,19 @@ func Routers() *gin.Engine {
 	corsConfig.AllowAllOrigins = true
 	corsConfig.AllowHeaders = append(corsConfig.AllowHeaders, "Authorization") // 确保允许"Authorization"请求头
 	r.Use(cors.New(corsConfig))
+	r.Use(routes.ServeImages())
 
 	api := r.Group("api")
 	{
-		api.POST("/chat-process", routes.ChatProcessV2(chatData))
+		api.POST("/chat-process", routes.ChatProcessV2(chatData, knowledge))
 		api.POST("/config", routes.GetConfig)
 		api.POST("/session", routes.SessionEndpoint)
 		api.POST("/verify", routes.VerifyEndpoint)
+		api.POST("/knowledge", routes.CreateKnowledgeBase(knowledge))
+		api.POST("/knowledge/list", routes.ListKnowledgeBases(knowledge))
+		api.POST("/knowledge/:id/upload", routes.UploadKnowledge(knowledge))
+		api.POST("/cache/stats", routes.CacheStats)
+		api.POST("/image", routes.CreateImage(chatData))
 	}
 
 	r.StaticFS("/", http.FS(html.Static))
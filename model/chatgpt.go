@@ -9,6 +9,10 @@ type ChatRequest struct {
 }
 type ChatRequestOptions struct {
 	ParentMessageId string `json:"parentMessageId"`
+	// 知识库名称，不为空时把知识库中与问题最相关的片段加入上下文
+	KnowledgeBase string `json:"knowledgeBase,omitempty"`
+	// 为 true 时不使用语义缓存，总是请求上游
+	NoCache bool `json:"noCache,omitempty"`
 }
 
 type VerifyRequest struct {
@@ -25,6 +29,10 @@ type ChatResponse struct {
 	Delta           string                             `json:"delta"`
 	Text            string                             `json:"text"`
 	Detail          lemur.ChatCompletionStreamResponse `json:"detail"`
+	// 回答引用的知识库片段，只在最后一帧返回
+	Sources []KnowledgeSource `json:"sources,omitempty"`
+	// 回答来自语义缓存
+	Cached bool `json:"cached,omitempty"`
 }
 type ChatResponseLemur struct {
 	Role            string                                  `json:"role"`
@@ -33,6 +41,10 @@ type ChatResponseLemur struct {
 	Delta           string                                  `json:"delta"`
 	Text            string                                  `json:"text"`
 	Detail          lemur.ChatCompletionStreamResponseLemur `json:"detail"`
+	// 回答引用的知识库片段，只在最后一帧返回
+	Sources []KnowledgeSource `json:"sources,omitempty"`
+	// 回答来自语义缓存
+	Cached bool `json:"cached,omitempty"`
 }
 
 // api/config接口 返回的结果
@@ -49,3 +61,45 @@ type ChatConfigData struct {
 	HttpsProxy   string `json:"httpsProxy"`
 	Balance      string `json:"balance"`
 }
+
+// 知识库
+type KnowledgeBase struct {
+	Id          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Chunks      int    `json:"chunks"`
+	CreatedAt   int64  `json:"createdAt"`
+	// 知识库向量的维度，由第一次上传的文档决定，为 0 时还没有文档
+	EmbeddingDim int `json:"embeddingDim"`
+}
+
+// 创建知识库的请求
+type KnowledgeBaseRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// 回答引用的知识库片段，Index 是片段在上下文中的编号
+type KnowledgeSource struct {
+	Index   int     `json:"index"`
+	Source  string  `json:"source"`
+	Chunk   int     `json:"chunk"`
+	Score   float32 `json:"score"`
+	Content string  `json:"content"`
+}
+
+// 生成图片的请求，Options.ParentMessageId 是图片在对话中的上一条消息
+type ImageRequest struct {
+	Prompt  string             `json:"prompt"`
+	N       int                `json:"n,omitempty"`
+	Size    string             `json:"size,omitempty"`
+	Options ChatRequestOptions `json:"options,omitempty"`
+}
+
+// 生成图片的结果。图片作为助手的回答记录在对话中，Id 是这条回答的消息 id，Text 是回答的 markdown
+type ImageResponse struct {
+	Id              string   `json:"id"`
+	ParentMessageId string   `json:"parentMessageId"`
+	Text            string   `json:"text"`
+	Images          []string `json:"images"`
+}
@@ -5,7 +5,7 @@ import (
 	"testing"
 )
 
-func TestlemurFullURL(t *testing.T) {
+func TestLemurFullURL(t *testing.T) {
 	cases := []struct {
 		Name   string
 		Suffix string
@@ -14,12 +14,12 @@ func TestlemurFullURL(t *testing.T) {
 		{
 			"ChatCompletionsURL",
 			"/chat/completions",
-			"https://api.lemur.com/v1/chat/completions",
+			"http://lemurchat.anfans.cn/api/chat/completions",
 		},
 		{
 			"CompletionsURL",
 			"/completions",
-			"https://api.lemur.com/v1/completions",
+			"http://lemurchat.anfans.cn/api/completions",
 		},
 	}
 
@@ -63,6 +63,8 @@ type AudioResponse struct {
 		Transient        bool    `json:"transient"`
 	} `json:"segments"`
 	Text string `json:"text"`
+
+	ResponseMetadata
 }
 
 // CreateTranscription — API call to create a transcription. Returns transcribed text.
@@ -104,7 +106,7 @@ func (c *Client) callAudioAPI(
 	if request.HasJSONResponse() {
 		err = c.sendRequest(req, &response)
 	} else {
-		err = c.sendRequest(req, &response.Text)
+		err = c.sendRequestWithMetadata(req, &response.Text, &response.ResponseMetadata)
 	}
 	if err != nil {
 		return AudioResponse{}, err
@@ -1,8 +1,11 @@
 package lemur
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
 )
 
@@ -12,6 +15,7 @@ const (
 	ChatMessageRoleUser      = "user"
 	ChatMessageRoleAssistant = "assistant"
 	ChatMessageRoleFunction  = "function"
+	ChatMessageRoleTool      = "tool"
 )
 
 const chatCompletionsSuffix = "/chat/completions"
@@ -19,11 +23,43 @@ const chatCompletionsSuffix = "/chat/completions"
 var (
 	ErrChatCompletionInvalidModel       = errors.New("this model is not supported with this method, please use CreateCompletion client method instead") //nolint:lll
 	ErrChatCompletionStreamNotSupported = errors.New("streaming is not supported with this method, please use CreateChatCompletionStream")              //nolint:lll
+	ErrContentFieldsMisused             = errors.New("can't use both Content and MultiContent properties simultaneously")
 )
 
+type ImageURLDetail string
+
+const (
+	ImageURLDetailHigh ImageURLDetail = "high"
+	ImageURLDetailLow  ImageURLDetail = "low"
+	ImageURLDetailAuto ImageURLDetail = "auto"
+)
+
+type ChatMessageImageURL struct {
+	// URL is either the URL of the image or a data URL holding it, see NewImagePart.
+	URL    string         `json:"url,omitempty"`
+	Detail ImageURLDetail `json:"detail,omitempty"`
+}
+
+type ChatMessagePartType string
+
+const (
+	ChatMessagePartTypeText     ChatMessagePartType = "text"
+	ChatMessagePartTypeImageURL ChatMessagePartType = "image_url"
+)
+
+// ChatMessagePart is a part of the content of a message, either text or an image.
+type ChatMessagePart struct {
+	Type     ChatMessagePartType  `json:"type,omitempty"`
+	Text     string               `json:"text,omitempty"`
+	ImageURL *ChatMessageImageURL `json:"image_url,omitempty"`
+}
+
 type ChatCompletionMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// MultiContent holds content made of several parts, for example text and images for vision models.
+	// It is sent in place of Content, so only one of them may be set.
+	MultiContent []ChatMessagePart `json:"-"`
 
 	// This property isn't in the official documentation, but it's in
 	// the documentation for the official library for python:
@@ -31,8 +67,51 @@ type ChatCompletionMessage struct {
 	// - https://github.com/lemur/lemur-cookbook/blob/main/examples/How_to_count_tokens_with_tiktoken.ipynb
 	Name string `json:"name,omitempty"`
 
+	// Deprecated: use ToolCalls instead.
 	FunctionCall *FunctionCall `json:"function_call,omitempty"`
+
+	// For Role=assistant messages this may be set to the tool calls generated by the model.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// For Role=tool messages this should be set to the ID of the tool call being answered.
+	ToolCallID string `json:"tool_call_id,omitempty"`
 }
+
+func (m ChatCompletionMessage) MarshalJSON() ([]byte, error) {
+	if m.Content != "" && m.MultiContent != nil {
+		return nil, ErrContentFieldsMisused
+	}
+	type message ChatCompletionMessage
+	if len(m.MultiContent) > 0 {
+		return json.Marshal(struct {
+			message
+			Content []ChatMessagePart `json:"content"`
+		}{message(m), m.MultiContent})
+	}
+	return json.Marshal(message(m))
+}
+
+func (m *ChatCompletionMessage) UnmarshalJSON(data []byte) error {
+	type message ChatCompletionMessage
+	var raw struct {
+		message
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = ChatCompletionMessage(raw.message)
+
+	content := bytes.TrimSpace(raw.Content)
+	switch {
+	case len(content) == 0 || bytes.Equal(content, []byte("null")):
+		return nil
+	case content[0] == '[':
+		return json.Unmarshal(content, &m.MultiContent)
+	default:
+		return json.Unmarshal(content, &m.Content)
+	}
+}
+
 type ChatCompletionMessageLemur struct {
 	Role         string        `json:"role"`
 	Content      string        `json:"content"`
@@ -48,6 +127,42 @@ type FunctionCall struct {
 	Arguments string `json:"arguments,omitempty"`
 }
 
+type ToolType string
+
+const (
+	ToolTypeFunction ToolType = "function"
+)
+
+// ToolCall is a call of a tool generated by the model.
+type ToolCall struct {
+	// Index is only set in the chunks of a stream, where it identifies the tool call
+	// each fragment belongs to when several calls are made in parallel.
+	Index    *int         `json:"index,omitempty"`
+	ID       string       `json:"id,omitempty"`
+	Type     ToolType     `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+// Tool is a tool the model may call.
+type Tool struct {
+	Type     ToolType            `json:"type"`
+	Function *FunctionDefinition `json:"function,omitempty"`
+}
+
+// ToolChoice forces the model to call a specific tool.
+type ToolChoice struct {
+	Type     ToolType      `json:"type"`
+	Function *ToolFunction `json:"function,omitempty"`
+}
+
+type ToolFunction struct {
+	Name string `json:"name"`
+}
+
+// ZeroTemperature samples with a temperature of zero. A Temperature of 0 is omitted from the
+// request, and the API then uses its default temperature of 1.
+const ZeroTemperature float32 = math.SmallestNonzeroFloat32
+
 // ChatCompletionRequest represents a request structure for chat completion API.
 type ChatCompletionRequest struct {
 	Model            string                  `json:"model"`
@@ -63,10 +178,46 @@ type ChatCompletionRequest struct {
 	// LogitBias is must be a token id string (specified by their token ID in the tokenizer), not a word string.
 	// incorrect: `"logit_bias":{"You": 6}`, correct: `"logit_bias":{"1639": 6}`
 	// refs: https://platform.lemur.com/docs/api-reference/chat/create#chat/create-logit_bias
-	LogitBias    map[string]int       `json:"logit_bias,omitempty"`
-	User         string               `json:"user,omitempty"`
-	Functions    []FunctionDefinition `json:"functions,omitempty"`
-	FunctionCall any                  `json:"function_call,omitempty"`
+	LogitBias map[string]int `json:"logit_bias,omitempty"`
+	User      string         `json:"user,omitempty"`
+	// Deprecated: use Tools instead.
+	Functions []FunctionDefinition `json:"functions,omitempty"`
+	// Deprecated: use ToolChoice instead.
+	FunctionCall any    `json:"function_call,omitempty"`
+	Tools        []Tool `json:"tools,omitempty"`
+	// ToolChoice can be either a string ("none", "auto") or a ToolChoice.
+	ToolChoice any `json:"tool_choice,omitempty"`
+	// ParallelToolCalls enables or disables calling several tools in one response.
+	// Nil leaves the default of the API, which is enabled.
+	ParallelToolCalls *bool `json:"parallel_tool_calls,omitempty"`
+	// ResponseFormat makes the model answer with JSON, see CreateStructuredChatCompletion.
+	ResponseFormat *ChatCompletionResponseFormat `json:"response_format,omitempty"`
+	// Seed makes sampling deterministic on a best effort basis: repeated requests with the
+	// same seed and parameters should return the same result while SystemFingerprint is unchanged.
+	Seed *int `json:"seed,omitempty"`
+}
+
+type ChatCompletionResponseFormatType string
+
+const (
+	ChatCompletionResponseFormatTypeText       ChatCompletionResponseFormatType = "text"
+	ChatCompletionResponseFormatTypeJSONObject ChatCompletionResponseFormatType = "json_object"
+	ChatCompletionResponseFormatTypeJSONSchema ChatCompletionResponseFormatType = "json_schema"
+)
+
+type ChatCompletionResponseFormat struct {
+	Type ChatCompletionResponseFormatType `json:"type,omitempty"`
+	// JSONSchema is required with ChatCompletionResponseFormatTypeJSONSchema.
+	JSONSchema *ChatCompletionResponseFormatJSONSchema `json:"json_schema,omitempty"`
+}
+
+type ChatCompletionResponseFormatJSONSchema struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Schema is usually a jsonschema.Definition.
+	Schema json.Marshaler `json:"schema"`
+	// Strict makes the model follow the schema exactly, which only supports a subset of JSON Schema.
+	Strict bool `json:"strict"`
 }
 type ChatCompletionRequestLemur struct {
 	Messages string `json:"messages"`
@@ -92,6 +243,7 @@ const (
 	FinishReasonStop          FinishReason = "stop"
 	FinishReasonLength        FinishReason = "length"
 	FinishReasonFunctionCall  FinishReason = "function_call"
+	FinishReasonToolCalls     FinishReason = "tool_calls"
 	FinishReasonContentFilter FinishReason = "content_filter"
 	FinishReasonNull          FinishReason = "null"
 )
@@ -104,6 +256,7 @@ type ChatCompletionChoice struct {
 	// or a message terminated by one of the stop sequences provided via the stop parameter
 	// length: Incomplete model output due to max_tokens parameter or token limit
 	// function_call: The model decided to call a function
+	// tool_calls: The model decided to call one or more tools
 	// content_filter: Omitted content due to a flag from our content filters
 	// null: API response still in progress or incomplete
 	FinishReason FinishReason `json:"finish_reason"`
@@ -117,6 +270,10 @@ type ChatCompletionResponse struct {
 	Model   string                 `json:"model"`
 	Choices []ChatCompletionChoice `json:"choices"`
 	Usage   Usage                  `json:"usage"`
+	// SystemFingerprint identifies the backend configuration that served the request, see Seed.
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+
+	ResponseMetadata
 }
 
 // CreateChatCompletion — API call to Create a completion for the chat message.
@@ -130,15 +287,19 @@ func (c *Client) CreateChatCompletion(
 	}
 
 	urlSuffix := chatCompletionsSuffix
-	if !checkEndpointSupportsModel(urlSuffix, request.Model) {
+	if !c.checkEndpointSupportsModel(urlSuffix, request.Model) {
 		err = ErrChatCompletionInvalidModel
 		return
 	}
+	if err = c.validateChatCompletionRequest(request); err != nil {
+		return
+	}
 
 	req, err := c.newRequest(ctx, http.MethodPost, c.fullURL(urlSuffix, request.Model), withBody(request))
 	if err != nil {
 		return
 	}
+	req = c.withResponseCache(req, request)
 
 	err = c.sendRequest(req, &response)
 	return
@@ -0,0 +1,80 @@
+package lemur
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrNotAnImage = errors.New("content is not an image")
+
+// NewTextPart returns a text part of a message content.
+func NewTextPart(text string) ChatMessagePart {
+	return ChatMessagePart{Type: ChatMessagePartTypeText, Text: text}
+}
+
+// NewImageURLPart returns an image part pointing to url.
+func NewImageURLPart(url string, detail ImageURLDetail) ChatMessagePart {
+	return ChatMessagePart{
+		Type:     ChatMessagePartTypeImageURL,
+		ImageURL: &ChatMessageImageURL{URL: url, Detail: detail},
+	}
+}
+
+// NewImagePart reads an image from r and returns an image part holding it as a data URL,
+// so that it is sent within the request. The type of the image is detected from its content
+// when mimeType is empty.
+func NewImagePart(r io.Reader, mimeType string, detail ImageURLDetail) (ChatMessagePart, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return ChatMessagePart{}, err
+	}
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	if !strings.HasPrefix(mimeType, "image/") {
+		return ChatMessagePart{}, fmt.Errorf("%w: %s", ErrNotAnImage, mimeType)
+	}
+	url := "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	return NewImageURLPart(url, detail), nil
+}
+
+// NewImageFilePart returns an image part holding the image file at path, see NewImagePart.
+// The type of the image is guessed from the extension of the file, then from its content.
+func NewImageFilePart(path string, detail ImageURLDetail) (ChatMessagePart, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ChatMessagePart{}, err
+	}
+	defer file.Close()
+	mimeType, _, _ := strings.Cut(mime.TypeByExtension(filepath.Ext(path)), ";")
+	return NewImagePart(file, mimeType, detail)
+}
+
+// text returns the text of the message, joining the text parts of a multi-part content.
+func (m ChatCompletionMessage) text() string {
+	if len(m.MultiContent) == 0 {
+		return m.Content
+	}
+	var text strings.Builder
+	for _, part := range m.MultiContent {
+		text.WriteString(part.Text)
+	}
+	return text.String()
+}
+
+// hasImages reports whether the content of the message contains an image.
+func (m ChatCompletionMessage) hasImages() bool {
+	for _, part := range m.MultiContent {
+		if part.Type == ChatMessagePartTypeImageURL {
+			return true
+		}
+	}
+	return false
+}
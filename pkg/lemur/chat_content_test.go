@@ -0,0 +1,170 @@
+package lemur_test
+
+import (
+	. "chatgpt-go/pkg/lemur"
+	"chatgpt-go/pkg/lemur/internal/test/checks"
+
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pngHeader is enough of a PNG file for its type to be detected.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestChatCompletionMessageMarshalJSON(t *testing.T) {
+	data, err := json.Marshal(ChatCompletionMessage{Role: ChatMessageRoleUser, Content: "Hello"})
+	checks.NoError(t, err, "Marshal error")
+	if string(data) != `{"role":"user","content":"Hello"}` {
+		t.Errorf("Unexpected string content %s", data)
+	}
+
+	data, err = json.Marshal(ChatCompletionMessage{
+		Role: ChatMessageRoleUser,
+		MultiContent: []ChatMessagePart{
+			NewTextPart("What's in this image?"),
+			NewImageURLPart("https://example.com/cat.png", ImageURLDetailLow),
+		},
+	})
+	checks.NoError(t, err, "Marshal error")
+	//nolint:lll
+	expected := `{"role":"user","content":[{"type":"text","text":"What's in this image?"},{"type":"image_url","image_url":{"url":"https://example.com/cat.png","detail":"low"}}]}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	_, err = json.Marshal(ChatCompletionMessage{
+		Role:         ChatMessageRoleUser,
+		Content:      "Hello",
+		MultiContent: []ChatMessagePart{NewTextPart("Hello")},
+	})
+	checks.ErrorIs(t, err, ErrContentFieldsMisused, "Marshal should refuse both contents")
+}
+
+func TestChatCompletionMessageUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected ChatCompletionMessage
+	}{
+		{
+			`{"role":"assistant","content":"Hi"}`,
+			ChatCompletionMessage{Role: ChatMessageRoleAssistant, Content: "Hi"},
+		},
+		{
+			`{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"f"}}]}`,
+			ChatCompletionMessage{
+				Role:      ChatMessageRoleAssistant,
+				ToolCalls: []ToolCall{{ID: "call_1", Type: ToolTypeFunction, Function: FunctionCall{Name: "f"}}},
+			},
+		},
+		{
+			`{"role":"user","name":"bob","content":[{"type":"text","text":"Look"},{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}`,
+			ChatCompletionMessage{
+				Role: ChatMessageRoleUser,
+				Name: "bob",
+				MultiContent: []ChatMessagePart{
+					NewTextPart("Look"),
+					NewImageURLPart("https://example.com/a.png", ""),
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		var message ChatCompletionMessage
+		checks.NoError(t, json.Unmarshal([]byte(tt.data), &message), "Unmarshal error")
+		if !reflect.DeepEqual(message, tt.expected) {
+			t.Errorf("Unmarshal(%s) = %+v, want %+v", tt.data, message, tt.expected)
+		}
+	}
+}
+
+func TestNewImagePart(t *testing.T) {
+	part, err := NewImagePart(bytes.NewReader(pngHeader), "", ImageURLDetailHigh)
+	checks.NoError(t, err, "NewImagePart error")
+	if part.Type != ChatMessagePartTypeImageURL || part.ImageURL.Detail != ImageURLDetailHigh ||
+		part.ImageURL.URL != "data:image/png;base64,iVBORw0KGgoAAAANSUhEUg==" {
+		t.Errorf("Unexpected image part %+v", part.ImageURL)
+	}
+
+	part, err = NewImagePart(strings.NewReader("GIF89a"), "image/webp", ImageURLDetailAuto)
+	checks.NoError(t, err, "NewImagePart error")
+	if !strings.HasPrefix(part.ImageURL.URL, "data:image/webp;base64,") {
+		t.Errorf("The given type should be used, got %s", part.ImageURL.URL)
+	}
+
+	_, err = NewImagePart(strings.NewReader("plain text"), "", ImageURLDetailAuto)
+	checks.ErrorIs(t, err, ErrNotAnImage, "NewImagePart should refuse text")
+
+	path := filepath.Join(t.TempDir(), "image.jpg")
+	checks.NoError(t, os.WriteFile(path, pngHeader, 0o600), "WriteFile error")
+	part, err = NewImageFilePart(path, ImageURLDetailLow)
+	checks.NoError(t, err, "NewImageFilePart error")
+	if !strings.HasPrefix(part.ImageURL.URL, "data:image/jpeg;base64,") {
+		t.Errorf("The type should come from the extension, got %s", part.ImageURL.URL)
+	}
+}
+
+func TestChatCompletionWithImages(t *testing.T) {
+	client, server, teardown := setuplemurTestServer()
+	defer teardown()
+	server.RegisterHandler("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		var request ChatCompletionRequest
+		checks.NoError(t, json.NewDecoder(r.Body).Decode(&request), "Decode request error")
+		parts := request.Messages[1].MultiContent
+		if request.Messages[0].Content != "Describe images." || len(parts) != 2 ||
+			parts[1].ImageURL == nil || !strings.HasPrefix(parts[1].ImageURL.URL, "data:image/png;base64,") {
+			t.Errorf("Unexpected messages %+v", request.Messages)
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"A PNG."}}]}`))
+	})
+
+	image, err := NewImagePart(bytes.NewReader(pngHeader), "", ImageURLDetailLow)
+	checks.NoError(t, err, "NewImagePart error")
+	response, err := client.CreateChatCompletion(context.Background(), ChatCompletionRequest{
+		Model: GPT4VisionPreview,
+		Messages: []ChatCompletionMessage{
+			{Role: ChatMessageRoleSystem, Content: "Describe images."},
+			{Role: ChatMessageRoleUser, MultiContent: []ChatMessagePart{NewTextPart("What is it?"), image}},
+		},
+	})
+	checks.NoError(t, err, "CreateChatCompletion error")
+	if response.Choices[0].Message.Content != "A PNG." {
+		t.Errorf("Unexpected response %+v", response)
+	}
+}
+
+func TestValidateChatCompletionRequestImages(t *testing.T) {
+	client := newValidatingClient()
+	err := client.ValidateChatCompletionRequest(ChatCompletionRequest{
+		Model: GPT3Dot5Turbo,
+		Messages: []ChatCompletionMessage{{
+			Role:    ChatMessageRoleUser,
+			Content: "Hello",
+			MultiContent: []ChatMessagePart{
+				NewImageURLPart("", ImageURLDetailAuto),
+				{Type: "audio"},
+			},
+		}},
+	})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	expected := []string{
+		"messages[0]: Content and MultiContent can't both be set",
+		"messages[0]: content[0] has no image url",
+		`messages[0]: content[1] has unknown type "audio"`,
+		"model gpt-3.5-turbo does not support images",
+	}
+	if !reflect.DeepEqual(validationErr.Problems, expected) {
+		t.Errorf("Unexpected problems:\n%s\nexpected:\n%s",
+			strings.Join(validationErr.Problems, "\n"), strings.Join(expected, "\n"))
+	}
+}
@@ -9,6 +9,9 @@ type ChatCompletionStreamChoiceDelta struct {
 	Content      string        `json:"content,omitempty"`
 	Role         string        `json:"role,omitempty"`
 	FunctionCall *FunctionCall `json:"function_call,omitempty"`
+	// ToolCalls are fragments of tool calls. Fragments of the same call share its Index;
+	// only the first one carries the ID, type and function name.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
 }
 
 type ChatCompletionStreamChoice struct {
@@ -18,11 +21,12 @@ type ChatCompletionStreamChoice struct {
 }
 
 type ChatCompletionStreamResponse struct {
-	ID      string                       `json:"id"`
-	Object  string                       `json:"object"`
-	Created int64                        `json:"created"`
-	Model   string                       `json:"model"`
-	Choices []ChatCompletionStreamChoice `json:"choices"`
+	ID                string                       `json:"id"`
+	Object            string                       `json:"object"`
+	Created           int64                        `json:"created"`
+	Model             string                       `json:"model"`
+	Choices           []ChatCompletionStreamChoice `json:"choices"`
+	SystemFingerprint string                       `json:"system_fingerprint,omitempty"`
 }
 type ChatCompletionStreamResponseLemur struct {
 	ID      string                       `json:"id"`
@@ -38,8 +42,10 @@ type ChatCompletionStream struct {
 	*streamReader[ChatCompletionStreamResponse]
 }
 
+// ChatCompletionStreamLemur is a stream of the Lemur conversation endpoint.
+// Each LemurResponseST envelope is unwrapped, so Recv returns one event at a time.
 type ChatCompletionStreamLemur struct {
-	*streamReaderLemur
+	*streamReader[LemurResponseSEC]
 }
 
 // CreateChatCompletionStream — API call to create a chat completion w/ streaming
@@ -51,16 +57,20 @@ func (c *Client) CreateChatCompletionStream(
 	request ChatCompletionRequest,
 ) (stream *ChatCompletionStream, err error) {
 	urlSuffix := chatCompletionsSuffix
-	if !checkEndpointSupportsModel(urlSuffix, request.Model) {
+	if !c.checkEndpointSupportsModel(urlSuffix, request.Model) {
 		err = ErrChatCompletionInvalidModel
 		return
 	}
 
 	request.Stream = true
+	if err = c.validateChatCompletionRequest(request); err != nil {
+		return
+	}
 	req, err := c.newRequest(ctx, http.MethodPost, c.fullURL(urlSuffix, request.Model), withBody(request))
 	if err != nil {
 		return nil, err
 	}
+	req = c.withResponseCache(req, request)
 
 	resp, err := sendRequestStream[ChatCompletionStreamResponse](c, req)
 	if err != nil {
@@ -88,7 +98,7 @@ func (c *Client) CreateChatCompletionStreamLemur(
 		return
 	}
 	stream = &ChatCompletionStreamLemur{
-		resp, // 匿名字段
+		streamReader: resp,
 	}
 	return
 }
@@ -0,0 +1,223 @@
+package lemur
+
+import (
+	"sort"
+	"strings"
+)
+
+// ChatCompletionStreamAccumulator rebuilds a complete ChatCompletionResponse from the chunks
+// of a chat completion stream. Every choice index is tracked separately; content, function
+// call and tool call fragments are joined in the order they arrive, tool calls by their index.
+//
+// The zero value is ready to use. Response can be called at any time to get the partial result
+// of a stream still in progress.
+type ChatCompletionStreamAccumulator struct {
+	id      string
+	object  string
+	created int64
+	model   string
+	// systemFingerprint is the fingerprint of the last chunk carrying one.
+	systemFingerprint string
+	choices           map[int]*accumulatedChoice
+}
+
+type accumulatedChoice struct {
+	role            string
+	content         strings.Builder
+	hasFunctionCall bool
+	functionName    strings.Builder
+	arguments       strings.Builder
+	toolCalls       map[int]*accumulatedToolCall
+	finishReason    FinishReason
+}
+
+type accumulatedToolCall struct {
+	id        string
+	toolType  ToolType
+	name      strings.Builder
+	arguments strings.Builder
+}
+
+func (c *accumulatedChoice) addToolCall(position int, fragment ToolCall) {
+	index := position
+	if fragment.Index != nil {
+		index = *fragment.Index
+	}
+	if c.toolCalls == nil {
+		c.toolCalls = make(map[int]*accumulatedToolCall)
+	}
+	call, ok := c.toolCalls[index]
+	if !ok {
+		call = &accumulatedToolCall{}
+		c.toolCalls[index] = call
+	}
+	if fragment.ID != "" {
+		call.id = fragment.ID
+	}
+	if fragment.Type != "" {
+		call.toolType = fragment.Type
+	}
+	call.name.WriteString(fragment.Function.Name)
+	call.arguments.WriteString(fragment.Function.Arguments)
+}
+
+func (a *ChatCompletionStreamAccumulator) choice(index int) *accumulatedChoice {
+	if a.choices == nil {
+		a.choices = make(map[int]*accumulatedChoice)
+	}
+	c, ok := a.choices[index]
+	if !ok {
+		c = &accumulatedChoice{}
+		a.choices[index] = c
+	}
+	return c
+}
+
+// Add merges a stream chunk into the accumulated response.
+func (a *ChatCompletionStreamAccumulator) Add(chunk ChatCompletionStreamResponse) {
+	a.addHeader(chunk.ID, chunk.Object, chunk.Created, chunk.Model)
+	if chunk.SystemFingerprint != "" {
+		a.systemFingerprint = chunk.SystemFingerprint
+	}
+	for _, streamChoice := range chunk.Choices {
+		c := a.choice(streamChoice.Index)
+		delta := streamChoice.Delta
+		if delta.Role != "" {
+			c.role = delta.Role
+		}
+		c.content.WriteString(delta.Content)
+		if delta.FunctionCall != nil {
+			c.hasFunctionCall = true
+			c.functionName.WriteString(delta.FunctionCall.Name)
+			c.arguments.WriteString(delta.FunctionCall.Arguments)
+		}
+		for position, fragment := range delta.ToolCalls {
+			c.addToolCall(position, fragment)
+		}
+		if streamChoice.FinishReason != "" && streamChoice.FinishReason != FinishReasonNull {
+			c.finishReason = streamChoice.FinishReason
+		}
+	}
+}
+
+// AddLemur merges a chunk of a Lemur stream into the accumulated response.
+func (a *ChatCompletionStreamAccumulator) AddLemur(chunk LemurResponseSEC) {
+	a.addHeader(chunk.ID, chunk.Object, int64(chunk.Created), chunk.Model)
+	for _, lemurChoice := range chunk.Choices {
+		c := a.choice(lemurChoice.Index)
+		if lemurChoice.Delta.Role != "" {
+			c.role = lemurChoice.Delta.Role
+		}
+		c.content.WriteString(lemurChoice.Delta.Content)
+		if lemurChoice.FinishReason != "" && lemurChoice.FinishReason != FinishReasonNull {
+			c.finishReason = lemurChoice.FinishReason
+		}
+	}
+}
+
+func (a *ChatCompletionStreamAccumulator) addHeader(id, object string, created int64, model string) {
+	if id != "" {
+		a.id = id
+	}
+	if object != "" {
+		a.object = object
+	}
+	if created != 0 {
+		a.created = created
+	}
+	if model != "" {
+		a.model = model
+	}
+}
+
+// Content returns the content accumulated so far for the choice at index.
+func (a *ChatCompletionStreamAccumulator) Content(index int) string {
+	c, ok := a.choices[index]
+	if !ok {
+		return ""
+	}
+	return c.content.String()
+}
+
+// Finished reports whether every choice seen so far has received a finish reason.
+func (a *ChatCompletionStreamAccumulator) Finished() bool {
+	if len(a.choices) == 0 {
+		return false
+	}
+	for _, c := range a.choices {
+		if c.finishReason == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Response returns the response accumulated so far, with choices sorted by index.
+// Streams don't report token usage, so Usage is left empty.
+func (a *ChatCompletionStreamAccumulator) Response() ChatCompletionResponse {
+	response := ChatCompletionResponse{
+		ID:      a.id,
+		Object:  a.object,
+		Created: a.created,
+		Model:   a.model,
+		Choices: make([]ChatCompletionChoice, 0, len(a.choices)),
+
+		SystemFingerprint: a.systemFingerprint,
+	}
+
+	for index, c := range a.choices {
+		role := c.role
+		if role == "" {
+			role = ChatMessageRoleAssistant
+		}
+		choice := ChatCompletionChoice{
+			Index: index,
+			Message: ChatCompletionMessage{
+				Role:    role,
+				Content: c.content.String(),
+			},
+			FinishReason: c.finishReason,
+		}
+		if c.hasFunctionCall {
+			choice.Message.FunctionCall = &FunctionCall{
+				Name:      c.functionName.String(),
+				Arguments: c.arguments.String(),
+			}
+		}
+		choice.Message.ToolCalls = c.toolCallList()
+		response.Choices = append(response.Choices, choice)
+	}
+	sort.Slice(response.Choices, func(i, j int) bool {
+		return response.Choices[i].Index < response.Choices[j].Index
+	})
+	return response
+}
+
+func (c *accumulatedChoice) toolCallList() []ToolCall {
+	if len(c.toolCalls) == 0 {
+		return nil
+	}
+	indexes := make([]int, 0, len(c.toolCalls))
+	for index := range c.toolCalls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	toolCalls := make([]ToolCall, 0, len(indexes))
+	for _, index := range indexes {
+		call := c.toolCalls[index]
+		toolType := call.toolType
+		if toolType == "" {
+			toolType = ToolTypeFunction
+		}
+		toolCalls = append(toolCalls, ToolCall{
+			ID:   call.id,
+			Type: toolType,
+			Function: FunctionCall{
+				Name:      call.name.String(),
+				Arguments: call.arguments.String(),
+			},
+		})
+	}
+	return toolCalls
+}
@@ -0,0 +1,106 @@
+package lemur_test
+
+import (
+	. "chatgpt-go/pkg/lemur"
+
+	"reflect"
+	"testing"
+)
+
+func TestChatCompletionStreamAccumulator(t *testing.T) {
+	chunks := []ChatCompletionStreamResponse{
+		{
+			ID: "chatcmpl-1", Object: "chat.completion.chunk", Created: 1, Model: GPT3Dot5Turbo0613,
+			Choices: []ChatCompletionStreamChoice{
+				{Index: 0, Delta: ChatCompletionStreamChoiceDelta{Role: ChatMessageRoleAssistant}},
+				{Index: 1, Delta: ChatCompletionStreamChoiceDelta{
+					Role:         ChatMessageRoleAssistant,
+					FunctionCall: &FunctionCall{Name: "get_weather"},
+				}},
+			},
+		},
+		{
+			ID: "chatcmpl-1",
+			Choices: []ChatCompletionStreamChoice{
+				{Index: 1, Delta: ChatCompletionStreamChoiceDelta{FunctionCall: &FunctionCall{Arguments: `{"loc`}}},
+				{Index: 0, Delta: ChatCompletionStreamChoiceDelta{Content: "Hello"}},
+			},
+		},
+		{
+			ID: "chatcmpl-1",
+			Choices: []ChatCompletionStreamChoice{
+				{Index: 0, Delta: ChatCompletionStreamChoiceDelta{Content: ", world"}},
+				{Index: 1, Delta: ChatCompletionStreamChoiceDelta{FunctionCall: &FunctionCall{Arguments: `ation":"Paris"}`}}},
+			},
+		},
+		{
+			ID: "chatcmpl-1",
+			Choices: []ChatCompletionStreamChoice{
+				{Index: 1, FinishReason: FinishReasonFunctionCall},
+				{Index: 0, FinishReason: FinishReasonStop},
+			},
+		},
+	}
+
+	var acc ChatCompletionStreamAccumulator
+	for i, chunk := range chunks {
+		acc.Add(chunk)
+		if i == 1 && acc.Content(0) != "Hello" {
+			t.Errorf("Unexpected partial content %q", acc.Content(0))
+		}
+		if i < len(chunks)-1 && acc.Finished() {
+			t.Errorf("Accumulator finished before the last chunk")
+		}
+	}
+	if !acc.Finished() {
+		t.Errorf("Accumulator should be finished")
+	}
+
+	expected := ChatCompletionResponse{
+		ID:      "chatcmpl-1",
+		Object:  "chat.completion.chunk",
+		Created: 1,
+		Model:   GPT3Dot5Turbo0613,
+		Choices: []ChatCompletionChoice{
+			{
+				Index:        0,
+				Message:      ChatCompletionMessage{Role: ChatMessageRoleAssistant, Content: "Hello, world"},
+				FinishReason: FinishReasonStop,
+			},
+			{
+				Index: 1,
+				Message: ChatCompletionMessage{
+					Role:         ChatMessageRoleAssistant,
+					FunctionCall: &FunctionCall{Name: "get_weather", Arguments: `{"location":"Paris"}`},
+				},
+				FinishReason: FinishReasonFunctionCall,
+			},
+		},
+	}
+	if got := acc.Response(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestChatCompletionStreamAccumulatorLemur(t *testing.T) {
+	var acc ChatCompletionStreamAccumulator
+	acc.AddLemur(LemurResponseSEC{ID: "1", Model: GPT3Dot5Turbo, Choices: []LemurResponseSecChoice{
+		{Delta: LemurResponseSecChoiceDelta{Role: ChatMessageRoleAssistant, Content: "Hi"}},
+	}})
+	acc.AddLemur(LemurResponseSEC{ID: "1", Choices: []LemurResponseSecChoice{
+		{Delta: LemurResponseSecChoiceDelta{Content: " there"}, FinishReason: FinishReasonStop},
+	}})
+
+	response := acc.Response()
+	if len(response.Choices) != 1 || response.Choices[0].Message.Content != "Hi there" ||
+		response.Choices[0].FinishReason != FinishReasonStop || response.Model != GPT3Dot5Turbo {
+		t.Errorf("Unexpected response %+v", response)
+	}
+}
+
+func TestChatCompletionStreamAccumulatorEmpty(t *testing.T) {
+	var acc ChatCompletionStreamAccumulator
+	if acc.Finished() || acc.Content(0) != "" || len(acc.Response().Choices) != 0 {
+		t.Errorf("Empty accumulator should have no content")
+	}
+}
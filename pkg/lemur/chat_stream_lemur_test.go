@@ -0,0 +1,157 @@
+package lemur_test
+
+import (
+	. "chatgpt-go/pkg/lemur"
+	"chatgpt-go/pkg/lemur/internal/test/checks"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+// lemurEnvelope wraps server-sent events the way the Lemur endpoint does.
+func lemurEnvelope(t *testing.T, code int, events ...string) string {
+	t.Helper()
+	data := ""
+	for _, event := range events {
+		data += "data: " + event + "\n\n"
+	}
+	b, err := json.Marshal(LemurResponseST{Origin: "lemur", Data: data, Code: code})
+	checks.NoError(t, err, "marshal envelope")
+	return "data: " + string(b) + "\n\n"
+}
+
+func createLemurTestStream(t *testing.T, body string) (*ChatCompletionStreamLemur, func()) {
+	t.Helper()
+	client, server, teardown := setuplemurTestServer()
+	server.RegisterHandler("/v1/chat/conversation-trial", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, err := io.WriteString(w, body)
+		checks.NoError(t, err, "Write error")
+	})
+
+	stream, err := client.CreateChatCompletionStreamLemur(context.Background(), ChatCompletionRequestLemur{Messages: "[]"})
+	checks.NoError(t, err, "CreateChatCompletionStreamLemur returned error")
+	return stream, func() {
+		stream.Close()
+		teardown()
+	}
+}
+
+func TestCreateChatCompletionStreamLemur(t *testing.T) {
+	//nolint:lll
+	body := lemurEnvelope(t, 0,
+		`{"id":"1","object":"chat.completion.chunk","created":1,"model":"gpt-3.5-turbo","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}},{"index":1,"delta":{"content":"Hi"}}]}`,
+		`{"id":"1","object":"chat.completion.chunk","created":1,"model":"gpt-3.5-turbo","choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+	) + lemurEnvelope(t, 0,
+		`{"id":"1","object":"chat.completion.chunk","created":1,"model":"gpt-3.5-turbo","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+	) + "data: [DONE]\n\n"
+
+	stream, teardown := createLemurTestStream(t, body)
+	defer teardown()
+
+	first, err := stream.Recv()
+	checks.NoError(t, err, "stream.Recv() failed")
+	if len(first.Choices) != 2 || first.Choices[0].Delta.Content != "Hel" || first.Choices[1].Delta.Content != "Hi" {
+		t.Errorf("Multiple choices were not kept: %+v", first)
+	}
+	if first.Choices[0].Delta.Role != ChatMessageRoleAssistant {
+		t.Errorf("Role was not kept: %+v", first)
+	}
+
+	second, err := stream.Recv()
+	checks.NoError(t, err, "stream.Recv() failed")
+	if second.Choices[0].Delta.Content != "lo" {
+		t.Errorf("Unexpected second event: %+v", second)
+	}
+
+	last, err := stream.Recv()
+	checks.NoError(t, err, "stream.Recv() failed")
+	if last.Choices[0].FinishReason != FinishReasonStop {
+		t.Errorf("finish_reason was not kept: %+v", last)
+	}
+
+	_, err = stream.Recv()
+	checks.ErrorIs(t, err, io.EOF, "stream.Recv() did not return EOF in the end")
+	_, err = stream.Recv()
+	checks.ErrorIs(t, err, io.EOF, "stream.Recv() did not return EOF when the stream is finished")
+}
+
+func TestCreateChatCompletionStreamLemurDoneInsideEnvelope(t *testing.T) {
+	//nolint:lll
+	body := lemurEnvelope(t, 0,
+		`{"id":"1","object":"chat.completion.chunk","created":1,"model":"gpt-3.5-turbo","choices":[{"index":0,"delta":{"content":"done"}}]}`,
+		`[DONE]`,
+	)
+
+	stream, teardown := createLemurTestStream(t, body)
+	defer teardown()
+
+	_, err := stream.Recv()
+	checks.NoError(t, err, "stream.Recv() failed")
+	_, err = stream.Recv()
+	checks.ErrorIs(t, err, io.EOF, "[DONE] inside the envelope should end the stream")
+}
+
+func TestCreateChatCompletionStreamLemurBareEvents(t *testing.T) {
+	//nolint:lll
+	data := `{"id":"1","object":"chat.completion.chunk","created":1,"model":"gpt-3.5-turbo","choices":[{"index":0,"delta":{"content":"Hel"}}]}` + "\n\n" +
+		`{"id":"1","object":"chat.completion.chunk","created":1,"model":"gpt-3.5-turbo","choices":[{"index":0,"delta":{"content":"lo"}}]}` + "\n\n"
+	b, err := json.Marshal(LemurResponseST{Origin: "lemur", Data: data})
+	checks.NoError(t, err, "marshal envelope")
+
+	stream, teardown := createLemurTestStream(t, "data: "+string(b)+"\n\ndata: [DONE]\n\n")
+	defer teardown()
+
+	content := ""
+	for {
+		response, recvErr := stream.Recv()
+		if errors.Is(recvErr, io.EOF) {
+			break
+		}
+		checks.NoError(t, recvErr, "stream.Recv() failed")
+		content += response.Choices[0].Delta.Content
+	}
+	if content != "Hello" {
+		t.Errorf("Bare JSON events were not decoded, got %q", content)
+	}
+}
+
+func TestCreateChatCompletionStreamLemurErrorCode(t *testing.T) {
+	stream, teardown := createLemurTestStream(t, `data: {"origin":"lemur","data":"too many requests","code":429}`+"\n\n")
+	defer teardown()
+
+	_, err := stream.Recv()
+	var lemurErr *LemurError
+	if !errors.As(err, &lemurErr) {
+		t.Fatalf("stream.Recv() did not return LemurError: %v", err)
+	}
+	if lemurErr.Code != 429 || lemurErr.Message != "too many requests" {
+		t.Errorf("Unexpected LemurError: %+v", lemurErr)
+	}
+}
+
+func TestCreateChatCompletionStreamLemurMalformedEvent(t *testing.T) {
+	stream, teardown := createLemurTestStream(t, lemurEnvelope(t, 0, `{"id":`))
+	defer teardown()
+
+	_, err := stream.Recv()
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("stream.Recv() should report malformed events, got %v", err)
+	}
+}
+
+func TestCreateChatCompletionStreamLemurAPIError(t *testing.T) {
+	stream, teardown := createLemurTestStream(t, `{"error":{"message":"invalid token","type":"invalid_request_error"}}`+"\n")
+	defer teardown()
+
+	_, err := stream.Recv()
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Message != "invalid token" {
+		t.Errorf("stream.Recv() should accumulate the API error, got %v", err)
+	}
+}
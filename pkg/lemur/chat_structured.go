@@ -0,0 +1,77 @@
+package lemur
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"chatgpt-go/pkg/lemur/jsonschema"
+)
+
+var ErrNoChoices = errors.New("the response has no choices")
+
+// StructuredOutputError is returned by CreateStructuredChatCompletion when the model
+// didn't answer with JSON matching the schema.
+type StructuredOutputError struct {
+	// Content is the last answer of the model.
+	Content string
+	Err     error
+}
+
+func (e *StructuredOutputError) Error() string {
+	return "invalid structured output: " + e.Err.Error()
+}
+
+func (e *StructuredOutputError) Unwrap() error {
+	return e.Err
+}
+
+// correctionMessageFormat is the message sent back to the model after an invalid answer.
+const correctionMessageFormat = "Your answer is not valid: %v. Answer again with only a JSON document matching the schema."
+
+// CreateStructuredChatCompletion creates a chat completion whose answer must be a JSON document
+// matching schema, and unmarshals the answer into v.
+//
+// The response format defaults to JSON mode; set request.ResponseFormat to use a JSON schema
+// instead with the models supporting it. When the answer is invalid, the request is retried
+// up to maxRetries times with the answer and a correction message appended to the conversation.
+// The returned response is the last one received, the error a *StructuredOutputError if no
+// answer was valid.
+func (c *Client) CreateStructuredChatCompletion(
+	ctx context.Context,
+	request ChatCompletionRequest,
+	schema jsonschema.Definition,
+	v any,
+	maxRetries int,
+) (response ChatCompletionResponse, err error) {
+	if request.ResponseFormat == nil {
+		request.ResponseFormat = &ChatCompletionResponseFormat{Type: ChatCompletionResponseFormatTypeJSONObject}
+	}
+	// The caller's messages must not be changed by the corrections.
+	request.Messages = slices.Clip(request.Messages)
+
+	for attempt := 0; ; attempt++ {
+		response, err = c.CreateChatCompletion(ctx, request)
+		if err != nil {
+			return
+		}
+		if len(response.Choices) == 0 {
+			err = ErrNoChoices
+			return
+		}
+		answer := response.Choices[0].Message
+		verifyErr := jsonschema.VerifySchemaAndUnmarshal(schema, []byte(answer.Content), v)
+		if verifyErr == nil {
+			return
+		}
+		if attempt >= maxRetries {
+			err = &StructuredOutputError{Content: answer.Content, Err: verifyErr}
+			return
+		}
+		request.Messages = append(request.Messages, answer, ChatCompletionMessage{
+			Role:    ChatMessageRoleUser,
+			Content: fmt.Sprintf(correctionMessageFormat, verifyErr),
+		})
+	}
+}
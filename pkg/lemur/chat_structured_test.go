@@ -0,0 +1,195 @@
+package lemur_test
+
+import (
+	. "chatgpt-go/pkg/lemur"
+	"chatgpt-go/pkg/lemur/internal/test/checks"
+	"chatgpt-go/pkg/lemur/jsonschema"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var personSchema = jsonschema.Definition{
+	Type: jsonschema.Object,
+	Properties: map[string]jsonschema.Definition{
+		"name": {Type: jsonschema.String},
+		"age":  {Type: jsonschema.Integer},
+	},
+	Required: []string{"name", "age"},
+}
+
+type person struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+// structuredRequest is the part of a chat completion request seen by the test server.
+// The schema is kept raw since ChatCompletionResponseFormatJSONSchema can't be unmarshaled.
+type structuredRequest struct {
+	Messages       []ChatCompletionMessage `json:"messages"`
+	Seed           *int                    `json:"seed"`
+	ResponseFormat *struct {
+		Type       ChatCompletionResponseFormatType `json:"type"`
+		JSONSchema json.RawMessage                  `json:"json_schema"`
+	} `json:"response_format"`
+}
+
+// structuredTestHandler answers with the given contents in turn and records the requests.
+func structuredTestHandler(
+	t *testing.T,
+	requests *[]structuredRequest,
+	answers ...string,
+) func(http.ResponseWriter, *http.Request) {
+	t.Helper()
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request structuredRequest
+		checks.NoError(t, json.NewDecoder(r.Body).Decode(&request), "Decode request error")
+		*requests = append(*requests, request)
+
+		answer, _ := json.Marshal(answers[len(*requests)-1])
+		fmt.Fprintf(w, `{"id":"chatcmpl-%d","system_fingerprint":"fp_44709d6fcb",`+
+			`"choices":[{"index":0,"message":{"role":"assistant","content":%s},"finish_reason":"stop"}]}`,
+			len(*requests), answer)
+	}
+}
+
+func TestCreateStructuredChatCompletion(t *testing.T) {
+	client, server, teardown := setuplemurTestServer()
+	defer teardown()
+	var requests []structuredRequest
+	server.RegisterHandler("/v1/chat/completions",
+		structuredTestHandler(t, &requests, `{"name":"Ada"}`, `{"name":"Ada","age":36}`))
+
+	seed := 42
+	messages := []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "Extract the person as JSON: Ada, 36."}}
+	var result person
+	response, err := client.CreateStructuredChatCompletion(context.Background(), ChatCompletionRequest{
+		Model:    GPT3Dot5Turbo1106,
+		Messages: messages,
+		Seed:     &seed,
+	}, personSchema, &result, 1)
+	checks.NoError(t, err, "CreateStructuredChatCompletion error")
+
+	if result != (person{Name: "Ada", Age: 36}) {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if response.ID != "chatcmpl-2" || response.SystemFingerprint != "fp_44709d6fcb" {
+		t.Errorf("Unexpected response %+v", response)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(requests))
+	}
+	first := requests[0]
+	if first.ResponseFormat == nil || first.ResponseFormat.Type != ChatCompletionResponseFormatTypeJSONObject ||
+		first.Seed == nil || *first.Seed != 42 {
+		t.Errorf("Unexpected first request %+v", first)
+	}
+	retry := requests[1].Messages
+	if len(retry) != 3 || retry[1].Content != `{"name":"Ada"}` || retry[2].Role != ChatMessageRoleUser ||
+		!strings.Contains(retry[2].Content, jsonschema.ErrSchemaMismatch.Error()) {
+		t.Errorf("Unexpected retry messages %+v", retry)
+	}
+	if len(messages) != 1 {
+		t.Errorf("The messages of the caller were changed: %+v", messages)
+	}
+}
+
+func TestCreateStructuredChatCompletionInvalid(t *testing.T) {
+	client, server, teardown := setuplemurTestServer()
+	defer teardown()
+	var requests []structuredRequest
+	server.RegisterHandler("/v1/chat/completions",
+		structuredTestHandler(t, &requests, "Ada is 36.", `{"name":"Ada","age":"36"}`))
+
+	var result person
+	_, err := client.CreateStructuredChatCompletion(context.Background(), ChatCompletionRequest{
+		Model:    GPT3Dot5Turbo1106,
+		Messages: []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "Extract the person as JSON."}},
+		ResponseFormat: &ChatCompletionResponseFormat{
+			Type: ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &ChatCompletionResponseFormatJSONSchema{
+				Name:   "person",
+				Schema: personSchema,
+				Strict: true,
+			},
+		},
+	}, personSchema, &result, 1)
+
+	var structuredErr *StructuredOutputError
+	if !errors.As(err, &structuredErr) || structuredErr.Content != `{"name":"Ada","age":"36"}` {
+		t.Fatalf("Expected a StructuredOutputError, got %v", err)
+	}
+	checks.ErrorIs(t, err, jsonschema.ErrSchemaMismatch, "the schema mismatch should be wrapped")
+	if len(requests) != 2 || !strings.Contains(string(requests[0].ResponseFormat.JSONSchema), `"name":"person"`) {
+		t.Errorf("Unexpected requests %+v", requests)
+	}
+}
+
+func TestChatCompletionRequestResponseFormatJSON(t *testing.T) {
+	seed := 7
+	data, err := json.Marshal(ChatCompletionRequest{
+		Model:    GPT3Dot5Turbo1106,
+		Messages: []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "JSON please"}},
+		Seed:     &seed,
+		ResponseFormat: &ChatCompletionResponseFormat{
+			Type: ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &ChatCompletionResponseFormatJSONSchema{
+				Name:   "answer",
+				Schema: jsonschema.Definition{Type: jsonschema.String},
+			},
+		},
+	})
+	checks.NoError(t, err, "Marshal error")
+	//nolint:lll
+	expected := `"response_format":{"type":"json_schema","json_schema":{"name":"answer","schema":{"type":"string","properties":{}},"strict":false}},"seed":7}`
+	if !strings.HasSuffix(string(data), expected) {
+		t.Errorf("Expected a request ending with %s, got %s", expected, data)
+	}
+}
+
+func TestValidateChatCompletionRequestResponseFormat(t *testing.T) {
+	client := newValidatingClient()
+	messages := []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "Hello"}}
+	tests := []struct {
+		format   ChatCompletionResponseFormat
+		problems []string
+	}{
+		{
+			ChatCompletionResponseFormat{Type: ChatCompletionResponseFormatTypeJSONObject},
+			[]string{"response_format json_object needs the word JSON in the messages"},
+		},
+		{
+			ChatCompletionResponseFormat{Type: ChatCompletionResponseFormatTypeJSONSchema},
+			[]string{"response_format json_schema needs a json_schema"},
+		},
+		{
+			ChatCompletionResponseFormat{
+				Type:       ChatCompletionResponseFormatTypeJSONSchema,
+				JSONSchema: &ChatCompletionResponseFormatJSONSchema{Name: "answer"},
+			},
+			[]string{"response_format: json_schema answer has no schema"},
+		},
+		{
+			ChatCompletionResponseFormat{Type: "yaml"},
+			[]string{`response_format: unknown type "yaml"`},
+		},
+	}
+	for _, tt := range tests {
+		format := tt.format
+		err := client.ValidateChatCompletionRequest(ChatCompletionRequest{
+			Model:          GPT3Dot5Turbo1106,
+			Messages:       messages,
+			ResponseFormat: &format,
+		})
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) || !reflect.DeepEqual(validationErr.Problems, tt.problems) {
+			t.Errorf("Validating %+v returned %v, want %v", tt.format, err, tt.problems)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package lemur_test
+
+import (
+	. "chatgpt-go/pkg/lemur"
+	"chatgpt-go/pkg/lemur/internal/test/checks"
+	"chatgpt-go/pkg/lemur/jsonschema"
+
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+var weatherTool = Tool{
+	Type: ToolTypeFunction,
+	Function: &FunctionDefinition{
+		Name: "get_weather",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"location": {Type: jsonschema.String},
+			},
+			Required: []string{"location"},
+		},
+	},
+}
+
+func TestChatCompletionWithTools(t *testing.T) {
+	client, server, teardown := setuplemurTestServer()
+	defer teardown()
+	server.RegisterHandler("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		err := json.NewDecoder(r.Body).Decode(&body)
+		checks.NoError(t, err, "Decode request error")
+
+		var toolChoice ToolChoice
+		raw, _ := json.Marshal(body["tool_choice"])
+		checks.NoError(t, json.Unmarshal(raw, &toolChoice), "Decode tool_choice error")
+		if toolChoice.Type != ToolTypeFunction || toolChoice.Function == nil || toolChoice.Function.Name != "get_weather" {
+			t.Errorf("Unexpected tool_choice %s", raw)
+		}
+		if body["parallel_tool_calls"] != true {
+			t.Errorf("Unexpected parallel_tool_calls %v", body["parallel_tool_calls"])
+		}
+		if tools, _ := body["tools"].([]any); len(tools) != 1 {
+			t.Errorf("Unexpected tools %v", body["tools"])
+		}
+		messages, _ := body["messages"].([]any)
+		toolMessage, _ := messages[len(messages)-1].(map[string]any)
+		if toolMessage["role"] != ChatMessageRoleTool || toolMessage["tool_call_id"] != "call_1" {
+			t.Errorf("Unexpected tool message %v", toolMessage)
+		}
+
+		//nolint:lll
+		fmt.Fprint(w, `{"id":"chatcmpl-1","object":"chat.completion","created":1,"model":"gpt-3.5-turbo-1106","choices":[{"index":0,"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_2","type":"function","function":{"name":"get_weather","arguments":"{\"location\":\"Paris\"}"}},{"id":"call_3","type":"function","function":{"name":"get_weather","arguments":"{\"location\":\"Tokyo\"}"}}]},"finish_reason":"tool_calls"}]}`)
+	})
+
+	parallel := true
+	response, err := client.CreateChatCompletion(context.Background(), ChatCompletionRequest{
+		Model: GPT3Dot5Turbo1106,
+		Messages: []ChatCompletionMessage{
+			{Role: ChatMessageRoleUser, Content: "What's the weather in Berlin?"},
+			{Role: ChatMessageRoleAssistant, ToolCalls: []ToolCall{{
+				ID:       "call_1",
+				Type:     ToolTypeFunction,
+				Function: FunctionCall{Name: "get_weather", Arguments: `{"location":"Berlin"}`},
+			}}},
+			{Role: ChatMessageRoleTool, ToolCallID: "call_1", Content: "sunny"},
+		},
+		Tools:             []Tool{weatherTool},
+		ToolChoice:        ToolChoice{Type: ToolTypeFunction, Function: &ToolFunction{Name: "get_weather"}},
+		ParallelToolCalls: &parallel,
+	})
+	checks.NoError(t, err, "CreateChatCompletion error")
+
+	choice := response.Choices[0]
+	if choice.FinishReason != FinishReasonToolCalls {
+		t.Errorf("Unexpected finish reason %s", choice.FinishReason)
+	}
+	expected := []ToolCall{
+		{ID: "call_2", Type: ToolTypeFunction, Function: FunctionCall{Name: "get_weather", Arguments: `{"location":"Paris"}`}},
+		{ID: "call_3", Type: ToolTypeFunction, Function: FunctionCall{Name: "get_weather", Arguments: `{"location":"Tokyo"}`}},
+	}
+	if !reflect.DeepEqual(choice.Message.ToolCalls, expected) {
+		t.Errorf("Expected tool calls %+v, got %+v", expected, choice.Message.ToolCalls)
+	}
+}
+
+func TestChatCompletionStreamWithTools(t *testing.T) {
+	client, server, teardown := setuplemurTestServer()
+	defer teardown()
+	server.RegisterHandler("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		//nolint:lll
+		chunks := []string{
+			`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+			`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"get_time","arguments":""}}]}}]}`,
+			`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"location\":"}}]}}]}`,
+			`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"function":{"arguments":"{\"zone\":\"UTC\"}"}}]}}]}`,
+			`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`,
+			`{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		}
+		for _, chunk := range chunks {
+			_, _ = io.WriteString(w, "data: "+chunk+"\n\n")
+		}
+		_, _ = io.WriteString(w, "data: [DONE]\n\n")
+	})
+
+	stream, err := client.CreateChatCompletionStream(context.Background(), ChatCompletionRequest{
+		Model:    GPT3Dot5Turbo1106,
+		Messages: []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "Weather and time?"}},
+		Tools:    []Tool{weatherTool},
+	})
+	checks.NoError(t, err, "CreateChatCompletionStream error")
+
+	var acc ChatCompletionStreamAccumulator
+	first := true
+	for chunk, err := range stream.All() {
+		checks.NoError(t, err, "stream error")
+		if first {
+			call := chunk.Choices[0].Delta.ToolCalls[0]
+			if call.Index == nil || *call.Index != 0 || call.ID != "call_a" {
+				t.Errorf("Unexpected first tool call fragment %+v", call)
+			}
+			first = false
+		}
+		acc.Add(chunk)
+	}
+
+	message := acc.Response().Choices[0].Message
+	expected := []ToolCall{
+		{ID: "call_a", Type: ToolTypeFunction, Function: FunctionCall{Name: "get_weather", Arguments: `{"location":"Paris"}`}},
+		{ID: "call_b", Type: ToolTypeFunction, Function: FunctionCall{Name: "get_time", Arguments: `{"zone":"UTC"}`}},
+	}
+	if !reflect.DeepEqual(message.ToolCalls, expected) {
+		t.Errorf("Expected tool calls %+v, got %+v", expected, message.ToolCalls)
+	}
+	if acc.Response().Choices[0].FinishReason != FinishReasonToolCalls || message.FunctionCall != nil {
+		t.Errorf("Unexpected accumulated message %+v", acc.Response().Choices[0])
+	}
+}
+
+func TestChatCompletionRequestLegacyFunctions(t *testing.T) {
+	data, err := json.Marshal(ChatCompletionRequest{
+		Model:        GPT3Dot5Turbo0613,
+		Messages:     []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "Hi"}},
+		Functions:    []FunctionDefinition{{Name: "get_weather"}},
+		FunctionCall: "auto",
+	})
+	checks.NoError(t, err, "Marshal error")
+
+	var body map[string]any
+	checks.NoError(t, json.Unmarshal(data, &body), "Unmarshal error")
+	if body["function_call"] != "auto" || body["functions"] == nil {
+		t.Errorf("Legacy fields are missing from %s", data)
+	}
+	for _, field := range []string{"tools", "tool_choice", "parallel_tool_calls"} {
+		if _, ok := body[field]; ok {
+			t.Errorf("Unset field %s should be omitted from %s", field, data)
+		}
+	}
+}
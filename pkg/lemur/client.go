@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	utils "chatgpt-go/pkg/lemur/internal"
 )
@@ -15,6 +16,7 @@ import (
 // Client is lemur GPT-3 API client.
 type Client struct {
 	config ClientConfig
+	send   RequestFunc
 
 	requestBuilder    utils.RequestBuilder
 	createFormBuilder func(io.Writer) utils.FormBuilder
@@ -28,8 +30,12 @@ func NewClient(authToken string) *Client {
 
 // NewClientWithConfig creates new lemur API client for specified config.
 func NewClientWithConfig(config ClientConfig) *Client {
+	if config.Proxy != nil {
+		config.HTTPClient = withProxy(config.HTTPClient, *config.Proxy)
+	}
 	return &Client{
 		config:         config,
+		send:           chainInterceptors(config.Interceptors, config.HTTPClient.Do),
 		requestBuilder: utils.NewRequestBuilder(),
 		createFormBuilder: func(body io.Writer) utils.FormBuilder {
 			return utils.NewFormBuilder(body)
@@ -46,6 +52,12 @@ func NewOrgClient(authToken, org string) *Client {
 	return NewClientWithConfig(config)
 }
 
+// CloseIdleConnections closes idle connections kept by the underlying HTTP client.
+// Requests in progress are not interrupted.
+func (c *Client) CloseIdleConnections() {
+	c.config.HTTPClient.CloseIdleConnections()
+}
+
 type requestOptions struct {
 	body   any
 	header http.Header
@@ -82,7 +94,22 @@ func (c *Client) newRequest(ctx context.Context, method, url string, setters ...
 	return req, nil
 }
 
+// metadataHolder is implemented by response types embedding ResponseMetadata.
+type metadataHolder interface {
+	metadata() *ResponseMetadata
+}
+
 func (c *Client) sendRequest(req *http.Request, v any) error {
+	var metadata *ResponseMetadata
+	if holder, ok := v.(metadataHolder); ok {
+		metadata = holder.metadata()
+	}
+	return c.sendRequestWithMetadata(req, v, metadata)
+}
+
+// sendRequestWithMetadata decodes the response into v and, if metadata isn't nil, records the
+// response metadata into it.
+func (c *Client) sendRequestWithMetadata(req *http.Request, v any, metadata *ResponseMetadata) error {
 	req.Header.Set("Accept", "application/json; charset=utf-8")
 
 	// Check whether Content-Type is already set, Upload Files API requires
@@ -92,13 +119,18 @@ func (c *Client) sendRequest(req *http.Request, v any) error {
 		req.Header.Set("Content-Type", "application/json; charset=utf-8")
 	}
 
-	res, err := c.config.HTTPClient.Do(req)
+	start := time.Now()
+	res, err := c.do(req)
 	if err != nil {
 		return err
 	}
 
 	defer res.Body.Close()
 
+	if metadata != nil {
+		metadata.setMetadata(res.Header, time.Since(start))
+	}
+
 	if isFailureStatusCode(res) {
 		return c.handleErrorResp(res)
 	}
@@ -107,7 +139,7 @@ func (c *Client) sendRequest(req *http.Request, v any) error {
 }
 
 func (c *Client) sendRequestRaw(req *http.Request) (body io.ReadCloser, err error) {
-	resp, err := c.config.HTTPClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return
 	}
@@ -125,42 +157,50 @@ func sendRequestStream[T streamable](client *Client, req *http.Request) (*stream
 	req.Header.Set("Cache-Control", "no-cache")
 	req.Header.Set("Connection", "keep-alive")
 
-	resp, err := client.config.HTTPClient.Do(req) //nolint:bodyclose // body is closed in stream.Close()
-	if err != nil {
-		return new(streamReader[T]), err
-	}
-	if isFailureStatusCode(resp) {
-		return new(streamReader[T]), client.handleErrorResp(resp)
-	}
-	return &streamReader[T]{
-		emptyMessagesLimit: client.config.EmptyMessagesLimit,
-		reader:             bufio.NewReader(resp.Body),
-		response:           resp,
-		errAccumulator:     utils.NewErrorAccumulator(),
-		unmarshaler:        &utils.JSONUnmarshaler{},
-	}, nil
+	return openStream[T](client, req, decodeSingleFrame)
 }
-func sendRequestStreamLemur(client *Client, req *http.Request) (*streamReaderLemur, error) {
 
+func sendRequestStreamLemur(client *Client, req *http.Request) (*streamReader[LemurResponseSEC], error) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Linux; Android 7.1.1; NX595J) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/110.0.0.0 Mobile Safari/537.36")
 	req.Header.Set("Accept-Encoding", " gzip, deflate")
 	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9")
 
-	resp, err := client.config.HTTPClient.Do(req) //nolint:bodyclose // body is closed in stream.Close()
+	return openStream[LemurResponseSEC](client, req, decodeLemurFrames)
+}
+
+func openStream[T streamable](client *Client, req *http.Request, decodeFrames frameDecoder) (*streamReader[T], error) {
+	start := time.Now()
+	resp, err := client.do(req) //nolint:bodyclose // body is closed in stream.Close()
 	if err != nil {
-		return new(streamReaderLemur), err
+		return new(streamReader[T]), err
 	}
 	if isFailureStatusCode(resp) {
-		return new(streamReaderLemur), client.handleErrorResp(resp)
+		return new(streamReader[T]), client.handleErrorResp(resp)
 	}
-	return &streamReaderLemur{
+	stream := &streamReader[T]{
+		ResponseMetadata:   ResponseMetadata{header: resp.Header, latency: time.Since(start)},
 		emptyMessagesLimit: client.config.EmptyMessagesLimit,
+		idleTimeout:        client.config.StreamIdleTimeout,
 		reader:             bufio.NewReader(resp.Body),
 		response:           resp,
 		errAccumulator:     utils.NewErrorAccumulator(),
 		unmarshaler:        &utils.JSONUnmarshaler{},
-	}, nil
+		decodeFrames:       decodeFrames,
+	}
+	if idle := client.config.StreamIdleTimeout; idle > 0 {
+		// armed by readLine around every read
+		stream.idleTimer = time.AfterFunc(idle, func() {
+			stream.expire(ErrStreamIdleTimeout, idle)
+		})
+		stream.idleTimer.Stop()
+	}
+	if total := client.config.StreamTotalTimeout; total > 0 {
+		stream.totalTimer = time.AfterFunc(total, func() {
+			stream.expire(ErrStreamTotalTimeout, total)
+		})
+	}
+	return stream, nil
 }
 
 func (c *Client) setCommonHeaders(req *http.Request) {
@@ -17,12 +17,15 @@ var (
 // GPT3 Models are designed for text-based tasks. For code-specific
 // tasks, please refer to the Codex series of models.
 const (
+	GPT4TurboPreview      = "gpt-4-1106-preview"
+	GPT4VisionPreview     = "gpt-4-vision-preview"
 	GPT432K0613           = "gpt-4-32k-0613"
 	GPT432K0314           = "gpt-4-32k-0314"
 	GPT432K               = "gpt-4-32k"
 	GPT40613              = "gpt-4-0613"
 	GPT40314              = "gpt-4-0314"
 	GPT4                  = "gpt-4"
+	GPT3Dot5Turbo1106     = "gpt-3.5-turbo-1106"
 	GPT3Dot5Turbo0613     = "gpt-3.5-turbo-0613"
 	GPT3Dot5Turbo0301     = "gpt-3.5-turbo-0301"
 	GPT3Dot5Turbo16K      = "gpt-3.5-turbo-16k"
@@ -64,41 +67,8 @@ const (
 	CodexCodeDavinci001 = "code-davinci-001"
 )
 
-var disabledModelsForEndpoints = map[string]map[string]bool{
-	"/completions": {
-		GPT3Dot5Turbo:        true,
-		GPT3Dot5Turbo0301:    true,
-		GPT3Dot5Turbo0613:    true,
-		GPT3Dot5Turbo16K:     true,
-		GPT3Dot5Turbo16K0613: true,
-		GPT4:                 true,
-		GPT40314:             true,
-		GPT40613:             true,
-		GPT432K:              true,
-		GPT432K0314:          true,
-		GPT432K0613:          true,
-	},
-	chatCompletionsSuffix: {
-		CodexCodeDavinci002:     true,
-		CodexCodeCushman001:     true,
-		CodexCodeDavinci001:     true,
-		GPT3TextDavinci003:      true,
-		GPT3TextDavinci002:      true,
-		GPT3TextCurie001:        true,
-		GPT3TextBabbage001:      true,
-		GPT3TextAda001:          true,
-		GPT3TextDavinci001:      true,
-		GPT3DavinciInstructBeta: true,
-		GPT3Davinci:             true,
-		GPT3CurieInstructBeta:   true,
-		GPT3Curie:               true,
-		GPT3Ada:                 true,
-		GPT3Babbage:             true,
-	},
-}
-
-func checkEndpointSupportsModel(endpoint, model string) bool {
-	return !disabledModelsForEndpoints[endpoint][model]
+func (c *Client) checkEndpointSupportsModel(endpoint, model string) bool {
+	return c.models().supportsEndpoint(endpoint, model)
 }
 
 func checkPromptType(prompt any) bool {
@@ -154,6 +124,8 @@ type CompletionResponse struct {
 	Model   string             `json:"model"`
 	Choices []CompletionChoice `json:"choices"`
 	Usage   Usage              `json:"usage"`
+
+	ResponseMetadata
 }
 
 // CreateCompletion — API call to create a completion. This is the main endpoint of the API. Returns new text as well
@@ -171,7 +143,7 @@ func (c *Client) CreateCompletion(
 	}
 
 	urlSuffix := "/completions"
-	if !checkEndpointSupportsModel(urlSuffix, request.Model) {
+	if !c.checkEndpointSupportsModel(urlSuffix, request.Model) {
 		err = ErrCompletionUnsupportedModel
 		return
 	}
@@ -180,6 +152,9 @@ func (c *Client) CreateCompletion(
 		err = ErrCompletionRequestPromptTypeNotSupported
 		return
 	}
+	if err = c.validateCompletionRequest(request); err != nil {
+		return
+	}
 
 	req, err := c.newRequest(ctx, http.MethodPost, c.fullURL(urlSuffix, request.Model), withBody(request))
 	if err != nil {
@@ -3,6 +3,7 @@ package lemur
 import (
 	"net/http"
 	"regexp"
+	"time"
 )
 
 const (
@@ -33,8 +34,28 @@ type ClientConfig struct {
 	APIVersion           string                    // required when APIType is APITypeAzure or APITypeAzureAD
 	AzureModelMapperFunc func(model string) string // replace model to azure deployment name func
 	HTTPClient           *http.Client
+	// Proxy, when set, routes requests through the given proxy.
+	// It is applied to a copy of HTTPClient, which must use an *http.Transport.
+	Proxy *ProxyConfig
+	// RetryPolicy controls retries of failed requests. Retries are disabled by default.
+	RetryPolicy RetryPolicy
+	// Interceptors run in order around every HTTP call, the first one being the outermost.
+	Interceptors []Interceptor
+	// Models is the registry requests are validated against. Nil means the built-in models.
+	Models *ModelRegistry
+	// ValidateRequests checks chat and completion requests before sending them,
+	// see Client.ValidateChatCompletionRequest.
+	ValidateRequests bool
+	// ResponseCache, when set, answers identical cacheable chat completion requests with the
+	// same response, and sends concurrent identical requests upstream only once.
+	ResponseCache *ResponseCache
 
 	EmptyMessagesLimit uint
+	// StreamIdleTimeout limits the wait for each line of a stream. Zero means no limit.
+	StreamIdleTimeout time.Duration
+	// StreamTotalTimeout limits the lifetime of a stream, counted from the moment
+	// its response headers are received. Zero means no limit.
+	StreamTotalTimeout time.Duration
 }
 
 func DefaultConfig(authToken string) ClientConfig {
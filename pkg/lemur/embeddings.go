@@ -2,6 +2,11 @@ package lemur
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
 )
 
@@ -67,6 +72,8 @@ const (
 	// Deprecated: Will be shut down on January 04, 2024. Use text-embedding-ada-002 instead.
 	BabbageCodeSearchText
 	AdaEmbeddingV2
+	SmallEmbedding3
+	LargeEmbedding3
 )
 
 var enumToString = map[EmbeddingModel]string{
@@ -87,6 +94,8 @@ var enumToString = map[EmbeddingModel]string{
 	BabbageCodeSearchCode: "code-search-babbage-code-001",
 	BabbageCodeSearchText: "code-search-babbage-text-001",
 	AdaEmbeddingV2:        "text-embedding-ada-002",
+	SmallEmbedding3:       "text-embedding-3-small",
+	LargeEmbedding3:       "text-embedding-3-large",
 }
 
 var stringToEnum = map[string]EmbeddingModel{
@@ -107,6 +116,8 @@ var stringToEnum = map[string]EmbeddingModel{
 	"code-search-babbage-code-001":  BabbageCodeSearchCode,
 	"code-search-babbage-text-001":  BabbageCodeSearchText,
 	"text-embedding-ada-002":        AdaEmbeddingV2,
+	"text-embedding-3-small":        SmallEmbedding3,
+	"text-embedding-3-large":        LargeEmbedding3,
 }
 
 // Embedding is a special format of data representation that can be easily utilized by machine
@@ -121,12 +132,61 @@ type Embedding struct {
 	Index     int       `json:"index"`
 }
 
+// UnmarshalJSON decodes the embedding from an array of numbers, or from the base64 string
+// returned with EmbeddingEncodingFormatBase64.
+func (e *Embedding) UnmarshalJSON(data []byte) error {
+	type embedding Embedding
+	var raw struct {
+		embedding
+		Embedding json.RawMessage `json:"embedding"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*e = Embedding(raw.embedding)
+	if len(raw.Embedding) == 0 {
+		return nil
+	}
+	if raw.Embedding[0] != '"' {
+		return json.Unmarshal(raw.Embedding, &e.Embedding)
+	}
+
+	var encoded string
+	if err := json.Unmarshal(raw.Embedding, &encoded); err != nil {
+		return err
+	}
+	vector, err := decodeBase64Embedding(encoded)
+	if err != nil {
+		return err
+	}
+	e.Embedding = vector
+	return nil
+}
+
+// decodeBase64Embedding decodes a vector of little-endian float32 encoded in base64.
+func decodeBase64Embedding(encoded string) ([]float32, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding base64 embedding: %w", err)
+	}
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("decoding base64 embedding: %d bytes is not a whole number of float32", len(data))
+	}
+	vector := make([]float32, len(data)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return vector, nil
+}
+
 // EmbeddingResponse is the response from a Create embeddings request.
 type EmbeddingResponse struct {
 	Object string         `json:"object"`
 	Data   []Embedding    `json:"data"`
 	Model  EmbeddingModel `json:"model"`
 	Usage  Usage          `json:"usage"`
+
+	ResponseMetadata
 }
 
 type EmbeddingRequestConverter interface {
@@ -134,10 +194,25 @@ type EmbeddingRequestConverter interface {
 	Convert() EmbeddingRequest
 }
 
+// EmbeddingEncodingFormat is the format of the embeddings in the response.
+type EmbeddingEncodingFormat string
+
+const (
+	// EmbeddingEncodingFormatFloat returns the embeddings as arrays of numbers, the default.
+	EmbeddingEncodingFormatFloat EmbeddingEncodingFormat = "float"
+	// EmbeddingEncodingFormatBase64 returns the embeddings as base64 strings, which are smaller
+	// and faster to decode. They are decoded into Embedding.Embedding all the same.
+	EmbeddingEncodingFormatBase64 EmbeddingEncodingFormat = "base64"
+)
+
 type EmbeddingRequest struct {
-	Input any            `json:"input"`
-	Model EmbeddingModel `json:"model"`
-	User  string         `json:"user"`
+	Input          any                     `json:"input"`
+	Model          EmbeddingModel          `json:"model"`
+	User           string                  `json:"user"`
+	EncodingFormat EmbeddingEncodingFormat `json:"encoding_format,omitempty"`
+	// Dimensions shortens the embeddings to this number of dimensions.
+	// Only supported by text-embedding-3 and later models.
+	Dimensions int `json:"dimensions,omitempty"`
 }
 
 func (r EmbeddingRequest) Convert() EmbeddingRequest {
@@ -158,13 +233,20 @@ type EmbeddingRequestStrings struct {
 	Model EmbeddingModel `json:"model"`
 	// A unique identifier representing your end-user, which will help lemur to monitor and detect abuse.
 	User string `json:"user"`
+	// EncodingFormat is the format of the embeddings in the response, see EmbeddingEncodingFormatBase64.
+	EncodingFormat EmbeddingEncodingFormat `json:"encoding_format,omitempty"`
+	// Dimensions shortens the embeddings to this number of dimensions.
+	// Only supported by text-embedding-3 and later models.
+	Dimensions int `json:"dimensions,omitempty"`
 }
 
 func (r EmbeddingRequestStrings) Convert() EmbeddingRequest {
 	return EmbeddingRequest{
-		Input: r.Input,
-		Model: r.Model,
-		User:  r.User,
+		Input:          r.Input,
+		Model:          r.Model,
+		User:           r.User,
+		EncodingFormat: r.EncodingFormat,
+		Dimensions:     r.Dimensions,
 	}
 }
 
@@ -181,13 +263,20 @@ type EmbeddingRequestTokens struct {
 	Model EmbeddingModel `json:"model"`
 	// A unique identifier representing your end-user, which will help lemur to monitor and detect abuse.
 	User string `json:"user"`
+	// EncodingFormat is the format of the embeddings in the response, see EmbeddingEncodingFormatBase64.
+	EncodingFormat EmbeddingEncodingFormat `json:"encoding_format,omitempty"`
+	// Dimensions shortens the embeddings to this number of dimensions.
+	// Only supported by text-embedding-3 and later models.
+	Dimensions int `json:"dimensions,omitempty"`
 }
 
 func (r EmbeddingRequestTokens) Convert() EmbeddingRequest {
 	return EmbeddingRequest{
-		Input: r.Input,
-		Model: r.Model,
-		User:  r.User,
+		Input:          r.Input,
+		Model:          r.Model,
+		User:           r.User,
+		EncodingFormat: r.EncodingFormat,
+		Dimensions:     r.Dimensions,
 	}
 }
 
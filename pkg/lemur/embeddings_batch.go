@@ -0,0 +1,225 @@
+package lemur
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"chatgpt-go/pkg/lemur/tokenizer"
+)
+
+const (
+	// defaultEmbeddingBatchItems is the maximum number of inputs of an embeddings request.
+	defaultEmbeddingBatchItems       = 2048
+	defaultEmbeddingBatchConcurrency = 4
+)
+
+// EmbeddingBatchOptions controls how CreateEmbeddingsBatch splits its input. The zero value uses the defaults.
+type EmbeddingBatchOptions struct {
+	// MaxItems is the maximum number of inputs per request. Defaults to 2048, the limit of the API.
+	MaxItems int
+	// MaxTokens is the maximum number of tokens of the inputs of a request. Zero means no limit.
+	// An input longer than MaxTokens is sent alone.
+	MaxTokens int
+	// Concurrency is the maximum number of requests in flight. Defaults to 4.
+	Concurrency int
+	// Retry controls how a failed request is retried. Nil retries with DefaultRetryPolicy,
+	// unless the client already retries its requests according to ClientConfig.RetryPolicy.
+	Retry *RetryPolicy
+	// CountTokens counts the tokens of an input for MaxTokens. Defaults to the tokenizer of the
+	// model, or to an estimate of one token per 3 bytes when the tokenizer isn't available.
+	CountTokens func(input string) int
+}
+
+// embeddingBatch is a part of the input of CreateEmbeddingsBatch, starting at offset.
+type embeddingBatch struct {
+	offset int
+	input  []string
+}
+
+// CreateEmbeddingsBatch creates the embeddings of any number of inputs. The input is split
+// in requests according to options, which are sent concurrently and retried when they fail.
+// The embeddings are returned in input order with their Index in the whole input, and the
+// usage is the sum of the usage of every request.
+//
+// The first request failing for good cancels the others, and its error is returned.
+func (c *Client) CreateEmbeddingsBatch(
+	ctx context.Context,
+	request EmbeddingRequestStrings,
+	options EmbeddingBatchOptions,
+) (response EmbeddingResponse, err error) {
+	response.Object = "list"
+	response.Model = request.Model
+	response.Data = make([]Embedding, len(request.Input))
+	batches := splitEmbeddingInput(request.Input, options.withDefaults(request.Model))
+	if len(batches) == 0 {
+		return response, nil
+	}
+
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultEmbeddingBatchConcurrency
+	}
+	retry := c.embeddingBatchRetry(options.Retry)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		sem = make(chan struct{}, concurrency)
+	)
+	for _, batch := range batches {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			batchRequest := request
+			batchRequest.Input = batch.input
+			res, batchErr := c.createEmbeddingsWithRetry(ctx, batchRequest, retry)
+			if batchErr == nil {
+				batchErr = placeEmbeddings(response.Data, batch, res.Data)
+			}
+			if batchErr != nil {
+				cancel(batchErr)
+				return
+			}
+			mu.Lock()
+			response.Usage.PromptTokens += res.Usage.PromptTokens
+			response.Usage.CompletionTokens += res.Usage.CompletionTokens
+			response.Usage.TotalTokens += res.Usage.TotalTokens
+			if res.Object != "" {
+				response.Object = res.Object
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if err = context.Cause(ctx); err != nil {
+		return EmbeddingResponse{}, err
+	}
+	return response, nil
+}
+
+func (o EmbeddingBatchOptions) withDefaults(model EmbeddingModel) EmbeddingBatchOptions {
+	if o.MaxItems <= 0 {
+		o.MaxItems = defaultEmbeddingBatchItems
+	}
+	if o.MaxTokens > 0 && o.CountTokens == nil {
+		o.CountTokens = estimateTokens
+		if encoding, err := tokenizer.ForModel(model.String()); err == nil {
+			o.CountTokens = encoding.Count
+		}
+	}
+	return o
+}
+
+// estimateTokens overestimates the number of tokens of s, for when no tokenizer is available.
+func estimateTokens(s string) int {
+	return (len(s) + 2) / 3
+}
+
+// splitEmbeddingInput splits input in batches of at most options.MaxItems inputs and options.MaxTokens tokens.
+func splitEmbeddingInput(input []string, options EmbeddingBatchOptions) []embeddingBatch {
+	var (
+		batches []embeddingBatch
+		start   int
+		tokens  int
+	)
+	for i, item := range input {
+		itemTokens := 0
+		if options.MaxTokens > 0 {
+			itemTokens = options.CountTokens(item)
+		}
+		full := i-start == options.MaxItems || (options.MaxTokens > 0 && tokens+itemTokens > options.MaxTokens)
+		if i > start && full {
+			batches = append(batches, embeddingBatch{offset: start, input: input[start:i]})
+			start, tokens = i, 0
+		}
+		tokens += itemTokens
+	}
+	if start < len(input) {
+		batches = append(batches, embeddingBatch{offset: start, input: input[start:]})
+	}
+	return batches
+}
+
+// placeEmbeddings stores the embeddings of batch at their place in data.
+func placeEmbeddings(data []Embedding, batch embeddingBatch, embeddings []Embedding) error {
+	if len(embeddings) != len(batch.input) {
+		return fmt.Errorf("embeddings response has %d embeddings for %d inputs", len(embeddings), len(batch.input))
+	}
+	for _, embedding := range embeddings {
+		if embedding.Index < 0 || embedding.Index >= len(batch.input) {
+			return fmt.Errorf("embeddings response has an embedding for input %d out of %d",
+				embedding.Index, len(batch.input))
+		}
+		embedding.Index += batch.offset
+		data[embedding.Index] = embedding
+	}
+	return nil
+}
+
+// embeddingBatchRetry returns the retry policy of the requests of a batch, see EmbeddingBatchOptions.Retry.
+func (c *Client) embeddingBatchRetry(retry *RetryPolicy) RetryPolicy {
+	switch {
+	case retry != nil:
+		return *retry
+	case c.config.RetryPolicy.enabled():
+		return RetryPolicy{}
+	default:
+		return DefaultRetryPolicy()
+	}
+}
+
+func (c *Client) createEmbeddingsWithRetry(
+	ctx context.Context,
+	request EmbeddingRequestStrings,
+	policy RetryPolicy,
+) (EmbeddingResponse, error) {
+	for attempt := 1; ; attempt++ {
+		response, err := c.CreateEmbeddings(ctx, request)
+		if err == nil || !policy.enabled() || attempt >= policy.MaxAttempts || !isRetryableError(ctx, err) {
+			return response, err
+		}
+		timer := time.NewTimer(policy.backoff(attempt, nil))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return response, context.Cause(ctx)
+		case <-timer.C:
+		}
+	}
+}
+
+// isRetryableError reports whether a request which failed with err may succeed if sent again.
+func isRetryableError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var (
+		apiErr     *APIError
+		requestErr *RequestError
+	)
+	switch {
+	case errors.As(err, &apiErr):
+		return isRetryableStatusCode(apiErr.HTTPStatusCode)
+	case errors.As(err, &requestErr):
+		return isRetryableStatusCode(requestErr.HTTPStatusCode)
+	default:
+		// Transport errors.
+		return true
+	}
+}
@@ -0,0 +1,156 @@
+package lemur_test
+
+import (
+	. "chatgpt-go/pkg/lemur"
+	"chatgpt-go/pkg/lemur/internal/test/checks"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// embeddingBatchServer embeds every input as a vector holding its length, returning the
+// embeddings in reverse order, and records the inputs of every request.
+type embeddingBatchServer struct {
+	mu       sync.Mutex
+	inputs   [][]string
+	inFlight atomic.Int32
+	maxSeen  atomic.Int32
+	// fail returns the status code to answer a request with, 0 for success.
+	fail func(input []string) int
+}
+
+func (s *embeddingBatchServer) handle(w http.ResponseWriter, r *http.Request) {
+	n := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	for seen := s.maxSeen.Load(); n > seen && !s.maxSeen.CompareAndSwap(seen, n); seen = s.maxSeen.Load() {
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	var request EmbeddingRequestStrings
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.inputs = append(s.inputs, request.Input)
+	s.mu.Unlock()
+	if s.fail != nil {
+		if code := s.fail(request.Input); code != 0 {
+			w.WriteHeader(code)
+			fmt.Fprint(w, `{"error":{"message":"failed","type":"server_error"}}`)
+			return
+		}
+	}
+
+	response := EmbeddingResponse{Object: "list", Usage: Usage{PromptTokens: len(request.Input), TotalTokens: len(request.Input)}}
+	for i := len(request.Input) - 1; i >= 0; i-- {
+		response.Data = append(response.Data, Embedding{
+			Object:    "embedding",
+			Embedding: []float32{float32(len(request.Input[i]))},
+			Index:     i,
+		})
+	}
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func batchTestInput(n int) []string {
+	input := make([]string, n)
+	for i := range input {
+		input[i] = strings.Repeat("word ", i+1)
+	}
+	return input
+}
+
+func TestCreateEmbeddingsBatch(t *testing.T) {
+	client, server, teardown := setuplemurTestServer()
+	defer teardown()
+	s := &embeddingBatchServer{}
+	server.RegisterHandler("/v1/embeddings", s.handle)
+
+	input := batchTestInput(10)
+	response, err := client.CreateEmbeddingsBatch(context.Background(), EmbeddingRequestStrings{
+		Input: input,
+		Model: AdaEmbeddingV2,
+	}, EmbeddingBatchOptions{
+		MaxItems:    3,
+		MaxTokens:   12,
+		Concurrency: 2,
+		CountTokens: func(input string) int { return len(strings.Fields(input)) },
+	})
+	checks.NoError(t, err, "CreateEmbeddingsBatch error")
+
+	if len(response.Data) != len(input) || response.Usage.TotalTokens != len(input) || response.Model != AdaEmbeddingV2 {
+		t.Fatalf("Unexpected response %+v", response)
+	}
+	for i, embedding := range response.Data {
+		if embedding.Index != i || embedding.Embedding[0] != float32(len(input[i])) {
+			t.Errorf("Embedding %d is out of order: %+v", i, embedding)
+		}
+	}
+
+	// 1+2+3 words, then 4+5, 6, 7, ... since 12 tokens fit at most two of the longer inputs.
+	sizes := make(map[int]int)
+	for _, batch := range s.inputs {
+		sizes[len(strings.Fields(batch[0]))] = len(batch)
+	}
+	expected := map[int]int{1: 3, 4: 2, 6: 1, 7: 1, 8: 1, 9: 1, 10: 1}
+	if fmt.Sprint(sizes) != fmt.Sprint(expected) {
+		t.Errorf("Expected batches %v, got %v", expected, sizes)
+	}
+	if s.maxSeen.Load() > 2 {
+		t.Errorf("Expected at most 2 requests in flight, got %d", s.maxSeen.Load())
+	}
+}
+
+func TestCreateEmbeddingsBatchRetry(t *testing.T) {
+	client, server, teardown := setuplemurTestServer()
+	defer teardown()
+	var failures atomic.Int32
+	s := &embeddingBatchServer{fail: func(input []string) int {
+		if input[0] == "word " && failures.Add(1) <= 2 {
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	}}
+	server.RegisterHandler("/v1/embeddings", s.handle)
+
+	retry := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	request := EmbeddingRequestStrings{Input: batchTestInput(4), Model: AdaEmbeddingV2}
+	response, err := client.CreateEmbeddingsBatch(context.Background(), request,
+		EmbeddingBatchOptions{MaxItems: 2, Retry: retry})
+	checks.NoError(t, err, "CreateEmbeddingsBatch should succeed after retries")
+	if len(response.Data) != 4 || len(s.inputs) != 4 {
+		t.Errorf("Expected 4 embeddings from 4 requests, got %d from %d", len(response.Data), len(s.inputs))
+	}
+
+	s.fail = func(input []string) int {
+		if input[0] == "word word word " {
+			return http.StatusBadRequest
+		}
+		return 0
+	}
+	_, err = client.CreateEmbeddingsBatch(context.Background(), request, EmbeddingBatchOptions{MaxItems: 2, Retry: retry})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatusCode != http.StatusBadRequest {
+		t.Errorf("Expected the error of the failed batch, got %v", err)
+	}
+}
+
+func TestCreateEmbeddingsBatchEmpty(t *testing.T) {
+	client, _, teardown := setuplemurTestServer()
+	defer teardown()
+	response, err := client.CreateEmbeddingsBatch(context.Background(),
+		EmbeddingRequestStrings{Model: AdaEmbeddingV2}, EmbeddingBatchOptions{})
+	checks.NoError(t, err, "CreateEmbeddingsBatch error")
+	if len(response.Data) != 0 {
+		t.Errorf("Unexpected response %+v", response)
+	}
+}
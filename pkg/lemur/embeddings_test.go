@@ -6,8 +6,11 @@ import (
 
 	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"testing"
 )
@@ -116,3 +119,82 @@ func TestEmbeddingEndpoint(t *testing.T) {
 	_, err = client.CreateEmbeddings(context.Background(), EmbeddingRequestTokens{})
 	checks.NoError(t, err, "CreateEmbeddings tokens error")
 }
+
+func TestEmbeddingBase64(t *testing.T) {
+	client, server, teardown := setuplemurTestServer()
+	defer teardown()
+	server.RegisterHandler(
+		"/v1/embeddings",
+		func(w http.ResponseWriter, r *http.Request) {
+			var request map[string]any
+			checks.NoError(t, json.NewDecoder(r.Body).Decode(&request), "Decode request error")
+			if request["encoding_format"] != "base64" || request["dimensions"] != 2.0 {
+				t.Errorf("Unexpected request %v", request)
+			}
+			// [1, -2.5] and [0.5, 3] as little-endian float32.
+			fmt.Fprint(w, `{"object":"list","model":"text-embedding-3-small","data":[`+
+				`{"object":"embedding","index":0,"embedding":"AACAPwAAIMA="},`+
+				`{"object":"embedding","index":1,"embedding":"AAAAPwAAQEA="}]}`)
+		},
+	)
+	res, err := client.CreateEmbeddings(context.Background(), EmbeddingRequestStrings{
+		Input:          []string{"first", "second"},
+		Model:          SmallEmbedding3,
+		EncodingFormat: EmbeddingEncodingFormatBase64,
+		Dimensions:     2,
+	})
+	checks.NoError(t, err, "CreateEmbeddings error")
+	if res.Model != SmallEmbedding3 || len(res.Data) != 2 ||
+		fmt.Sprint(res.Data[0].Embedding, res.Data[1].Embedding) != "[1 -2.5] [0.5 3]" || res.Data[1].Index != 1 {
+		t.Errorf("Unexpected response %+v", res)
+	}
+}
+
+func TestEmbeddingUnmarshalJSON(t *testing.T) {
+	var embedding Embedding
+	checks.NoError(t, json.Unmarshal([]byte(`{"object":"embedding","index":3,"embedding":[0.25,-1]}`), &embedding),
+		"Unmarshal float embedding error")
+	if embedding.Index != 3 || fmt.Sprint(embedding.Embedding) != "[0.25 -1]" {
+		t.Errorf("Unexpected embedding %+v", embedding)
+	}
+
+	// A missing embedding decodes like it did before base64 support.
+	embedding = Embedding{}
+	checks.NoError(t, json.Unmarshal([]byte(`{"object":"embedding","index":1}`), &embedding),
+		"Unmarshal without embedding error")
+	if embedding.Index != 1 || embedding.Embedding != nil {
+		t.Errorf("Unexpected embedding %+v", embedding)
+	}
+
+	for _, invalid := range []string{
+		`{"embedding":"not base64!"}`,
+		`{"embedding":"AACAPwA="}`,
+		`{"embedding":{}}`,
+	} {
+		checks.HasError(t, json.Unmarshal([]byte(invalid), &embedding), "Unmarshal should fail for "+invalid)
+	}
+}
+
+func BenchmarkEmbeddingUnmarshalJSON(b *testing.B) {
+	vector := make([]float32, 1536)
+	for i := range vector {
+		vector[i] = float32(i) / 1536
+	}
+	floats, _ := json.Marshal(Embedding{Embedding: vector})
+	raw := make([]byte, 0, 4*len(vector))
+	for _, v := range vector {
+		raw = binary.LittleEndian.AppendUint32(raw, math.Float32bits(v))
+	}
+	encoded := []byte(`{"embedding":"` + base64.StdEncoding.EncodeToString(raw) + `"}`)
+
+	for name, data := range map[string][]byte{"float": floats, "base64": encoded} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var embedding Embedding
+				if err := json.Unmarshal(data, &embedding); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
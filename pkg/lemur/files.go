@@ -24,11 +24,15 @@ type File struct {
 	Object    string `json:"object"`
 	Owner     string `json:"owner"`
 	Purpose   string `json:"purpose"`
+
+	responseMetadataRef
 }
 
 // FilesList is a list of files that belong to the user or organization.
 type FilesList struct {
 	Files []File `json:"data"`
+
+	ResponseMetadata
 }
 
 // CreateFile uploads a jsonl file to GPT3
@@ -0,0 +1,242 @@
+package lemur
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"chatgpt-go/pkg/lemur/jsonschema"
+)
+
+var (
+	ErrFunctionUnknown       = errors.New("unknown function")
+	ErrFunctionRegistered    = errors.New("function already registered")
+	ErrFunctionArgumentsType = errors.New("function arguments must be a struct")
+	ErrFunctionPanicked      = errors.New("function panicked")
+	ErrTooManyFunctionCalls  = errors.New("the model kept calling functions after the maximum number of turns")
+)
+
+// FunctionDispatcher calls Go functions on behalf of the model. Register functions with
+// RegisterFunction, send their Definitions or Tools with a chat completion request, and
+// answer the function calls of the model with Call, or let RunConversation do it all.
+// It is safe for concurrent use.
+type FunctionDispatcher struct {
+	// timeout limits the duration of a call, zero means no limit.
+	timeout time.Duration
+
+	mu        sync.RWMutex
+	functions map[string]*dispatchedFunction
+	names     []string
+}
+
+type dispatchedFunction struct {
+	definition FunctionDefinition
+	schema     jsonschema.Definition
+	call       func(ctx context.Context, arguments []byte) (any, error)
+}
+
+// NewFunctionDispatcher returns a dispatcher whose calls are canceled after timeout. Zero means no limit.
+func NewFunctionDispatcher(timeout time.Duration) *FunctionDispatcher {
+	return &FunctionDispatcher{
+		timeout:   timeout,
+		functions: make(map[string]*dispatchedFunction),
+	}
+}
+
+// RegisterFunction makes fn callable by the model under name. The parameters of the function
+// are described with jsonschema.Reflect from Args, which must be a struct; the arguments of
+// a call are checked against them before being unmarshaled into an Args. The result is sent
+// back to the model encoded as JSON.
+func RegisterFunction[Args, Result any](
+	d *FunctionDispatcher,
+	name, description string,
+	fn func(ctx context.Context, args Args) (Result, error),
+) error {
+	if !functionNamePattern.MatchString(name) {
+		return fmt.Errorf("function name %q must be 1 to 64 letters, digits, underscores or dashes", name)
+	}
+	schema, err := jsonschema.Reflect(new(Args))
+	if err != nil {
+		return err
+	}
+	if schema.Type != jsonschema.Object {
+		return fmt.Errorf("%w: %s has %T", ErrFunctionArgumentsType, name, *new(Args))
+	}
+
+	f := &dispatchedFunction{
+		definition: FunctionDefinition{Name: name, Description: description, Parameters: schema},
+		schema:     schema,
+		call: func(ctx context.Context, arguments []byte) (any, error) {
+			var args Args
+			if err := json.Unmarshal(arguments, &args); err != nil {
+				return nil, err
+			}
+			return fn(ctx, args)
+		},
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.functions[name]; ok {
+		return fmt.Errorf("%w: %s", ErrFunctionRegistered, name)
+	}
+	d.functions[name] = f
+	d.names = append(d.names, name)
+	return nil
+}
+
+// Definitions returns the definitions of the registered functions, in registration order.
+func (d *FunctionDispatcher) Definitions() []FunctionDefinition {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	definitions := make([]FunctionDefinition, len(d.names))
+	for i, name := range d.names {
+		definitions[i] = d.functions[name].definition
+	}
+	return definitions
+}
+
+// Tools returns the registered functions as tools, in registration order.
+func (d *FunctionDispatcher) Tools() []Tool {
+	definitions := d.Definitions()
+	tools := make([]Tool, len(definitions))
+	for i := range definitions {
+		tools[i] = Tool{Type: ToolTypeFunction, Function: &definitions[i]}
+	}
+	return tools
+}
+
+// Call calls the function requested by call and returns its result as a function message.
+//
+// The returned message is always meant to be sent to the model: when the function is unknown,
+// its arguments are invalid, or it fails, panics or times out, the message describes the error
+// so that the model can correct itself, and the error is also returned.
+func (d *FunctionDispatcher) Call(ctx context.Context, call FunctionCall) (ChatCompletionMessage, error) {
+	content, err := d.call(ctx, call)
+	return ChatCompletionMessage{Role: ChatMessageRoleFunction, Name: call.Name, Content: content}, err
+}
+
+// CallTool is like Call for a tool call, and returns a tool message.
+func (d *FunctionDispatcher) CallTool(ctx context.Context, call ToolCall) (ChatCompletionMessage, error) {
+	content, err := d.call(ctx, call.Function)
+	return ChatCompletionMessage{Role: ChatMessageRoleTool, ToolCallID: call.ID, Content: content}, err
+}
+
+func (d *FunctionDispatcher) call(ctx context.Context, call FunctionCall) (string, error) {
+	result, err := d.invoke(ctx, call)
+	if err != nil {
+		return errorContent(err), err
+	}
+	content, err := json.Marshal(result)
+	if err != nil {
+		err = fmt.Errorf("encoding the result of %s: %w", call.Name, err)
+		return errorContent(err), err
+	}
+	return string(content), nil
+}
+
+func (d *FunctionDispatcher) invoke(ctx context.Context, call FunctionCall) (any, error) {
+	d.mu.RLock()
+	f, ok := d.functions[call.Name]
+	d.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrFunctionUnknown, call.Name)
+	}
+
+	arguments := []byte(call.Arguments)
+	if len(arguments) == 0 {
+		arguments = []byte("{}")
+	}
+	if err := jsonschema.ValidateJSON(f.schema, arguments); err != nil {
+		return nil, fmt.Errorf("invalid arguments for %s: %w", call.Name, err)
+	}
+
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+	type outcome struct {
+		result any
+		err    error
+	}
+	// The channel is buffered so that a function returning after the timeout doesn't block forever.
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: fmt.Errorf("%w: %s: %v", ErrFunctionPanicked, call.Name, r)}
+			}
+		}()
+		result, err := f.call(ctx, arguments)
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("calling %s: %w", call.Name, ctx.Err())
+	}
+}
+
+// errorContent returns the content of a message telling the model that a call failed.
+func errorContent(err error) string {
+	content, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(content)
+}
+
+// RunConversation creates chat completions until the model answers without calling a function,
+// calling the functions it requests with dispatcher and sending their results back. Failed calls
+// are reported to the model, which may try again.
+//
+// When request has neither Functions nor Tools, the functions of dispatcher are sent as Functions.
+// The final response is returned with the messages of the whole conversation, including the
+// function calls, their results and the final answer. ErrTooManyFunctionCalls is returned when the
+// model still calls functions after maxTurns completions.
+func (c *Client) RunConversation(
+	ctx context.Context,
+	request ChatCompletionRequest,
+	dispatcher *FunctionDispatcher,
+	maxTurns int,
+) (response ChatCompletionResponse, messages []ChatCompletionMessage, err error) {
+	if len(request.Functions) == 0 && len(request.Tools) == 0 {
+		request.Functions = dispatcher.Definitions()
+	}
+	// The caller's messages must not be changed by the conversation.
+	request.Messages = slices.Clip(request.Messages)
+
+	for turn := 0; turn < maxTurns; turn++ {
+		response, err = c.CreateChatCompletion(ctx, request)
+		if err != nil {
+			return response, request.Messages, err
+		}
+		if len(response.Choices) == 0 {
+			return response, request.Messages, ErrNoChoices
+		}
+		answer := response.Choices[0].Message
+		request.Messages = append(request.Messages, answer)
+
+		switch {
+		case len(answer.ToolCalls) > 0:
+			for _, call := range answer.ToolCalls {
+				// Errors are sent to the model in the message.
+				message, _ := dispatcher.CallTool(ctx, call)
+				request.Messages = append(request.Messages, message)
+			}
+		case answer.FunctionCall != nil:
+			message, _ := dispatcher.Call(ctx, *answer.FunctionCall)
+			request.Messages = append(request.Messages, message)
+		default:
+			return response, request.Messages, nil
+		}
+		if ctx.Err() != nil {
+			return response, request.Messages, ctx.Err()
+		}
+	}
+	return response, request.Messages, ErrTooManyFunctionCalls
+}
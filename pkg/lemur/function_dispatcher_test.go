@@ -0,0 +1,187 @@
+package lemur_test
+
+import (
+	. "chatgpt-go/pkg/lemur"
+	"chatgpt-go/pkg/lemur/internal/test/checks"
+	"chatgpt-go/pkg/lemur/jsonschema"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type weatherArgs struct {
+	Location string `json:"location" description:"The city"`
+	Unit     string `json:"unit,omitempty" enum:"celsius,fahrenheit"`
+}
+
+type weatherResult struct {
+	Temperature int    `json:"temperature"`
+	Unit        string `json:"unit"`
+}
+
+func newTestDispatcher(t *testing.T, timeout time.Duration) *FunctionDispatcher {
+	t.Helper()
+	d := NewFunctionDispatcher(timeout)
+	err := RegisterFunction(d, "get_weather", "Get the current weather",
+		func(_ context.Context, args weatherArgs) (weatherResult, error) {
+			switch args.Location {
+			case "Atlantis":
+				return weatherResult{}, errors.New("no weather station")
+			case "Mordor":
+				panic("one does not simply get the weather of Mordor")
+			}
+			unit := args.Unit
+			if unit == "" {
+				unit = "celsius"
+			}
+			return weatherResult{Temperature: len(args.Location), Unit: unit}, nil
+		})
+	checks.NoError(t, err, "RegisterFunction error")
+	err = RegisterFunction(d, "sleep", "Sleep until canceled",
+		func(ctx context.Context, _ struct{}) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		})
+	checks.NoError(t, err, "RegisterFunction error")
+	return d
+}
+
+func TestRegisterFunction(t *testing.T) {
+	d := newTestDispatcher(t, 0)
+	definitions := d.Definitions()
+	if len(definitions) != 2 || definitions[0].Name != "get_weather" || definitions[1].Name != "sleep" {
+		t.Fatalf("Unexpected definitions %+v", definitions)
+	}
+	parameters, ok := definitions[0].Parameters.(jsonschema.Definition)
+	if !ok || parameters.Properties["location"].Description != "The city" ||
+		len(parameters.Required) != 1 || parameters.Required[0] != "location" {
+		t.Errorf("Unexpected parameters %+v", definitions[0].Parameters)
+	}
+	tools := d.Tools()
+	if len(tools) != 2 || tools[1].Type != ToolTypeFunction || tools[1].Function.Name != "sleep" {
+		t.Errorf("Unexpected tools %+v", tools)
+	}
+
+	noop := func(context.Context, weatherArgs) (string, error) { return "", nil }
+	checks.ErrorIs(t, RegisterFunction(d, "get_weather", "", noop), ErrFunctionRegistered, "duplicate name")
+	checks.HasError(t, RegisterFunction(d, "get weather", "", noop), "invalid name")
+	err := RegisterFunction(d, "count", "", func(context.Context, []int) (int, error) { return 0, nil })
+	checks.ErrorIs(t, err, ErrFunctionArgumentsType, "arguments which aren't a struct")
+}
+
+func TestFunctionDispatcherCall(t *testing.T) {
+	d := newTestDispatcher(t, 50*time.Millisecond)
+	ctx := context.Background()
+
+	message, err := d.Call(ctx, FunctionCall{Name: "get_weather", Arguments: `{"location":"Paris"}`})
+	checks.NoError(t, err, "Call error")
+	if message.Role != ChatMessageRoleFunction || message.Name != "get_weather" ||
+		message.Content != `{"temperature":5,"unit":"celsius"}` {
+		t.Errorf("Unexpected message %+v", message)
+	}
+
+	message, err = d.CallTool(ctx, ToolCall{
+		ID:       "call_1",
+		Type:     ToolTypeFunction,
+		Function: FunctionCall{Name: "get_weather", Arguments: `{"location":"Rome","unit":"fahrenheit"}`},
+	})
+	checks.NoError(t, err, "CallTool error")
+	if message.Role != ChatMessageRoleTool || message.ToolCallID != "call_1" ||
+		message.Content != `{"temperature":4,"unit":"fahrenheit"}` {
+		t.Errorf("Unexpected message %+v", message)
+	}
+
+	tests := []struct {
+		name    string
+		call    FunctionCall
+		target  error
+		content string
+	}{
+		{"unknown", FunctionCall{Name: "get_time"}, ErrFunctionUnknown, "unknown function: get_time"},
+		{
+			"invalid arguments",
+			FunctionCall{Name: "get_weather", Arguments: `{"unit":"kelvin"}`},
+			jsonschema.ErrSchemaMismatch,
+			"/location: required property is missing",
+		},
+		{"failure", FunctionCall{Name: "get_weather", Arguments: `{"location":"Atlantis"}`}, nil, "no weather station"},
+		{
+			"panic",
+			FunctionCall{Name: "get_weather", Arguments: `{"location":"Mordor"}`},
+			ErrFunctionPanicked,
+			"one does not simply",
+		},
+		{"timeout", FunctionCall{Name: "sleep"}, context.DeadlineExceeded, "calling sleep: context deadline exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := d.Call(ctx, tt.call)
+			checks.HasError(t, err, "Call should fail")
+			if tt.target != nil {
+				checks.ErrorIs(t, err, tt.target, "Call error")
+			}
+			var content map[string]string
+			checks.NoError(t, json.Unmarshal([]byte(message.Content), &content), "error content should be JSON")
+			if !strings.Contains(content["error"], tt.content) {
+				t.Errorf("Expected the error content to contain %q, got %s", tt.content, message.Content)
+			}
+		})
+	}
+}
+
+func TestRunConversation(t *testing.T) {
+	client, server, teardown := setuplemurTestServer()
+	defer teardown()
+	//nolint:lll
+	answers := []string{
+		`{"role":"assistant","content":null,"function_call":{"name":"get_weather","arguments":"{\"location\":\"Atlantis\"}"}}`,
+		`{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"location\":\"Paris\"}"}},{"id":"call_2","type":"function","function":{"name":"get_weather","arguments":"{\"location\":\"Oslo\"}"}}]}`,
+		`{"role":"assistant","content":"It is warmer in Paris."}`,
+	}
+	var requests []ChatCompletionRequest
+	server.RegisterHandler("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		var request ChatCompletionRequest
+		checks.NoError(t, json.NewDecoder(r.Body).Decode(&request), "Decode request error")
+		requests = append(requests, request)
+		fmt.Fprintf(w, `{"choices":[{"index":0,"message":%s}]}`, answers[len(requests)-1])
+	})
+
+	request := ChatCompletionRequest{
+		Model:    GPT3Dot5Turbo1106,
+		Messages: []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "Is it warmer in Paris or Oslo?"}},
+	}
+	response, messages, err := client.RunConversation(context.Background(), request, newTestDispatcher(t, 0), 5)
+	checks.NoError(t, err, "RunConversation error")
+
+	if response.Choices[0].Message.Content != "It is warmer in Paris." {
+		t.Errorf("Unexpected response %+v", response)
+	}
+	if len(requests) != 3 || len(requests[0].Functions) != 2 || len(request.Messages) != 1 {
+		t.Fatalf("Unexpected requests %+v", requests)
+	}
+	roles := make([]string, len(messages))
+	for i, message := range messages {
+		roles[i] = message.Role
+	}
+	if strings.Join(roles, ",") != "user,assistant,function,assistant,tool,tool,assistant" {
+		t.Errorf("Unexpected conversation roles %v", roles)
+	}
+	if !strings.Contains(messages[2].Content, "no weather station") ||
+		messages[4].ToolCallID != "call_1" || messages[4].Content != `{"temperature":5,"unit":"celsius"}` ||
+		messages[5].ToolCallID != "call_2" {
+		t.Errorf("Unexpected function results %+v", messages[2:6])
+	}
+	if len(requests[2].Messages) != 6 {
+		t.Errorf("The last request should carry the function results, got %+v", requests[2].Messages)
+	}
+
+	requests = nil
+	_, _, err = client.RunConversation(context.Background(), request, newTestDispatcher(t, 0), 1)
+	checks.ErrorIs(t, err, ErrTooManyFunctionCalls, "RunConversation should stop after maxTurns")
+}
@@ -33,6 +33,8 @@ type ImageRequest struct {
 type ImageResponse struct {
 	Created int64                    `json:"created,omitempty"`
 	Data    []ImageResponseDataInner `json:"data,omitempty"`
+
+	ResponseMetadata
 }
 
 // ImageResponseDataInner represents a response data structure for image API.
@@ -0,0 +1,121 @@
+package lemur
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// RequestFunc sends an HTTP request to the API.
+type RequestFunc func(req *http.Request) (*http.Response, error)
+
+// Interceptor wraps every HTTP call made by the client, including raw and streaming requests.
+// It receives the built request and must call next to send it, then gets the response or error.
+// Interceptors run once per attempt when retries are enabled. For streaming requests the
+// response is returned as soon as the headers arrive, before the stream is read.
+type Interceptor func(req *http.Request, next RequestFunc) (*http.Response, error)
+
+// chainInterceptors builds a RequestFunc running interceptors in order around final,
+// the first interceptor being the outermost one.
+func chainInterceptors(interceptors []Interceptor, final RequestFunc) RequestFunc {
+	next := final
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := interceptors[i], next
+		next = func(req *http.Request) (*http.Response, error) {
+			return interceptor(req, inner)
+		}
+	}
+	return next
+}
+
+// LoggingInterceptor logs every request with its method, URL, status, latency and upstream request id.
+// Headers, which carry credentials, are never logged.
+func LoggingInterceptor(logger *slog.Logger) Interceptor {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(req *http.Request, next RequestFunc) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next(req)
+		attrs := []slog.Attr{
+			slog.String("method", req.Method),
+			slog.String("url", req.URL.Redacted()),
+			slog.Duration("latency", time.Since(start)),
+		}
+		if err != nil {
+			attrs = append(attrs, slog.Any("error", err))
+			logger.LogAttrs(req.Context(), slog.LevelError, "lemur request failed", attrs...)
+			return resp, err
+		}
+
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+		if id := resp.Header.Get("x-request-id"); id != "" {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+		level := slog.LevelInfo
+		if isFailureStatusCode(resp) {
+			level = slog.LevelWarn
+		}
+		logger.LogAttrs(req.Context(), level, "lemur request", attrs...)
+		return resp, err
+	}
+}
+
+// RequestMetric describes a finished HTTP call, as reported by MetricsInterceptor.
+type RequestMetric struct {
+	Method string
+	// Path is the URL path of the request, without query string.
+	Path string
+	// StatusCode is 0 when the request failed without a response.
+	StatusCode int
+	// Latency is measured until the response headers are received.
+	Latency time.Duration
+	Err     error
+}
+
+// MetricsInterceptor reports the latency and outcome of every request to record.
+func MetricsInterceptor(record func(RequestMetric)) Interceptor {
+	return func(req *http.Request, next RequestFunc) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next(req)
+		metric := RequestMetric{
+			Method:  req.Method,
+			Path:    req.URL.Path,
+			Latency: time.Since(start),
+			Err:     err,
+		}
+		if resp != nil {
+			metric.StatusCode = resp.StatusCode
+		}
+		record(metric)
+		return resp, err
+	}
+}
+
+// RequestIDHeader is the header used to propagate request ids to the API.
+const RequestIDHeader = "X-Request-Id"
+
+type requestIDContextKey struct{}
+
+// WithRequestID returns a context carrying the request id sent by RequestIDInterceptor.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestIDFromContext returns the request id stored by WithRequestID.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDContextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// RequestIDInterceptor sets RequestIDHeader from the request id found in the request context.
+// Requests whose context has no request id are sent unchanged.
+func RequestIDInterceptor() Interceptor {
+	return func(req *http.Request, next RequestFunc) (*http.Response, error) {
+		if id, ok := RequestIDFromContext(req.Context()); ok {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		return next(req)
+	}
+}
@@ -0,0 +1,140 @@
+package lemur_test
+
+import (
+	. "chatgpt-go/pkg/lemur"
+	"chatgpt-go/pkg/lemur/internal/test"
+	"chatgpt-go/pkg/lemur/internal/test/checks"
+
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func setupInterceptorTestServer(interceptors ...Interceptor) (client *Client, server *test.ServerTest, teardown func()) {
+	server = test.NewTestServer()
+	ts := server.LemurTestServer()
+	ts.Start()
+	teardown = ts.Close
+	config := DefaultConfig(test.GetTestToken())
+	config.BaseURL = ts.URL + "/v1"
+	config.Interceptors = interceptors
+	client = NewClientWithConfig(config)
+	return
+}
+
+func TestInterceptorsRunInOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) Interceptor {
+		return func(req *http.Request, next RequestFunc) (*http.Response, error) {
+			calls = append(calls, name+" before")
+			resp, err := next(req)
+			calls = append(calls, name+" after")
+			return resp, err
+		}
+	}
+
+	client, server, teardown := setupInterceptorTestServer(record("outer"), record("inner"))
+	defer teardown()
+	server.RegisterHandler("/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"data":[]}`)
+	})
+
+	_, err := client.ListModels(context.Background())
+	checks.NoError(t, err, "ListModels error")
+
+	expected := "outer before,inner before,inner after,outer after"
+	if got := strings.Join(calls, ","); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestInterceptorsWrapAllRequestKinds(t *testing.T) {
+	var paths []string
+	client, server, teardown := setupInterceptorTestServer(MetricsInterceptor(func(m RequestMetric) {
+		checks.NoError(t, m.Err, "request error")
+		if m.StatusCode != http.StatusOK {
+			t.Errorf("Unexpected status code %d for %s", m.StatusCode, m.Path)
+		}
+		paths = append(paths, m.Method+" "+m.Path)
+	}))
+	defer teardown()
+
+	server.RegisterHandler("/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"data":[]}`)
+	})
+	server.RegisterHandler("/v1/files/deadbeef/content", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "content")
+	})
+	server.RegisterHandler("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: [DONE]\n\n")
+	})
+
+	_, err := client.ListModels(context.Background())
+	checks.NoError(t, err, "ListModels error")
+
+	content, err := client.GetFileContent(context.Background(), "deadbeef")
+	checks.NoError(t, err, "GetFileContent error")
+	content.Close()
+
+	stream, err := client.CreateChatCompletionStream(context.Background(), ChatCompletionRequest{
+		Model:    GPT3Dot5Turbo,
+		Messages: []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "Hello!"}},
+	})
+	checks.NoError(t, err, "CreateChatCompletionStream error")
+	stream.Close()
+
+	expected := "GET /v1/models,GET /v1/files/deadbeef/content,POST /v1/chat/completions"
+	if got := strings.Join(paths, ","); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestLoggingInterceptor(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	client, server, teardown := setupInterceptorTestServer(LoggingInterceptor(logger))
+	defer teardown()
+	server.RegisterHandler("/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-request-id", "req_123")
+		_, _ = io.WriteString(w, `{"data":[]}`)
+	})
+
+	_, err := client.ListModels(context.Background())
+	checks.NoError(t, err, "ListModels error")
+
+	var entry map[string]any
+	checks.NoError(t, json.Unmarshal(buf.Bytes(), &entry), "log entry is not JSON")
+	if entry["method"] != http.MethodGet || entry["status"] != float64(http.StatusOK) || entry["request_id"] != "req_123" {
+		t.Errorf("Unexpected log entry: %s", buf.String())
+	}
+	if strings.Contains(buf.String(), test.GetTestToken()) {
+		t.Errorf("Log entry leaks the API token: %s", buf.String())
+	}
+}
+
+func TestRequestIDInterceptor(t *testing.T) {
+	client, server, teardown := setupInterceptorTestServer(RequestIDInterceptor())
+	defer teardown()
+
+	var got []string
+	server.RegisterHandler("/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get(RequestIDHeader))
+		_, _ = io.WriteString(w, `{"data":[]}`)
+	})
+
+	_, err := client.ListModels(WithRequestID(context.Background(), "trace-1"))
+	checks.NoError(t, err, "ListModels error")
+	_, err = client.ListModels(context.Background())
+	checks.NoError(t, err, "ListModels error")
+
+	if len(got) != 2 || got[0] != "trace-1" || got[1] != "" {
+		t.Errorf("Unexpected request ids: %q", got)
+	}
+}
@@ -1,5 +1,6 @@
 // Package jsonschema provides very simple functionality for representing a JSON schema as a
-// (nested) struct. This struct can be used with the chat completion "function call" feature.
+// (nested) struct. This struct can be used with the chat completion "function call" feature,
+// and can be generated from a Go type with Reflect.
 // For more complicated schemas, it is recommended to use a dedicated JSON schema library
 // and/or pass in the schema in []byte format.
 package jsonschema
@@ -34,9 +35,25 @@ type Definition struct {
 	Required []string `json:"required,omitempty"`
 	// Items specifies which data type an array contains, if the schema type is Array.
 	Items *Definition `json:"items,omitempty"`
+	// AdditionalProperties describes the properties of an object which aren't in Properties.
+	// It is either a bool allowing or forbidding them, or a Definition they must match.
+	// Nil allows any additional property.
+	AdditionalProperties any `json:"additionalProperties,omitempty"`
+	// Format gives the semantic of a string, such as "date-time".
+	Format string `json:"format,omitempty"`
+	// Ref is a reference to another schema, like "#/$defs/Node" or "#" for the root schema.
+	// The other keywords are ignored when it is set.
+	Ref string `json:"$ref,omitempty"`
+	// Defs holds the schemas referenced by Ref, in the root schema.
+	Defs map[string]Definition `json:"$defs,omitempty"`
 }
 
 func (d Definition) MarshalJSON() ([]byte, error) {
+	if d.Ref != "" {
+		return json.Marshal(struct {
+			Ref string `json:"$ref"`
+		}{d.Ref})
+	}
 	if d.Properties == nil {
 		d.Properties = make(map[string]Definition)
 	}
@@ -0,0 +1,231 @@
+package jsonschema
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	rawMessageType    = reflect.TypeFor[json.RawMessage]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// Reflect returns the schema of the JSON encoding of v, which is usually a struct.
+//
+// Properties are named after the json tags of the fields, and fields are required unless
+// their json tag has the omitempty option. These tags of the fields are also read:
+//
+//	description:"The city, e.g. San Francisco"
+//	enum:"celsius,fahrenheit"
+//	required:"false"
+//
+// Struct types which contain themselves are described once in the $defs of the root schema
+// and referenced with $ref. Types implementing json.Marshaler, other than time.Time, can't be
+// described and accept any value; types which can't be encoded as JSON are an error.
+func Reflect(v any) (Definition, error) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return Definition{}, fmt.Errorf("jsonschema: can't reflect nil")
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	r := reflector{
+		root:      t,
+		building:  make(map[reflect.Type]bool),
+		recursive: make(map[reflect.Type]bool),
+		names:     make(map[reflect.Type]string),
+		defs:      make(map[string]Definition),
+	}
+	def, err := r.reflect(t)
+	if err != nil {
+		return Definition{}, err
+	}
+	if len(r.defs) > 0 {
+		def.Defs = r.defs
+	}
+	return def, nil
+}
+
+type reflector struct {
+	root reflect.Type
+	// building holds the struct types being described, to detect recursion.
+	building map[reflect.Type]bool
+	// recursive holds the struct types found to contain themselves.
+	recursive map[reflect.Type]bool
+	names     map[reflect.Type]string
+	defs      map[string]Definition
+}
+
+func (r *reflector) reflect(t reflect.Type) (Definition, error) {
+	switch t {
+	case timeType:
+		return Definition{Type: String, Format: "date-time"}, nil
+	case rawMessageType:
+		return Definition{}, nil
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType) {
+		return Definition{}, nil
+	}
+	if t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+		return Definition{Type: String}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return Definition{Type: Boolean}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return Definition{Type: Integer}, nil
+	case reflect.Float32, reflect.Float64:
+		return Definition{Type: Number}, nil
+	case reflect.String:
+		return Definition{Type: String}, nil
+	case reflect.Interface:
+		return Definition{}, nil
+	case reflect.Pointer:
+		return r.reflect(t.Elem())
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json encodes []byte as a base64 string.
+			return Definition{Type: String}, nil
+		}
+		items, err := r.reflect(t.Elem())
+		if err != nil {
+			return Definition{}, err
+		}
+		return Definition{Type: Array, Items: &items}, nil
+	case reflect.Map:
+		switch t.Key().Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		default:
+			return Definition{}, fmt.Errorf("jsonschema: unsupported map key type %s", t.Key())
+		}
+		values, err := r.reflect(t.Elem())
+		if err != nil {
+			return Definition{}, err
+		}
+		return Definition{Type: Object, AdditionalProperties: values}, nil
+	case reflect.Struct:
+		return r.reflectStruct(t)
+	default:
+		return Definition{}, fmt.Errorf("jsonschema: unsupported type %s", t)
+	}
+}
+
+func (r *reflector) reflectStruct(t reflect.Type) (Definition, error) {
+	if t == r.root && r.building[t] {
+		return Definition{Ref: "#"}, nil
+	}
+	if name, ok := r.names[t]; ok {
+		return Definition{Ref: "#/$defs/" + name}, nil
+	}
+	if r.building[t] {
+		r.recursive[t] = true
+		return Definition{Ref: "#/$defs/" + r.name(t)}, nil
+	}
+
+	r.building[t] = true
+	def := Definition{Type: Object, Properties: make(map[string]Definition)}
+	err := r.addFields(&def, t)
+	r.building[t] = false
+	if err != nil {
+		return Definition{}, err
+	}
+
+	if t != r.root && r.recursive[t] {
+		name := r.name(t)
+		r.defs[name] = def
+		return Definition{Ref: "#/$defs/" + name}, nil
+	}
+	return def, nil
+}
+
+// name returns the name of t in $defs, and records it so that t is referenced everywhere.
+func (r *reflector) name(t reflect.Type) string {
+	if name, ok := r.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	for other, otherName := range r.names {
+		if otherName == name && other != t {
+			name = strings.ReplaceAll(t.PkgPath(), "/", ".") + "." + name
+			break
+		}
+	}
+	r.names[t] = name
+	return name
+}
+
+// addFields adds the fields of the struct type t to def, flattening embedded structs like encoding/json.
+func (r *reflector) addFields(def *Definition, t reflect.Type) error {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		if field.Anonymous && name == "" {
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				if err := r.addFields(def, fieldType); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property, err := r.reflect(field.Type)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", t, field.Name, err)
+		}
+		if hasOption(options, "string") {
+			property = Definition{Type: String}
+		}
+		if description := field.Tag.Get("description"); description != "" && property.Ref == "" {
+			property.Description = description
+		}
+		if enum := field.Tag.Get("enum"); enum != "" && property.Ref == "" {
+			property.Enum = strings.Split(enum, ",")
+		}
+		def.Properties[name] = property
+
+		required := !hasOption(options, "omitempty")
+		if tag := field.Tag.Get("required"); tag != "" {
+			required = tag == "true"
+		}
+		if required {
+			def.Required = append(def.Required, name)
+		}
+	}
+	return nil
+}
+
+func hasOption(options, option string) bool {
+	for options != "" {
+		var current string
+		current, options, _ = strings.Cut(options, ",")
+		if current == option {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package jsonschema_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	. "chatgpt-go/pkg/lemur/jsonschema"
+)
+
+type Address struct {
+	City    string `json:"city" description:"The city, e.g. San Francisco"`
+	Country string `json:"country,omitempty"`
+}
+
+type Audit struct {
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type weatherRequest struct {
+	Audit
+	Location *Address           `json:"location"`
+	Unit     string             `json:"unit" enum:"celsius,fahrenheit"`
+	Days     int                `json:"days,omitempty" required:"true"`
+	Hourly   bool               `json:"hourly" required:"false"`
+	Tags     []string           `json:"tags,omitempty"`
+	Extra    map[string]float64 `json:"extra,omitempty"`
+	Raw      json.RawMessage    `json:"raw,omitempty"`
+	ID       int64              `json:"id,string"`
+	Ignored  string             `json:"-"`
+	internal string
+}
+
+type Node struct {
+	Value    string  `json:"value"`
+	Children []*Node `json:"children,omitempty"`
+}
+
+type Tree struct {
+	Root  *Node `json:"root"`
+	Other Node  `json:"other"`
+}
+
+type Category struct {
+	Name   string     `json:"name"`
+	Parent *Category  `json:"parent,omitempty"`
+	Items  []Category `json:"items,omitempty"`
+}
+
+func TestReflect(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{
+			name: "struct",
+			v:    &weatherRequest{},
+			want: `{
+				"type":"object",
+				"properties":{
+					"created_at":{"type":"string","format":"date-time","properties":{}},
+					"location":{
+						"type":"object",
+						"properties":{
+							"city":{"type":"string","description":"The city, e.g. San Francisco","properties":{}},
+							"country":{"type":"string","properties":{}}
+						},
+						"required":["city"]
+					},
+					"unit":{"type":"string","enum":["celsius","fahrenheit"],"properties":{}},
+					"days":{"type":"integer","properties":{}},
+					"hourly":{"type":"boolean","properties":{}},
+					"tags":{"type":"array","items":{"type":"string","properties":{}},"properties":{}},
+					"extra":{"type":"object","additionalProperties":{"type":"number","properties":{}},"properties":{}},
+					"raw":{"properties":{}},
+					"id":{"type":"string","properties":{}}
+				},
+				"required":["created_at","location","unit","days","id"]
+			}`,
+		},
+		{
+			name: "recursion",
+			v:    Tree{},
+			want: `{
+				"type":"object",
+				"properties":{
+					"root":{"$ref":"#/$defs/Node"},
+					"other":{"$ref":"#/$defs/Node"}
+				},
+				"required":["root","other"],
+				"$defs":{
+					"Node":{
+						"type":"object",
+						"properties":{
+							"value":{"type":"string","properties":{}},
+							"children":{"type":"array","items":{"$ref":"#/$defs/Node"},"properties":{}}
+						},
+						"required":["value"]
+					}
+				}
+			}`,
+		},
+		{
+			name: "root recursion",
+			v:    Category{},
+			want: `{
+				"type":"object",
+				"properties":{
+					"name":{"type":"string","properties":{}},
+					"parent":{"$ref":"#"},
+					"items":{"type":"array","items":{"$ref":"#"},"properties":{}}
+				},
+				"required":["name"]
+			}`,
+		},
+		{
+			name: "slice",
+			v:    [][]byte{},
+			want: `{"type":"array","items":{"type":"string","properties":{}},"properties":{}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def, err := Reflect(tt.v)
+			if err != nil {
+				t.Fatalf("Reflect error: %v", err)
+			}
+			var want map[string]any
+			if err = json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatalf("Failed to Unmarshal JSON: error = %v", err)
+			}
+			if got := structToMap(t, def); !reflect.DeepEqual(got, want) {
+				gotBytes, _ := json.Marshal(def)
+				t.Errorf("Reflect() got = %s, want %s", gotBytes, tt.want)
+			}
+		})
+	}
+}
+
+func TestReflectUnsupported(t *testing.T) {
+	type withChannel struct {
+		Events chan string `json:"events"`
+	}
+	for _, v := range []any{nil, withChannel{}, map[bool]string{}, func() {}} {
+		if _, err := Reflect(v); err == nil {
+			t.Errorf("Reflect(%T) should fail", v)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSchemaMismatch is matched by the ValidationErrors of a document which doesn't match its schema.
+var ErrSchemaMismatch = errors.New("data does not match the schema")
+
+// ValidationError is a place where a document doesn't match its schema.
+type ValidationError struct {
+	// Path is the JSON pointer (RFC 6901) of the invalid value, "" for the whole document.
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return "(root): " + e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors lists every place where a document doesn't match its schema.
+// Its message is meant to be sent back to the model so that it can correct its answer.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return ErrSchemaMismatch.Error() + ": " + strings.Join(messages, "; ")
+}
+
+func (e ValidationErrors) Is(target error) bool {
+	return target == ErrSchemaMismatch
+}
+
+// VerifySchemaAndUnmarshal checks that content is a JSON document matching schema, then unmarshals it into v.
+// A document which doesn't match is reported with ValidationErrors.
+func VerifySchemaAndUnmarshal(schema Definition, content []byte, v any) error {
+	if err := ValidateJSON(schema, content); err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+// ValidateJSON checks that content, such as the arguments of a function call, is a JSON document
+// matching schema. It returns the syntax error of an invalid document, or ValidationErrors.
+func ValidateJSON(schema Definition, content []byte) error {
+	var data any
+	if err := json.Unmarshal(content, &data); err != nil {
+		return err
+	}
+	if errs := Check(schema, data); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Validate reports whether data, as decoded by encoding/json into an any, matches schema.
+func Validate(schema Definition, data any) bool {
+	return len(Check(schema, data)) == 0
+}
+
+// Check returns the places where data, as decoded by encoding/json into an any, doesn't match schema.
+// The types, enums, required and additional properties and array items are checked, as well as the
+// "date-time" format. References are resolved in the $defs of schema.
+func Check(schema Definition, data any) ValidationErrors {
+	c := checker{root: &schema}
+	c.check(&schema, data, "")
+	return c.errs
+}
+
+type checker struct {
+	root *Definition
+	errs ValidationErrors
+}
+
+func (c *checker) addf(path, format string, args ...any) {
+	c.errs = append(c.errs, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// resolve returns the schema referenced by ref.
+func (c *checker) resolve(ref string) (*Definition, bool) {
+	if ref == "#" {
+		return c.root, true
+	}
+	name, ok := strings.CutPrefix(ref, "#/$defs/")
+	if !ok {
+		return nil, false
+	}
+	def, ok := c.root.Defs[name]
+	return &def, ok
+}
+
+func (c *checker) check(schema *Definition, data any, path string) {
+	if schema.Ref != "" {
+		resolved, ok := c.resolve(schema.Ref)
+		if !ok {
+			c.addf(path, "unresolved reference %s", schema.Ref)
+			return
+		}
+		schema = resolved
+	}
+	if schema.Type != "" && !hasType(schema.Type, data) {
+		c.addf(path, "expected %s, got %s", schema.Type, typeOf(data))
+		return
+	}
+	if len(schema.Enum) > 0 {
+		// Values other than strings match the enum by their JSON encoding.
+		value, ok := data.(string)
+		if !ok {
+			value = compact(data)
+		}
+		if !slices.Contains(schema.Enum, value) {
+			c.addf(path, "%s is not one of %s", compact(data), strings.Join(schema.Enum, ", "))
+		}
+	}
+	if schema.Format == "date-time" {
+		if s, ok := data.(string); ok {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				c.addf(path, "%q is not a RFC 3339 date-time", s)
+			}
+		}
+	}
+
+	switch data := data.(type) {
+	case map[string]any:
+		c.checkObject(schema, data, path)
+	case []any:
+		if schema.Items != nil {
+			for i, item := range data {
+				c.check(schema.Items, item, path+"/"+strconv.Itoa(i))
+			}
+		}
+	}
+}
+
+func (c *checker) checkObject(schema *Definition, object map[string]any, path string) {
+	for _, name := range schema.Required {
+		if _, ok := object[name]; !ok {
+			c.addf(path+"/"+escape(name), "required property is missing")
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		value, propertyPath := object[name], path+"/"+escape(name)
+		if property, ok := schema.Properties[name]; ok {
+			c.check(&property, value, propertyPath)
+			continue
+		}
+		switch additional := schema.AdditionalProperties.(type) {
+		case bool:
+			if !additional {
+				c.addf(propertyPath, "additional property is not allowed")
+			}
+		case Definition:
+			c.check(&additional, value, propertyPath)
+		case *Definition:
+			c.check(additional, value, propertyPath)
+		}
+	}
+}
+
+func hasType(t DataType, data any) bool {
+	switch t {
+	case Object:
+		_, ok := data.(map[string]any)
+		return ok
+	case Array:
+		_, ok := data.([]any)
+		return ok
+	case String:
+		_, ok := data.(string)
+		return ok
+	case Number:
+		_, ok := number(data)
+		return ok
+	case Integer:
+		n, ok := number(data)
+		return ok && n == math.Trunc(n)
+	case Boolean:
+		_, ok := data.(bool)
+		return ok
+	case Null:
+		return data == nil
+	default:
+		return true
+	}
+}
+
+// number returns the value of a number decoded as a float64, or as a json.Number with UseNumber.
+func number(data any) (float64, bool) {
+	switch n := data.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func typeOf(data any) DataType {
+	switch data.(type) {
+	case map[string]any:
+		return Object
+	case []any:
+		return Array
+	case string:
+		return String
+	case float64, json.Number:
+		return Number
+	case bool:
+		return Boolean
+	case nil:
+		return Null
+	default:
+		return DataType(fmt.Sprintf("%T", data))
+	}
+}
+
+// compact returns the JSON encoding of data for error messages.
+func compact(data any) string {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Sprint(data)
+	}
+	return string(encoded)
+}
+
+// escape escapes a property name for a JSON pointer.
+func escape(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
@@ -0,0 +1,126 @@
+package jsonschema_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "chatgpt-go/pkg/lemur/jsonschema"
+)
+
+func TestVerifySchemaAndUnmarshal(t *testing.T) {
+	schema := Definition{
+		Type: Object,
+		Properties: map[string]Definition{
+			"unit":  {Type: String, Enum: []string{"celsius", "fahrenheit"}},
+			"days":  {Type: Integer},
+			"temps": {Type: Array, Items: &Definition{Type: Number}},
+			"rainy": {Type: Boolean},
+			"note":  {Type: Null},
+		},
+		Required: []string{"unit", "days"},
+	}
+	tests := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{"valid", `{"unit":"celsius","days":2,"temps":[20.5,18],"rainy":false,"note":null}`, true},
+		{"extra property", `{"unit":"celsius","days":2,"wind":"strong"}`, true},
+		{"missing required", `{"unit":"celsius"}`, false},
+		{"not in enum", `{"unit":"kelvin","days":2}`, false},
+		{"fractional integer", `{"unit":"celsius","days":2.5}`, false},
+		{"wrong item type", `{"unit":"celsius","days":2,"temps":["warm"]}`, false},
+		{"wrong boolean", `{"unit":"celsius","days":2,"rainy":"no"}`, false},
+		{"not null", `{"unit":"celsius","days":2,"note":"hi"}`, false},
+		{"not an object", `["celsius"]`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v map[string]any
+			err := VerifySchemaAndUnmarshal(schema, []byte(tt.content), &v)
+			switch {
+			case tt.valid && err != nil:
+				t.Errorf("Unexpected error %v", err)
+			case tt.valid && v["unit"] != "celsius":
+				t.Errorf("Unexpected unmarshaled value %v", v)
+			case !tt.valid && !errors.Is(err, ErrSchemaMismatch):
+				t.Errorf("Expected ErrSchemaMismatch, got %v", err)
+			}
+		})
+	}
+
+	var v any
+	if err := VerifySchemaAndUnmarshal(schema, []byte(`{"unit":`), &v); err == nil || errors.Is(err, ErrSchemaMismatch) {
+		t.Errorf("Expected a syntax error, got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	schema := Definition{
+		Type: Object,
+		Properties: map[string]Definition{
+			"location": {
+				Type: Object,
+				Properties: map[string]Definition{
+					"city": {Type: String},
+				},
+				Required:             []string{"city"},
+				AdditionalProperties: false,
+			},
+			"unit":    {Type: String, Enum: []string{"celsius", "fahrenheit"}},
+			"days":    {Type: Integer, Enum: []string{"1", "7"}},
+			"from":    {Type: String, Format: "date-time"},
+			"stops":   {Type: Array, Items: &Definition{Ref: "#/$defs/Stop"}},
+			"parent":  {Ref: "#"},
+			"unknown": {Ref: "#/$defs/Missing"},
+		},
+		Required:             []string{"location", "unit"},
+		AdditionalProperties: Definition{Type: Number},
+		Defs: map[string]Definition{
+			"Stop": {
+				Type:       Object,
+				Properties: map[string]Definition{"name": {Type: String}},
+				Required:   []string{"name"},
+			},
+		},
+	}
+
+	valid := `{"location":{"city":"Paris"},"unit":"celsius","days":7,"from":"2023-11-06T10:00:00Z",` +
+		`"stops":[{"name":"Lyon"}],"parent":{"location":{"city":"Nice"},"unit":"celsius"},"wind":12.5}`
+	if err := ValidateJSON(schema, []byte(valid)); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	invalid := `{"location":{"country":"FR","a/b":1},"unit":"kelvin","days":3,"from":"yesterday",` +
+		`"stops":[{"name":"Lyon"},{}],"parent":{"unit":"celsius"},"unknown":1,"wind":"strong"}`
+	err := ValidateJSON(schema, []byte(invalid))
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || !errors.Is(err, ErrSchemaMismatch) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+	expected := ValidationErrors{
+		{"/days", "3 is not one of 1, 7"},
+		{"/from", `"yesterday" is not a RFC 3339 date-time`},
+		{"/location/city", "required property is missing"},
+		{"/location/a~1b", "additional property is not allowed"},
+		{"/location/country", "additional property is not allowed"},
+		{"/parent/location", "required property is missing"},
+		{"/stops/1/name", "required property is missing"},
+		{"/unit", `"kelvin" is not one of celsius, fahrenheit`},
+		{"/unknown", "unresolved reference #/$defs/Missing"},
+		{"/wind", "expected number, got string"},
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Unexpected errors:\n%v\nexpected:\n%v", errs, expected)
+	}
+
+	errs = Check(Definition{Type: Array}, map[string]any{})
+	if len(errs) != 1 || errs[0].Error() != "(root): expected array, got object" {
+		t.Errorf("Unexpected root errors %v", errs)
+	}
+	if !strings.HasPrefix(err.Error(), "data does not match the schema: /days: 3 is not one of") {
+		t.Errorf("Unexpected message %q", err.Error())
+	}
+}
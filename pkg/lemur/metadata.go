@@ -0,0 +1,116 @@
+package lemur
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ResponseMetadata carries information about the HTTP response a result was decoded from.
+// It is embedded in the response types and in streams. Engine, File, FineTune, Model and
+// FineTuneDeleteResponse must stay comparable, so they return it from their Metadata method instead.
+type ResponseMetadata struct {
+	header  http.Header
+	latency time.Duration
+}
+
+func (m *ResponseMetadata) metadata() *ResponseMetadata {
+	return m
+}
+
+func (m *ResponseMetadata) setMetadata(header http.Header, latency time.Duration) {
+	m.header = header
+	m.latency = latency
+}
+
+// responseMetadataRef holds the metadata of a response by pointer, so that the types embedding it
+// stay comparable and elements of lists, which have no response of their own, only carry a nil pointer.
+type responseMetadataRef struct {
+	ref *ResponseMetadata
+}
+
+func (r *responseMetadataRef) metadata() *ResponseMetadata {
+	r.ref = &ResponseMetadata{}
+	return r.ref
+}
+
+// Metadata returns the metadata of the response the value was decoded from. It is empty for
+// elements of lists, whose metadata is the one of the list.
+func (r responseMetadataRef) Metadata() ResponseMetadata {
+	if r.ref == nil {
+		return ResponseMetadata{}
+	}
+	return *r.ref
+}
+
+// Header returns the HTTP headers of the response.
+func (m ResponseMetadata) Header() http.Header {
+	if m.header == nil {
+		return http.Header{}
+	}
+	return m.header
+}
+
+// RequestID returns the x-request-id header of the response.
+func (m ResponseMetadata) RequestID() string {
+	return m.header.Get("x-request-id")
+}
+
+// ProcessingTime returns the time the API spent on the request, from the openai-processing-ms header.
+func (m ResponseMetadata) ProcessingTime() time.Duration {
+	ms, err := strconv.ParseFloat(m.header.Get("openai-processing-ms"), 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// Latency returns the time elapsed between sending the request and receiving the
+// response headers, including retries.
+func (m ResponseMetadata) Latency() time.Duration {
+	return m.latency
+}
+
+// RateLimit returns the rate limits reported by the x-ratelimit-* headers.
+func (m ResponseMetadata) RateLimit() RateLimitHeaders {
+	return newRateLimitHeaders(m.header)
+}
+
+// RateLimitHeaders holds the rate limits reported by the API.
+// Fields are zero when the corresponding header is missing or malformed.
+type RateLimitHeaders struct {
+	LimitRequests     int
+	LimitTokens       int
+	RemainingRequests int
+	RemainingTokens   int
+	// ResetRequests and ResetTokens are the durations after which the limits are fully replenished.
+	ResetRequests time.Duration
+	ResetTokens   time.Duration
+}
+
+func newRateLimitHeaders(h http.Header) RateLimitHeaders {
+	return RateLimitHeaders{
+		LimitRequests:     headerInt(h, "x-ratelimit-limit-requests"),
+		LimitTokens:       headerInt(h, "x-ratelimit-limit-tokens"),
+		RemainingRequests: headerInt(h, "x-ratelimit-remaining-requests"),
+		RemainingTokens:   headerInt(h, "x-ratelimit-remaining-tokens"),
+		ResetRequests:     headerDuration(h, "x-ratelimit-reset-requests"),
+		ResetTokens:       headerDuration(h, "x-ratelimit-reset-tokens"),
+	}
+}
+
+func headerInt(h http.Header, key string) int {
+	v, err := strconv.Atoi(h.Get(key))
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+func headerDuration(h http.Header, key string) time.Duration {
+	v, err := time.ParseDuration(h.Get(key))
+	if err != nil {
+		return 0
+	}
+	return v
+}
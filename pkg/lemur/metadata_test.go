@@ -0,0 +1,147 @@
+package lemur_test
+
+import (
+	. "chatgpt-go/pkg/lemur"
+	"chatgpt-go/pkg/lemur/internal/test/checks"
+
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func setRateLimitTestHeaders(h http.Header) {
+	h.Set("x-request-id", "req_abc")
+	h.Set("openai-processing-ms", "42")
+	h.Set("x-ratelimit-limit-requests", "3500")
+	h.Set("x-ratelimit-limit-tokens", "90000")
+	h.Set("x-ratelimit-remaining-requests", "3499")
+	h.Set("x-ratelimit-remaining-tokens", "89970")
+	h.Set("x-ratelimit-reset-requests", "17ms")
+	h.Set("x-ratelimit-reset-tokens", "1m20s")
+}
+
+func checkRateLimitTestMetadata(t *testing.T, metadata ResponseMetadata) {
+	t.Helper()
+	if metadata.RequestID() != "req_abc" {
+		t.Errorf("Unexpected request id %q", metadata.RequestID())
+	}
+	if metadata.ProcessingTime() != 42*time.Millisecond {
+		t.Errorf("Unexpected processing time %s", metadata.ProcessingTime())
+	}
+	if metadata.Latency() <= 0 {
+		t.Errorf("Latency was not recorded")
+	}
+	expected := RateLimitHeaders{
+		LimitRequests:     3500,
+		LimitTokens:       90000,
+		RemainingRequests: 3499,
+		RemainingTokens:   89970,
+		ResetRequests:     17 * time.Millisecond,
+		ResetTokens:       80 * time.Second,
+	}
+	if got := metadata.RateLimit(); got != expected {
+		t.Errorf("Expected rate limits %+v, got %+v", expected, got)
+	}
+}
+
+func TestResponseMetadata(t *testing.T) {
+	client, server, teardown := setuplemurTestServer()
+	defer teardown()
+	server.RegisterHandler("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		setRateLimitTestHeaders(w.Header())
+		_, _ = io.WriteString(w, `{"id":"1","object":"chat.completion","choices":[]}`)
+	})
+
+	resp, err := client.CreateChatCompletion(context.Background(), ChatCompletionRequest{
+		Model:    GPT3Dot5Turbo,
+		Messages: []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "Hello!"}},
+	})
+	checks.NoError(t, err, "CreateChatCompletion error")
+	checkRateLimitTestMetadata(t, resp.ResponseMetadata)
+	if resp.Header().Get("x-request-id") != "req_abc" {
+		t.Errorf("Header() does not expose response headers")
+	}
+}
+
+func TestStreamResponseMetadata(t *testing.T) {
+	client, server, teardown := setuplemurTestServer()
+	defer teardown()
+	server.RegisterHandler("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		setRateLimitTestHeaders(w.Header())
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: [DONE]\n\n")
+	})
+
+	stream, err := client.CreateChatCompletionStream(context.Background(), ChatCompletionRequest{
+		Model:    GPT3Dot5Turbo,
+		Messages: []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "Hello!"}},
+	})
+	checks.NoError(t, err, "CreateChatCompletionStream error")
+	defer stream.Close()
+	checkRateLimitTestMetadata(t, stream.ResponseMetadata)
+}
+
+func TestResponseMetadataMissingHeaders(t *testing.T) {
+	var metadata ResponseMetadata
+	if metadata.RequestID() != "" || metadata.ProcessingTime() != 0 || metadata.RateLimit() != (RateLimitHeaders{}) {
+		t.Errorf("Zero metadata should report empty values")
+	}
+	if metadata.Header() == nil {
+		t.Errorf("Header() should never return nil")
+	}
+}
+
+func TestListElementMetadata(t *testing.T) {
+	client, server, teardown := setuplemurTestServer()
+	defer teardown()
+	for path, body := range map[string]string{
+		"/v1/engines/e":    `{"id":"e"}`,
+		"/v1/models/m":     `{"id":"m"}`,
+		"/v1/files/f":      `{"id":"f"}`,
+		"/v1/fine-tunes/t": `{"id":"t","deleted":true}`,
+	} {
+		server.RegisterHandler(path, func(w http.ResponseWriter, r *http.Request) {
+			setRateLimitTestHeaders(w.Header())
+			_, _ = io.WriteString(w, body)
+		})
+	}
+	server.RegisterHandler("/v1/engines", func(w http.ResponseWriter, r *http.Request) {
+		setRateLimitTestHeaders(w.Header())
+		_, _ = io.WriteString(w, `{"data":[{"id":"e"}]}`)
+	})
+
+	ctx := context.Background()
+	engine, err := client.GetEngine(ctx, "e")
+	checks.NoError(t, err, "GetEngine error")
+	checkRateLimitTestMetadata(t, engine.Metadata())
+	model, err := client.GetModel(ctx, "m")
+	checks.NoError(t, err, "GetModel error")
+	checkRateLimitTestMetadata(t, model.Metadata())
+	file, err := client.GetFile(ctx, "f")
+	checks.NoError(t, err, "GetFile error")
+	checkRateLimitTestMetadata(t, file.Metadata())
+	fineTune, err := client.GetFineTune(ctx, "t")
+	checks.NoError(t, err, "GetFineTune error")
+	checkRateLimitTestMetadata(t, fineTune.Metadata())
+	deleted, err := client.DeleteFineTune(ctx, "t")
+	checks.NoError(t, err, "DeleteFineTune error")
+	checkRateLimitTestMetadata(t, deleted.Metadata())
+
+	// Elements of lists share the metadata of the list.
+	engines, err := client.ListEngines(ctx)
+	checks.NoError(t, err, "ListEngines error")
+	checkRateLimitTestMetadata(t, engines.ResponseMetadata)
+	if engines.Engines[0].Metadata().RequestID() != "" {
+		t.Errorf("Expected list elements to have no metadata of their own")
+	}
+}
+
+func TestMetadataKeepsTypesComparable(t *testing.T) {
+	// The metadata is held by pointer, an http.Header would make these types non-comparable.
+	if (Engine{ID: "a"}) != (Engine{ID: "a"}) || (File{ID: "a"}) != (File{ID: "a"}) ||
+		(FineTuneDeleteResponse{ID: "a"}) != (FineTuneDeleteResponse{ID: "a"}) {
+		t.Errorf("Equal values should compare equal")
+	}
+}
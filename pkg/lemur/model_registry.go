@@ -0,0 +1,297 @@
+package lemur
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Endpoints a model can be used with, named after the suffix of their URL.
+const (
+	EndpointChatCompletions = chatCompletionsSuffix
+	EndpointCompletions     = "/completions"
+	EndpointEmbeddings      = "/embeddings"
+	EndpointEdits           = "/edits"
+)
+
+// ModelInfo describes what a model can do and what it costs.
+type ModelInfo struct {
+	// Endpoints lists the endpoints the model can be used with.
+	Endpoints []string `yaml:"endpoints"`
+	// ContextWindow is the maximum number of tokens of the prompt and the completion together.
+	ContextWindow int `yaml:"context_window"`
+	// MaxOutputTokens is the maximum number of completion tokens.
+	// Zero means that only the context window limits the completion.
+	MaxOutputTokens   int  `yaml:"max_output_tokens"`
+	SupportsFunctions bool `yaml:"supports_functions"`
+	SupportsVision    bool `yaml:"supports_vision"`
+	// PromptPrice and CompletionPrice are in US dollars per 1000 tokens.
+	PromptPrice     float64 `yaml:"prompt_price"`
+	CompletionPrice float64 `yaml:"completion_price"`
+}
+
+// SupportsEndpoint reports whether the model can be used with endpoint.
+func (m ModelInfo) SupportsEndpoint(endpoint string) bool {
+	return slices.Contains(m.Endpoints, endpoint)
+}
+
+// Cost returns the price in US dollars of a request using the given numbers of tokens.
+func (m ModelInfo) Cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*m.PromptPrice + float64(completionTokens)*m.CompletionPrice) / 1000
+}
+
+var (
+	chatEndpoints       = []string{EndpointChatCompletions}
+	completionEndpoints = []string{EndpointCompletions}
+)
+
+// builtinModels holds the models known when this package was released, with their published
+// limits and prices. Use a YAML file to add models or correct stale entries.
+var builtinModels = map[string]ModelInfo{
+	GPT4TurboPreview: {
+		Endpoints: chatEndpoints, ContextWindow: 128000, MaxOutputTokens: 4096,
+		SupportsFunctions: true, PromptPrice: 0.01, CompletionPrice: 0.03,
+	},
+	GPT4VisionPreview: {
+		Endpoints: chatEndpoints, ContextWindow: 128000, MaxOutputTokens: 4096,
+		SupportsVision: true, PromptPrice: 0.01, CompletionPrice: 0.03,
+	},
+	GPT4: {
+		Endpoints: chatEndpoints, ContextWindow: 8192,
+		SupportsFunctions: true, PromptPrice: 0.03, CompletionPrice: 0.06,
+	},
+	GPT40613: {
+		Endpoints: chatEndpoints, ContextWindow: 8192,
+		SupportsFunctions: true, PromptPrice: 0.03, CompletionPrice: 0.06,
+	},
+	GPT40314: {
+		Endpoints: chatEndpoints, ContextWindow: 8192,
+		PromptPrice: 0.03, CompletionPrice: 0.06,
+	},
+	GPT432K: {
+		Endpoints: chatEndpoints, ContextWindow: 32768,
+		SupportsFunctions: true, PromptPrice: 0.06, CompletionPrice: 0.12,
+	},
+	GPT432K0613: {
+		Endpoints: chatEndpoints, ContextWindow: 32768,
+		SupportsFunctions: true, PromptPrice: 0.06, CompletionPrice: 0.12,
+	},
+	GPT432K0314: {
+		Endpoints: chatEndpoints, ContextWindow: 32768,
+		PromptPrice: 0.06, CompletionPrice: 0.12,
+	},
+	GPT3Dot5Turbo1106: {
+		Endpoints: chatEndpoints, ContextWindow: 16385, MaxOutputTokens: 4096,
+		SupportsFunctions: true, PromptPrice: 0.001, CompletionPrice: 0.002,
+	},
+	GPT3Dot5Turbo: {
+		Endpoints: chatEndpoints, ContextWindow: 4096,
+		SupportsFunctions: true, PromptPrice: 0.0015, CompletionPrice: 0.002,
+	},
+	GPT3Dot5Turbo0613: {
+		Endpoints: chatEndpoints, ContextWindow: 4096,
+		SupportsFunctions: true, PromptPrice: 0.0015, CompletionPrice: 0.002,
+	},
+	GPT3Dot5Turbo0301: {
+		Endpoints: chatEndpoints, ContextWindow: 4096,
+		PromptPrice: 0.0015, CompletionPrice: 0.002,
+	},
+	GPT3Dot5Turbo16K: {
+		Endpoints: chatEndpoints, ContextWindow: 16384,
+		SupportsFunctions: true, PromptPrice: 0.003, CompletionPrice: 0.004,
+	},
+	GPT3Dot5Turbo16K0613: {
+		Endpoints: chatEndpoints, ContextWindow: 16384,
+		SupportsFunctions: true, PromptPrice: 0.003, CompletionPrice: 0.004,
+	},
+	GPT3Dot5TurboInstruct: {
+		Endpoints: completionEndpoints, ContextWindow: 4096,
+		PromptPrice: 0.0015, CompletionPrice: 0.002,
+	},
+	GPT3Davinci002: {
+		Endpoints: completionEndpoints, ContextWindow: 16384,
+		PromptPrice: 0.002, CompletionPrice: 0.002,
+	},
+	GPT3Babbage002: {
+		Endpoints: completionEndpoints, ContextWindow: 16384,
+		PromptPrice: 0.0004, CompletionPrice: 0.0004,
+	},
+	GPT3TextDavinci003: {
+		Endpoints: completionEndpoints, ContextWindow: 4097,
+		PromptPrice: 0.02, CompletionPrice: 0.02,
+	},
+	GPT3TextDavinci002: {
+		Endpoints: completionEndpoints, ContextWindow: 4097,
+		PromptPrice: 0.02, CompletionPrice: 0.02,
+	},
+	GPT3TextDavinci001: {
+		Endpoints: completionEndpoints, ContextWindow: 2049,
+		PromptPrice: 0.02, CompletionPrice: 0.02,
+	},
+	GPT3TextCurie001: {
+		Endpoints: completionEndpoints, ContextWindow: 2049,
+		PromptPrice: 0.002, CompletionPrice: 0.002,
+	},
+	GPT3TextBabbage001: {
+		Endpoints: completionEndpoints, ContextWindow: 2049,
+		PromptPrice: 0.0005, CompletionPrice: 0.0005,
+	},
+	GPT3TextAda001: {
+		Endpoints: completionEndpoints, ContextWindow: 2049,
+		PromptPrice: 0.0004, CompletionPrice: 0.0004,
+	},
+	GPT3DavinciInstructBeta: {
+		Endpoints: completionEndpoints, ContextWindow: 2049,
+		PromptPrice: 0.02, CompletionPrice: 0.02,
+	},
+	GPT3CurieInstructBeta: {
+		Endpoints: completionEndpoints, ContextWindow: 2049,
+		PromptPrice: 0.002, CompletionPrice: 0.002,
+	},
+	GPT3Davinci: {
+		Endpoints: completionEndpoints, ContextWindow: 2049,
+		PromptPrice: 0.02, CompletionPrice: 0.02,
+	},
+	GPT3Curie: {
+		Endpoints: completionEndpoints, ContextWindow: 2049,
+		PromptPrice: 0.002, CompletionPrice: 0.002,
+	},
+	GPT3Babbage: {
+		Endpoints: completionEndpoints, ContextWindow: 2049,
+		PromptPrice: 0.0005, CompletionPrice: 0.0005,
+	},
+	GPT3Ada: {
+		Endpoints: completionEndpoints, ContextWindow: 2049,
+		PromptPrice: 0.0004, CompletionPrice: 0.0004,
+	},
+	CodexCodeDavinci002: {Endpoints: completionEndpoints, ContextWindow: 8001},
+	CodexCodeDavinci001: {Endpoints: completionEndpoints, ContextWindow: 8001},
+	CodexCodeCushman001: {Endpoints: completionEndpoints, ContextWindow: 2048},
+	AdaEmbeddingV2.String(): {
+		Endpoints: []string{EndpointEmbeddings}, ContextWindow: 8191, PromptPrice: 0.0001,
+	},
+	SmallEmbedding3.String(): {
+		Endpoints: []string{EndpointEmbeddings}, ContextWindow: 8191, PromptPrice: 0.00002,
+	},
+	LargeEmbedding3.String(): {
+		Endpoints: []string{EndpointEmbeddings}, ContextWindow: 8191, PromptPrice: 0.00013,
+	},
+}
+
+// ModelRegistry records the capabilities of models. It is safe for concurrent use.
+//
+// Requests for models missing from the registry are not validated, so a new model
+// can be used before the registry knows about it.
+type ModelRegistry struct {
+	mu     sync.RWMutex
+	models map[string]ModelInfo
+}
+
+// NewModelRegistry returns a registry holding the built-in models.
+func NewModelRegistry() *ModelRegistry {
+	models := make(map[string]ModelInfo, len(builtinModels))
+	for name, info := range builtinModels {
+		models[name] = info
+	}
+	return &ModelRegistry{models: models}
+}
+
+// defaultModelRegistry is used by clients without ClientConfig.Models.
+var defaultModelRegistry = NewModelRegistry()
+
+// Lookup returns the information about model. Fine-tuned models ("ft:gpt-3.5-turbo-0613:org::id")
+// which aren't registered themselves get the information of their base model.
+func (r *ModelRegistry) Lookup(model string) (ModelInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if info, ok := r.models[model]; ok {
+		return info, true
+	}
+	if rest, ok := strings.CutPrefix(model, "ft:"); ok {
+		base, _, _ := strings.Cut(rest, ":")
+		info, ok := r.models[base]
+		return info, ok
+	}
+	return ModelInfo{}, false
+}
+
+// Register adds model to the registry, replacing any previous information about it.
+func (r *ModelRegistry) Register(model string, info ModelInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.models[model] = info
+}
+
+// Models returns the names of the registered models, sorted.
+func (r *ModelRegistry) Models() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.models))
+	for name := range r.models {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// LoadYAML applies the overrides of a YAML document like:
+//
+//	models:
+//	  gpt-4:
+//	    prompt_price: 0.03
+//	  my-deployment:
+//	    endpoints: [/chat/completions]
+//	    context_window: 16384
+//	    supports_functions: true
+//
+// Fields of a model already in the registry which aren't set in the document keep their value.
+func (r *ModelRegistry) LoadYAML(data []byte) error {
+	var doc struct {
+		Models map[string]yaml.Node `yaml:"models"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parsing model registry: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	updated := make(map[string]ModelInfo, len(doc.Models))
+	for name, node := range doc.Models {
+		info := r.models[name]
+		if err := node.Decode(&info); err != nil {
+			return fmt.Errorf("parsing model registry entry %s: %w", name, err)
+		}
+		updated[name] = info
+	}
+	for name, info := range updated {
+		r.models[name] = info
+	}
+	return nil
+}
+
+// LoadYAMLFile applies the overrides of a YAML file, see LoadYAML.
+func (r *ModelRegistry) LoadYAMLFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return r.LoadYAML(data)
+}
+
+// models returns the registry of the client.
+func (c *Client) models() *ModelRegistry {
+	if c.config.Models != nil {
+		return c.config.Models
+	}
+	return defaultModelRegistry
+}
+
+// supportsEndpoint reports whether model can be used with endpoint. Unknown models are allowed.
+func (r *ModelRegistry) supportsEndpoint(endpoint, model string) bool {
+	info, ok := r.Lookup(model)
+	return !ok || info.SupportsEndpoint(endpoint)
+}
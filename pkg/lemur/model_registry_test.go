@@ -0,0 +1,119 @@
+package lemur_test
+
+import (
+	. "chatgpt-go/pkg/lemur"
+	"chatgpt-go/pkg/lemur/internal/test/checks"
+
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestModelRegistryLookup(t *testing.T) {
+	registry := NewModelRegistry()
+
+	info, ok := registry.Lookup(GPT432K0613)
+	if !ok || info.ContextWindow != 32768 || !info.SupportsFunctions || !info.SupportsEndpoint(EndpointChatCompletions) {
+		t.Errorf("Unexpected info for %s: %+v", GPT432K0613, info)
+	}
+
+	info, ok = registry.Lookup("ft:gpt-3.5-turbo-0613:my-org::abc123")
+	if !ok || info.ContextWindow != 4096 {
+		t.Errorf("Fine-tuned model should use its base model, got %+v, %v", info, ok)
+	}
+
+	if _, ok = registry.Lookup("unknown-model"); ok {
+		t.Errorf("Unknown model should not be found")
+	}
+
+	if cost := info.Cost(1000, 500); math.Abs(cost-0.0025) > 1e-9 {
+		t.Errorf("Expected a cost of 0.0025, got %f", cost)
+	}
+}
+
+func TestModelRegistryLoadYAML(t *testing.T) {
+	registry := NewModelRegistry()
+	err := registry.LoadYAML([]byte(`
+models:
+  gpt-4:
+    prompt_price: 0.05
+  my-deployment:
+    endpoints: [/chat/completions]
+    context_window: 16384
+    max_output_tokens: 2048
+    supports_functions: true
+    supports_vision: true
+`))
+	checks.NoError(t, err, "LoadYAML error")
+
+	info, _ := registry.Lookup(GPT4)
+	if info.PromptPrice != 0.05 || info.CompletionPrice != 0.06 || info.ContextWindow != 8192 {
+		t.Errorf("Override should only change the given fields, got %+v", info)
+	}
+
+	expected := ModelInfo{
+		Endpoints:         []string{EndpointChatCompletions},
+		ContextWindow:     16384,
+		MaxOutputTokens:   2048,
+		SupportsFunctions: true,
+		SupportsVision:    true,
+	}
+	if info, _ = registry.Lookup("my-deployment"); !reflect.DeepEqual(info, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, info)
+	}
+
+	// Other registries are not affected.
+	if info, _ = NewModelRegistry().Lookup(GPT4); info.PromptPrice != 0.03 {
+		t.Errorf("Built-in models should not change, got %+v", info)
+	}
+}
+
+func TestModelRegistryLoadYAMLError(t *testing.T) {
+	registry := NewModelRegistry()
+	err := registry.LoadYAML([]byte(`
+models:
+  gpt-4:
+    prompt_price: 1
+  broken:
+    context_window: [1]
+`))
+	checks.HasError(t, err, "LoadYAML should fail on an invalid entry")
+	if info, _ := registry.Lookup(GPT4); info.PromptPrice != 0.03 {
+		t.Errorf("A failed load should not change the registry, got %+v", info)
+	}
+
+	err = NewModelRegistry().LoadYAMLFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	checks.ErrorIs(t, err, os.ErrNotExist, "LoadYAMLFile should fail on a missing file")
+}
+
+func TestModelRegistryValidatesRequests(t *testing.T) {
+	registry := NewModelRegistry()
+	registry.Register("completion-only", ModelInfo{Endpoints: []string{EndpointCompletions}})
+
+	config := DefaultConfig("whatever")
+	config.BaseURL = "http://localhost/v1"
+	config.Models = registry
+	client := NewClientWithConfig(config)
+	ctx := context.Background()
+
+	for _, model := range []string{"completion-only", GPT3Dot5TurboInstruct} {
+		_, err := client.CreateChatCompletion(ctx, ChatCompletionRequest{
+			Model:    model,
+			Messages: []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "Hello!"}},
+		})
+		checks.ErrorIs(t, err, ErrChatCompletionInvalidModel, "chat completion with "+model)
+	}
+
+	_, err := client.CreateCompletion(ctx, CompletionRequest{Model: GPT4, Prompt: "Hello"})
+	checks.ErrorIs(t, err, ErrCompletionUnsupportedModel, "completion with a chat model")
+}
+
+func TestModelRegistryModels(t *testing.T) {
+	models := NewModelRegistry().Models()
+	if len(models) == 0 || models[0] > models[len(models)-1] {
+		t.Errorf("Expected sorted model names, got %v", models)
+	}
+}
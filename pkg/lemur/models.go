@@ -15,6 +15,8 @@ type Model struct {
 	Permission []Permission `json:"permission"`
 	Root       string       `json:"root"`
 	Parent     string       `json:"parent"`
+
+	responseMetadataRef
 }
 
 // Permission struct represents an OpenAPI permission.
@@ -36,6 +38,8 @@ type Permission struct {
 // ModelsList is a list of models, including those that belong to the user or organization.
 type ModelsList struct {
 	Models []Model `json:"data"`
+
+	ResponseMetadata
 }
 
 // ListModels Lists the currently available models,
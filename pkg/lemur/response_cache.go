@@ -0,0 +1,509 @@
+package lemur
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultResponseCacheMaxBytes = 64 << 20
+	defaultResponseCacheTable    = "lemur_response_cache"
+	// responseFlightReadSize is the size of the reads of an upstream response shared by a flight.
+	responseFlightReadSize = 32 << 10
+)
+
+var (
+	ErrInvalidResponseCacheTable = errors.New("invalid response cache table name")
+	errResponseBodyClosed        = errors.New("read on closed response body")
+)
+
+var responseCacheTablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ResponseCacheConfig configures a ResponseCache. The zero value keeps up to 64 MiB of
+// deterministic responses in memory, without expiry.
+type ResponseCacheConfig struct {
+	// MaxBytes limits the size of the bodies kept in memory, the least recently used being
+	// evicted first. Defaults to 64 MiB.
+	MaxBytes int64
+	// TTL is how long a response stays cached. Zero means until it is evicted.
+	TTL time.Duration
+	// DB, when set, is an SQLite database persisting the responses, so that they outlive
+	// the process and memory evictions.
+	DB *sql.DB
+	// Table is the table of DB holding the responses, created if needed.
+	// Defaults to "lemur_response_cache".
+	Table string
+	// Cacheable reports whether the response to a request may be cached. Defaults to IsDeterministic,
+	// which only accepts requests setting Temperature to ZeroTemperature: a zero Temperature can't be
+	// told apart from an unset one, which samples with the default temperature of the API.
+	Cacheable func(request ChatCompletionRequest) bool
+}
+
+// ResponseCacheStats counts the lookups of a ResponseCache.
+type ResponseCacheStats struct {
+	// Hits are requests answered from the cache, Misses requests sent upstream, and
+	// Coalesced requests sharing the upstream response of an identical request in flight.
+	Hits      int64
+	Misses    int64
+	Coalesced int64
+	Stores    int64
+	Evictions int64
+	// Entries and Bytes describe the responses kept in memory.
+	Entries int
+	Bytes   int64
+}
+
+// ResponseCache caches chat completion responses by request, see ClientConfig.ResponseCache.
+//
+// Requests are identified by a hash of their normalized JSON encoding and their URL, so that
+// only identical requests share a response. Identical requests sent while the first one is
+// in flight don't reach the API: the upstream response, streamed or not, is fanned out to all
+// of them as it arrives. Only complete, successful responses are cached.
+//
+// A ResponseCache is safe for concurrent use and may be shared by several clients.
+type ResponseCache struct {
+	config ResponseCacheConfig
+	now    func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List // of *cachedResponse, most recently used first
+	entries map[string]*list.Element
+	bytes   int64
+	flights map[string]*responseFlight
+
+	hits, misses, coalesced, stores, evictions atomic.Int64
+}
+
+type cachedResponse struct {
+	key         string
+	contentType string
+	body        []byte
+	stored      time.Time
+}
+
+// IsDeterministic reports whether request asks for a single choice with a zero temperature,
+// set with ZeroTemperature, as scripts do when they expect the same answer to the same messages.
+// A Seed alone isn't enough, as the API still samples with the requested temperature.
+func IsDeterministic(request ChatCompletionRequest) bool {
+	return request.Temperature == ZeroTemperature && request.N <= 1
+}
+
+// NewResponseCache returns an empty cache, creating the table of config.DB if needed.
+func NewResponseCache(config ResponseCacheConfig) (*ResponseCache, error) {
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaultResponseCacheMaxBytes
+	}
+	if config.Table == "" {
+		config.Table = defaultResponseCacheTable
+	}
+	if config.Cacheable == nil {
+		config.Cacheable = IsDeterministic
+	}
+	if !responseCacheTablePattern.MatchString(config.Table) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidResponseCacheTable, config.Table)
+	}
+	if config.DB != nil {
+		//nolint:gosec // the table name is validated
+		_, err := config.DB.Exec(`CREATE TABLE IF NOT EXISTS ` + config.Table +
+			` (key TEXT PRIMARY KEY, content_type TEXT NOT NULL, body BLOB NOT NULL, stored_at INTEGER NOT NULL)`)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &ResponseCache{
+		config:  config,
+		now:     time.Now,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		flights: make(map[string]*responseFlight),
+	}, nil
+}
+
+// Stats returns the counters of the cache.
+func (rc *ResponseCache) Stats() ResponseCacheStats {
+	rc.mu.Lock()
+	entries, size := len(rc.entries), rc.bytes
+	rc.mu.Unlock()
+	return ResponseCacheStats{
+		Hits:      rc.hits.Load(),
+		Misses:    rc.misses.Load(),
+		Coalesced: rc.coalesced.Load(),
+		Stores:    rc.stores.Load(),
+		Evictions: rc.evictions.Load(),
+		Entries:   entries,
+		Bytes:     size,
+	}
+}
+
+// key returns the key of the response to request sent to url, and false if it may not be cached.
+// The request is normalized so that fields which don't change the response don't change the key.
+func (rc *ResponseCache) key(request ChatCompletionRequest, url string) (string, bool) {
+	if !rc.config.Cacheable(request) {
+		return "", false
+	}
+	request.User = ""
+	if request.N == 1 {
+		request.N = 0
+	}
+	encoded, err := json.Marshal(struct {
+		URL     string                `json:"url"`
+		Request ChatCompletionRequest `json:"request"`
+	}{url, request})
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), true
+}
+
+type responseCacheKey struct{}
+
+// withResponseCache marks req to be answered through the client's response cache with the
+// response to request, when it may be cached.
+func (c *Client) withResponseCache(req *http.Request, request ChatCompletionRequest) *http.Request {
+	if c.config.ResponseCache == nil {
+		return req
+	}
+	key, ok := c.config.ResponseCache.key(request, req.URL.String())
+	if !ok {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), responseCacheKey{}, key))
+}
+
+// do answers req from the cache, from an identical request in flight, or by sending it with send.
+func (rc *ResponseCache) do(req *http.Request, key string, send RequestFunc) (*http.Response, error) {
+	rc.mu.Lock()
+	if entry := rc.memoryLookup(key); entry != nil {
+		rc.mu.Unlock()
+		rc.hits.Add(1)
+		return entry.response(), nil
+	}
+	flight, ok := rc.flights[key]
+	if ok {
+		flight.subscribers++
+		rc.mu.Unlock()
+		rc.coalesced.Add(1)
+		return flight.subscribe(req.Context())
+	}
+	rc.mu.Unlock()
+
+	if entry := rc.dbLookup(key); entry != nil {
+		rc.hits.Add(1)
+		return entry.response(), nil
+	}
+
+	rc.mu.Lock()
+	if flight, ok = rc.flights[key]; ok {
+		flight.subscribers++
+		rc.coalesced.Add(1)
+	} else {
+		rc.misses.Add(1)
+		flight = rc.startFlight(req, key, send)
+	}
+	rc.mu.Unlock()
+	return flight.subscribe(req.Context())
+}
+
+// memoryLookup returns the response with the given key kept in memory, or nil. rc.mu must be held.
+func (rc *ResponseCache) memoryLookup(key string) *cachedResponse {
+	element, ok := rc.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*cachedResponse)
+	if rc.expired(entry.stored) {
+		rc.removeElement(element)
+		return nil
+	}
+	rc.lru.MoveToFront(element)
+	return entry
+}
+
+// dbLookup returns the response with the given key persisted in the database, or nil.
+// The response is kept in memory too.
+func (rc *ResponseCache) dbLookup(key string) *cachedResponse {
+	if rc.config.DB == nil {
+		return nil
+	}
+	entry := &cachedResponse{key: key}
+	var stored int64
+	//nolint:gosec // the table name is validated
+	err := rc.config.DB.QueryRow(`SELECT content_type, body, stored_at FROM `+rc.config.Table+` WHERE key = ?`, key).
+		Scan(&entry.contentType, &entry.body, &stored)
+	if err != nil {
+		return nil
+	}
+	entry.stored = time.UnixMilli(stored)
+	if rc.expired(entry.stored) {
+		_, _ = rc.config.DB.Exec(`DELETE FROM `+rc.config.Table+` WHERE key = ?`, key) //nolint:gosec // validated name
+		return nil
+	}
+
+	rc.mu.Lock()
+	rc.keep(entry)
+	rc.mu.Unlock()
+	return entry
+}
+
+func (rc *ResponseCache) expired(stored time.Time) bool {
+	return rc.config.TTL > 0 && rc.now().Sub(stored) >= rc.config.TTL
+}
+
+// store caches a complete response, in memory and in the database.
+func (rc *ResponseCache) store(key, contentType string, body []byte) {
+	entry := &cachedResponse{key: key, contentType: contentType, body: body, stored: rc.now()}
+	rc.mu.Lock()
+	rc.keep(entry)
+	rc.mu.Unlock()
+	rc.stores.Add(1)
+
+	if rc.config.DB != nil {
+		// A failing database only loses the persistent copy, the request itself succeeded.
+		//nolint:gosec // the table name is validated
+		_, _ = rc.config.DB.Exec(`INSERT OR REPLACE INTO `+rc.config.Table+
+			` (key, content_type, body, stored_at) VALUES (?, ?, ?, ?)`,
+			key, contentType, body, entry.stored.UnixMilli())
+	}
+}
+
+// keep adds entry to the memory tier, evicting the least recently used entries beyond
+// MaxBytes. Entries larger than MaxBytes aren't kept. rc.mu must be held.
+func (rc *ResponseCache) keep(entry *cachedResponse) {
+	if element, ok := rc.entries[entry.key]; ok {
+		rc.removeElement(element)
+	}
+	if int64(len(entry.body)) > rc.config.MaxBytes {
+		return
+	}
+	rc.entries[entry.key] = rc.lru.PushFront(entry)
+	rc.bytes += int64(len(entry.body))
+	for rc.bytes > rc.config.MaxBytes {
+		rc.removeElement(rc.lru.Back())
+		rc.evictions.Add(1)
+	}
+}
+
+func (rc *ResponseCache) removeElement(element *list.Element) {
+	entry := rc.lru.Remove(element).(*cachedResponse)
+	delete(rc.entries, entry.key)
+	rc.bytes -= int64(len(entry.body))
+}
+
+func (entry *cachedResponse) response() *http.Response {
+	header := make(http.Header)
+	if entry.contentType != "" {
+		header.Set("Content-Type", entry.contentType)
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(entry.body)),
+		ContentLength: int64(len(entry.body)),
+	}
+}
+
+// responseFlight is an upstream request shared by identical requests. Its response body is
+// buffered as it arrives, and every subscriber reads the whole buffer from the start.
+type responseFlight struct {
+	cache  *ResponseCache
+	key    string
+	cancel context.CancelFunc
+	// subscribers is the number of open responses, guarded by cache.mu. The upstream request
+	// is cancelled when it drops to zero before the body is complete.
+	subscribers int
+
+	// ready is closed once the response headers, or the error of the request, are known.
+	ready  chan struct{}
+	resp   *http.Response
+	err    error
+	stream bool
+
+	mu   sync.Mutex
+	body []byte
+	done bool
+	// readErr is the error which ended the body, nil for a complete body.
+	readErr error
+	// changed is closed and replaced whenever body grows or is done.
+	changed chan struct{}
+}
+
+// startFlight sends req in the background. The request isn't cancelled by the context of
+// req, since other subscribers may depend on it. rc.mu must be held.
+func (rc *ResponseCache) startFlight(req *http.Request, key string, send RequestFunc) *responseFlight {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(req.Context()))
+	flight := &responseFlight{
+		cache:       rc,
+		key:         key,
+		cancel:      cancel,
+		subscribers: 1,
+		ready:       make(chan struct{}),
+		stream:      req.Header.Get("Accept") == "text/event-stream",
+		changed:     make(chan struct{}),
+	}
+	rc.flights[key] = flight
+	go flight.run(req.WithContext(ctx), send)
+	return flight
+}
+
+func (f *responseFlight) run(req *http.Request, send RequestFunc) {
+	defer f.cancel()
+	resp, err := send(req)
+	f.resp, f.err = resp, err
+	close(f.ready)
+	if err != nil {
+		f.finish(err)
+		f.cache.endFlight(f)
+		return
+	}
+	defer resp.Body.Close()
+
+	buf := make([]byte, responseFlightReadSize)
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			f.append(buf[:n])
+		}
+		if errors.Is(readErr, io.EOF) {
+			readErr = nil
+			break
+		}
+		if readErr != nil {
+			f.finish(readErr)
+			f.cache.endFlight(f)
+			return
+		}
+	}
+
+	// Streams ending without [DONE] were cut short.
+	if !isFailureStatusCode(resp) && (!f.stream || bytes.Contains(f.body, doneData)) {
+		f.cache.store(f.key, resp.Header.Get("Content-Type"), f.body)
+	}
+	f.finish(nil)
+	f.cache.endFlight(f)
+}
+
+// endFlight makes the next identical requests start a new flight or use the cache.
+func (rc *ResponseCache) endFlight(f *responseFlight) {
+	rc.mu.Lock()
+	if rc.flights[f.key] == f {
+		delete(rc.flights, f.key)
+	}
+	rc.mu.Unlock()
+}
+
+// unsubscribe cancels the upstream request when the last subscriber leaves before its end.
+func (rc *ResponseCache) unsubscribe(f *responseFlight) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	f.subscribers--
+	if f.subscribers > 0 {
+		return
+	}
+	f.mu.Lock()
+	done := f.done
+	f.mu.Unlock()
+	if !done {
+		f.cancel()
+		if rc.flights[f.key] == f {
+			delete(rc.flights, f.key)
+		}
+	}
+}
+
+func (f *responseFlight) append(p []byte) {
+	f.mu.Lock()
+	f.body = append(f.body, p...)
+	close(f.changed)
+	f.changed = make(chan struct{})
+	f.mu.Unlock()
+}
+
+func (f *responseFlight) finish(err error) {
+	f.mu.Lock()
+	f.done = true
+	f.readErr = err
+	close(f.changed)
+	f.changed = make(chan struct{})
+	f.mu.Unlock()
+}
+
+// subscribe returns a response reading the body of the flight from the start.
+func (f *responseFlight) subscribe(ctx context.Context) (*http.Response, error) {
+	select {
+	case <-f.ready:
+	case <-ctx.Done():
+		f.cache.unsubscribe(f)
+		return nil, ctx.Err()
+	}
+	if f.err != nil {
+		f.cache.unsubscribe(f)
+		return nil, f.err
+	}
+	resp := *f.resp
+	resp.Header = f.resp.Header.Clone()
+	resp.Body = &flightReader{flight: f, ctx: ctx, closed: make(chan struct{})}
+	return &resp, nil
+}
+
+// flightReader reads the body of a flight, waiting for it to grow.
+type flightReader struct {
+	flight    *responseFlight
+	ctx       context.Context
+	offset    int
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (r *flightReader) Read(p []byte) (int, error) {
+	f := r.flight
+	for {
+		f.mu.Lock()
+		if r.offset < len(f.body) {
+			n := copy(p, f.body[r.offset:])
+			r.offset += n
+			f.mu.Unlock()
+			return n, nil
+		}
+		if f.done {
+			err := f.readErr
+			f.mu.Unlock()
+			if err == nil {
+				err = io.EOF
+			}
+			return 0, err
+		}
+		changed := f.changed
+		f.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-r.closed:
+			return 0, errResponseBodyClosed
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		}
+	}
+}
+
+func (r *flightReader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+		r.flight.cache.unsubscribe(r.flight)
+	})
+	return nil
+}
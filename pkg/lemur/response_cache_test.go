@@ -0,0 +1,290 @@
+package lemur_test
+
+import (
+	. "chatgpt-go/pkg/lemur"
+	"chatgpt-go/pkg/lemur/internal/test"
+	"chatgpt-go/pkg/lemur/internal/test/checks"
+
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func setupResponseCacheTestServer(cache *ResponseCache) (client *Client, server *test.ServerTest, teardown func()) {
+	server = test.NewTestServer()
+	ts := server.LemurTestServer()
+	ts.Start()
+	teardown = ts.Close
+	config := DefaultConfig(test.GetTestToken())
+	config.BaseURL = ts.URL + "/v1"
+	config.ResponseCache = cache
+	client = NewClientWithConfig(config)
+	return
+}
+
+// gatedStreamHandler streams "Hello" at once and " world" once release is closed, counting its calls.
+func gatedStreamHandler(calls *atomic.Int32, release <-chan struct{}) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunk := `data: {"id":"%d","object":"chat.completion.chunk","model":"gpt-3.5-turbo","choices":[{"index":0,"delta":{"content":%q}}]}` + "\n\n"
+		fmt.Fprintf(w, chunk, n, "Hello")
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+		}
+		fmt.Fprintf(w, chunk, n, " world")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}
+}
+
+func cacheTestRequest() ChatCompletionRequest {
+	return ChatCompletionRequest{
+		Model:       GPT3Dot5Turbo,
+		Messages:    []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "Hello!"}},
+		Temperature: ZeroTemperature,
+	}
+}
+
+func streamContent(ctx context.Context, client *Client, request ChatCompletionRequest) (string, error) {
+	stream, err := client.CreateChatCompletionStream(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	var acc ChatCompletionStreamAccumulator
+	for chunk, err := range stream.All() {
+		if err != nil {
+			return "", err
+		}
+		acc.Add(chunk)
+	}
+	return acc.Content(0), nil
+}
+
+// waitFor polls condition until it holds, failing the test after a second.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !condition(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the condition")
+		}
+	}
+}
+
+func TestResponseCacheCoalescesStreams(t *testing.T) {
+	cache, err := NewResponseCache(ResponseCacheConfig{})
+	checks.NoError(t, err, "NewResponseCache error")
+	client, server, teardown := setupResponseCacheTestServer(cache)
+	defer teardown()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	server.RegisterHandler("/v1/chat/completions", gatedStreamHandler(&calls, release))
+
+	const subscribers = 5
+	var wg sync.WaitGroup
+	contents := make([]string, subscribers)
+	for i := range contents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var streamErr error
+			contents[i], streamErr = streamContent(context.Background(), client, cacheTestRequest())
+			checks.NoError(t, streamErr, "Stream error")
+		}()
+	}
+	waitFor(t, func() bool {
+		stats := cache.Stats()
+		return stats.Misses+stats.Coalesced == subscribers
+	})
+	close(release)
+	wg.Wait()
+
+	for i, content := range contents {
+		if content != "Hello world" {
+			t.Errorf("Subscriber %d got %q", i, content)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", calls.Load())
+	}
+
+	content, err := streamContent(context.Background(), client, cacheTestRequest())
+	checks.NoError(t, err, "Cached stream error")
+	stats := cache.Stats()
+	if content != "Hello world" || calls.Load() != 1 || stats.Hits != 1 || stats.Entries != 1 {
+		t.Errorf("Expected a cache hit, got %q after %d calls, %+v", content, calls.Load(), stats)
+	}
+
+	// Requests which aren't deterministic always reach the API.
+	request := cacheTestRequest()
+	request.N = 2
+	_, err = streamContent(context.Background(), client, request)
+	checks.NoError(t, err, "Stream error")
+	if calls.Load() != 2 {
+		t.Errorf("Expected a second upstream call, got %d", calls.Load())
+	}
+}
+
+func TestResponseCacheRequiresOptIn(t *testing.T) {
+	cache, err := NewResponseCache(ResponseCacheConfig{})
+	checks.NoError(t, err, "NewResponseCache error")
+	client, server, teardown := setupResponseCacheTestServer(cache)
+	defer teardown()
+	var calls atomic.Int32
+	server.RegisterHandler("/v1/chat/completions", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, `{"id":"%d","object":"chat.completion","choices":[]}`, calls.Add(1))
+	})
+
+	// A zero temperature is omitted and the API samples with its default, even with a seed.
+	seed := 42
+	zero := cacheTestRequest()
+	zero.Temperature = 0
+	seeded := zero
+	seeded.Seed = &seed
+	for _, request := range []ChatCompletionRequest{zero, seeded} {
+		if IsDeterministic(request) {
+			t.Errorf("Expected %+v not to be deterministic", request)
+		}
+		for range 2 {
+			_, err = client.CreateChatCompletion(context.Background(), request)
+			checks.NoError(t, err, "CreateChatCompletion error")
+		}
+	}
+	if stats := cache.Stats(); calls.Load() != 4 || stats.Entries != 0 || stats.Hits != 0 {
+		t.Errorf("Expected requests without ZeroTemperature not to be cached, got %d calls, %+v", calls.Load(), stats)
+	}
+}
+
+func TestResponseCacheSubscriberLeaves(t *testing.T) {
+	cache, err := NewResponseCache(ResponseCacheConfig{})
+	checks.NoError(t, err, "NewResponseCache error")
+	client, server, teardown := setupResponseCacheTestServer(cache)
+	defer teardown()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	server.RegisterHandler("/v1/chat/completions", gatedStreamHandler(&calls, release))
+
+	// The first subscriber gives up after the first chunk; the second one still gets everything.
+	ctx, cancel := context.WithCancel(context.Background())
+	first, err := client.CreateChatCompletionStream(ctx, cacheTestRequest())
+	checks.NoError(t, err, "CreateChatCompletionStream error")
+	_, err = first.Recv()
+	checks.NoError(t, err, "Recv error")
+
+	done := make(chan string)
+	go func() {
+		content, streamErr := streamContent(context.Background(), client, cacheTestRequest())
+		checks.NoError(t, streamErr, "Stream error")
+		done <- content
+	}()
+	waitFor(t, func() bool { return cache.Stats().Coalesced == 1 })
+	cancel()
+	first.Close()
+	close(release)
+
+	if content := <-done; content != "Hello world" || calls.Load() != 1 {
+		t.Errorf("Expected the shared stream, got %q after %d calls", content, calls.Load())
+	}
+	if cache.Stats().Entries != 1 {
+		t.Errorf("Expected the response to be cached, got %+v", cache.Stats())
+	}
+}
+
+func TestResponseCacheChatCompletion(t *testing.T) {
+	cache, err := NewResponseCache(ResponseCacheConfig{MaxBytes: 80})
+	checks.NoError(t, err, "NewResponseCache error")
+	client, server, teardown := setupResponseCacheTestServer(cache)
+	defer teardown()
+	var calls atomic.Int32
+	server.RegisterHandler("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if n == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error":{"message":"failed","type":"server_error"}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"id":"%d","object":"chat.completion","choices":[]}`, n)
+	})
+
+	_, err = client.CreateChatCompletion(context.Background(), cacheTestRequest())
+	checks.HasError(t, err, "Expected the error of the API")
+	for range 2 {
+		response, err := client.CreateChatCompletion(context.Background(), cacheTestRequest())
+		checks.NoError(t, err, "CreateChatCompletion error")
+		if response.ID != "2" {
+			t.Errorf("Expected the cached response, got %+v", response)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected errors not to be cached and responses to be, got %d calls", calls.Load())
+	}
+
+	// The user doesn't change the key, the messages do.
+	request := cacheTestRequest()
+	request.User = "someone"
+	_, _ = client.CreateChatCompletion(context.Background(), request)
+	request.Messages[0].Content = "Bye!"
+	_, _ = client.CreateChatCompletion(context.Background(), request)
+	if calls.Load() != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls.Load())
+	}
+
+	// Two responses don't fit in 80 bytes.
+	if stats := cache.Stats(); stats.Entries != 1 || stats.Evictions != 1 || stats.Bytes > 80 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestResponseCacheSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "cache.db"))
+	checks.NoError(t, err, "sql.Open error")
+	defer db.Close()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	close(release)
+
+	server := test.NewTestServer()
+	server.RegisterHandler("/v1/chat/completions", gatedStreamHandler(&calls, release))
+	ts := server.LemurTestServer()
+	ts.Start()
+	defer ts.Close()
+	newClient := func() (*Client, *ResponseCache) {
+		cache, cacheErr := NewResponseCache(ResponseCacheConfig{DB: db, TTL: 200 * time.Millisecond})
+		checks.NoError(t, cacheErr, "NewResponseCache error")
+		config := DefaultConfig(test.GetTestToken())
+		config.BaseURL = ts.URL + "/v1"
+		config.ResponseCache = cache
+		return NewClientWithConfig(config), cache
+	}
+
+	client, _ := newClient()
+	_, err = streamContent(context.Background(), client, cacheTestRequest())
+	checks.NoError(t, err, "Stream error")
+
+	// A new cache, as after a restart, finds the response in the database.
+	client, cache := newClient()
+	content, err := streamContent(context.Background(), client, cacheTestRequest())
+	checks.NoError(t, err, "Stream error")
+	if content != "Hello world" || calls.Load() != 1 || cache.Stats().Hits != 1 {
+		t.Errorf("Expected a persisted response, got %q after %d calls", content, calls.Load())
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	_, err = streamContent(context.Background(), client, cacheTestRequest())
+	checks.NoError(t, err, "Stream error")
+	if calls.Load() != 2 {
+		t.Errorf("Expected the response to expire, got %d calls", calls.Load())
+	}
+
+	_, err = NewResponseCache(ResponseCacheConfig{DB: db, Table: "cache; DROP TABLE x"})
+	checks.ErrorIs(t, err, ErrInvalidResponseCacheTable, "Expected ErrInvalidResponseCacheTable")
+}
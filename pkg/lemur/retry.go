@@ -0,0 +1,219 @@
+package lemur
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryInitialBackoff = 500 * time.Millisecond
+	defaultRetryMaxBackoff     = 8 * time.Second
+	defaultRetryMultiplier     = 2
+	defaultRetryMaxDelay       = 30 * time.Second
+)
+
+var errRequestNotRewindable = errors.New("request body can't be replayed")
+
+// RetryPolicy controls how requests failing with a transport error, 429 or 5xx are retried.
+// The zero value disables retries.
+//
+// Only requests which can be safely replayed are retried: non-streamed requests, and streamed
+// requests which failed before the response stream started. Waiting between attempts stops as
+// soon as the request context is done.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// Values lower than 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. Defaults to 500ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the computed exponential delay. Defaults to 8s.
+	MaxBackoff time.Duration
+	// MaxDelay caps the delays requested by the server through Retry-After or, on 429,
+	// x-ratelimit-reset-*. A longer requested delay is ignored in favor of the computed one.
+	// Defaults to 30s.
+	MaxDelay time.Duration
+	// Multiplier is the factor applied to the delay after every attempt. Defaults to 2.
+	Multiplier float64
+	// Jitter is the fraction, between 0 and 1, of the computed delay that is randomized.
+	Jitter float64
+}
+
+// DefaultRetryPolicy returns a policy making up to 3 attempts with exponential backoff.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: defaultRetryInitialBackoff,
+		MaxBackoff:     defaultRetryMaxBackoff,
+		Multiplier:     defaultRetryMultiplier,
+		MaxDelay:       defaultRetryMaxDelay,
+		Jitter:         0.2,
+	}
+}
+
+func (p RetryPolicy) enabled() bool {
+	return p.MaxAttempts > 1
+}
+
+func isRetryableStatusCode(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay to wait after the given failed attempt (starting at 1).
+// A delay requested by the server takes precedence over the computed one, unless it exceeds MaxDelay.
+func (p RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		maxDelay := p.MaxDelay
+		if maxDelay <= 0 {
+			maxDelay = defaultRetryMaxDelay
+		}
+		if delay, ok := serverRetryDelay(resp.Header, resp.StatusCode, time.Now()); ok && delay <= maxDelay {
+			return delay
+		}
+	}
+
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = defaultRetryInitialBackoff
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = defaultRetryMultiplier
+	}
+
+	delay := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if delay > float64(maxBackoff) {
+		delay = float64(maxBackoff)
+	}
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		delay -= delay * jitter * rand.Float64() //nolint:gosec // jitter doesn't need a secure source
+	}
+	return time.Duration(delay)
+}
+
+// serverRetryDelay reads the delay requested by the server, from Retry-After
+// (seconds or HTTP date) or, failing that, the longest x-ratelimit-reset-* header.
+// The reset headers describe the quota windows and only say when to retry a 429.
+func serverRetryDelay(header http.Header, statusCode int, now time.Time) (time.Duration, bool) {
+	if v := header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil && seconds >= 0 {
+			return time.Duration(seconds * float64(time.Second)), true
+		}
+		if date, err := http.ParseTime(v); err == nil {
+			delay := date.Sub(now)
+			if delay < 0 {
+				delay = 0
+			}
+			return delay, true
+		}
+	}
+
+	if statusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	var (
+		delay time.Duration
+		found bool
+	)
+	for _, key := range []string{"x-ratelimit-reset-requests", "x-ratelimit-reset-tokens"} {
+		v := header.Get(key)
+		if v == "" {
+			continue
+		}
+		reset, err := time.ParseDuration(v)
+		if err != nil || reset < 0 {
+			continue
+		}
+		if reset > delay {
+			delay = reset
+		}
+		found = true
+	}
+	return delay, found
+}
+
+// do sends the request, answering it through the client's ResponseCache when it was marked
+// by withResponseCache.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if key, ok := req.Context().Value(responseCacheKey{}).(string); ok && c.config.ResponseCache != nil {
+		return c.config.ResponseCache.do(req, key, c.doWithRetry)
+	}
+	return c.doWithRetry(req)
+}
+
+// doWithRetry sends the request, retrying according to the client's RetryPolicy.
+// The response returned is the one of the last attempt.
+func (c *Client) doWithRetry(req *http.Request) (*http.Response, error) {
+	policy := c.config.RetryPolicy
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(req)
+		if !policy.enabled() || attempt >= policy.MaxAttempts || !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		retryReq, rewindErr := rewindRequest(req)
+		if rewindErr != nil {
+			return resp, err
+		}
+
+		delay := policy.backoff(attempt, resp)
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		req = retryReq
+	}
+}
+
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return isRetryableStatusCode(resp.StatusCode)
+}
+
+// rewindRequest returns a copy of req with a fresh body, so it can be sent again.
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	retryReq := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return retryReq, nil
+	}
+	if req.GetBody == nil {
+		return nil, errRequestNotRewindable
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	retryReq.Body = body
+	return retryReq, nil
+}
@@ -0,0 +1,229 @@
+package lemur //nolint:testpackage // testing private field
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"chatgpt-go/pkg/lemur/internal/test"
+	"chatgpt-go/pkg/lemur/internal/test/checks"
+)
+
+func setupRetryTestServer(policy RetryPolicy) (client *Client, server *test.ServerTest, teardown func()) {
+	server = test.NewTestServer()
+	ts := server.LemurTestServer()
+	ts.Start()
+	teardown = ts.Close
+	config := DefaultConfig(test.GetTestToken())
+	config.BaseURL = ts.URL + "/v1"
+	config.RetryPolicy = policy
+	client = NewClientWithConfig(config)
+	return
+}
+
+func fastRetryPolicy(maxAttempts int) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	}
+}
+
+func TestRetryOnRateLimitWithRetryAfter(t *testing.T) {
+	client, server, teardown := setupRetryTestServer(fastRetryPolicy(3))
+	defer teardown()
+
+	var attempts int32
+	server.RegisterHandler("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if len(body) == 0 {
+			t.Error("retried request has an empty body")
+		}
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = io.WriteString(w, `{"error":{"message":"rate limited","type":"requests"}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"id":"1","object":"chat.completion","choices":[]}`)
+	})
+
+	resp, err := client.CreateChatCompletion(context.Background(), ChatCompletionRequest{
+		Model:    GPT3Dot5Turbo,
+		Messages: []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "Hello!"}},
+	})
+	checks.NoError(t, err, "CreateChatCompletion error")
+	if resp.ID != "1" {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	client, server, teardown := setupRetryTestServer(fastRetryPolicy(3))
+	defer teardown()
+
+	var attempts int32
+	server.RegisterHandler("/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(w, `{"error":{"message":"overloaded","type":"server_error"}}`)
+	})
+
+	_, err := client.ListModels(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 APIError, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRetrySkipsClientErrors(t *testing.T) {
+	client, server, teardown := setupRetryTestServer(fastRetryPolicy(3))
+	defer teardown()
+
+	var attempts int32
+	server.RegisterHandler("/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(w, `{"error":{"message":"bad request","type":"invalid_request_error"}}`)
+	})
+
+	_, err := client.ListModels(context.Background())
+	checks.HasError(t, err, "ListModels should fail")
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestRetryStreamBeforeFirstByte(t *testing.T) {
+	client, server, teardown := setupRetryTestServer(fastRetryPolicy(2))
+	defer teardown()
+
+	var attempts int32
+	server.RegisterHandler("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		//nolint:lll
+		_, _ = io.WriteString(w, `data: {"id":"1","object":"completion","created":1598069254,"model":"gpt-3.5-turbo","choices":[{"index":0,"delta":{"content":"ok"}}]}`+"\n\ndata: [DONE]\n\n")
+	})
+
+	stream, err := client.CreateChatCompletionStream(context.Background(), ChatCompletionRequest{
+		Model:    GPT3Dot5Turbo,
+		Messages: []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "Hello!"}},
+	})
+	checks.NoError(t, err, "CreateChatCompletionStream error")
+	defer stream.Close()
+
+	resp, err := stream.Recv()
+	checks.NoError(t, err, "stream.Recv() error")
+	if resp.Choices[0].Delta.Content != "ok" {
+		t.Errorf("Unexpected stream response: %+v", resp)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestRetryStopsWhenContextIsCancelled(t *testing.T) {
+	client, server, teardown := setupRetryTestServer(RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour})
+	defer teardown()
+
+	server.RegisterHandler("/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.ListModels(ctx)
+	checks.ErrorIs(t, err, context.DeadlineExceeded, "ListModels should stop when the context is done")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Retry did not stop on context cancellation, took %s", elapsed)
+	}
+}
+
+func TestServerRetryDelay(t *testing.T) {
+	now := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name   string
+		status int
+		header http.Header
+		expect time.Duration
+		found  bool
+	}{
+		{"no headers", http.StatusTooManyRequests, http.Header{}, 0, false},
+		{"retry-after seconds", http.StatusServiceUnavailable, http.Header{"Retry-After": {"3"}}, 3 * time.Second, true},
+		{"retry-after date", http.StatusTooManyRequests,
+			http.Header{"Retry-After": {now.Add(2 * time.Second).Format(http.TimeFormat)}}, 2 * time.Second, true},
+		{"ratelimit reset", http.StatusTooManyRequests, http.Header{
+			"X-Ratelimit-Reset-Requests": {"120ms"},
+			"X-Ratelimit-Reset-Tokens":   {"6m0s"},
+		}, 6 * time.Minute, true},
+		{"ratelimit reset ignored on 5xx", http.StatusInternalServerError, http.Header{
+			"X-Ratelimit-Reset-Tokens": {"6m0s"},
+		}, 0, false},
+		{"retry-after wins over reset", http.StatusTooManyRequests, http.Header{
+			"Retry-After":              {"1"},
+			"X-Ratelimit-Reset-Tokens": {"20s"},
+		}, time.Second, true},
+		{"invalid values", http.StatusTooManyRequests,
+			http.Header{"Retry-After": {"soon"}, "X-Ratelimit-Reset-Tokens": {"later"}}, 0, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			delay, found := serverRetryDelay(c.header, c.status, now)
+			if delay != c.expect || found != c.found {
+				t.Errorf("Expected (%s, %v), got (%s, %v)", c.expect, c.found, delay, found)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     300 * time.Millisecond,
+		Multiplier:     2,
+	}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}
+	for i, want := range expected {
+		if got := policy.backoff(i+1, nil); got != want {
+			t.Errorf("attempt %d: expected %s, got %s", i+1, want, got)
+		}
+	}
+
+	// Delays requested by the server are used up to MaxDelay, beyond it the computed one is.
+	policy.MaxDelay = 5 * time.Second
+	rateLimited := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	rateLimited.Header.Set("Retry-After", "2")
+	if got := policy.backoff(1, rateLimited); got != 2*time.Second {
+		t.Errorf("expected the requested 2s, got %s", got)
+	}
+	rateLimited.Header.Set("Retry-After", "360")
+	if got := policy.backoff(1, rateLimited); got != 100*time.Millisecond {
+		t.Errorf("expected the computed 100ms for a delay over MaxDelay, got %s", got)
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		got := policy.backoff(1, nil)
+		if got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Fatalf("jittered backoff out of range: %s", got)
+		}
+	}
+}
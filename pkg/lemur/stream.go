@@ -3,12 +3,36 @@ package lemur
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 )
 
 var (
 	ErrTooManyEmptyStreamMessages = errors.New("stream has sent too many empty messages")
+	ErrStreamIdleTimeout          = errors.New("stream idle timeout exceeded")
+	ErrStreamTotalTimeout         = errors.New("stream total timeout exceeded")
 )
 
+// StreamTimeoutError is returned by Recv when a stream exceeds ClientConfig.StreamIdleTimeout
+// or ClientConfig.StreamTotalTimeout. It wraps ErrStreamIdleTimeout or ErrStreamTotalTimeout.
+type StreamTimeoutError struct {
+	Err   error
+	Limit time.Duration
+}
+
+func (e *StreamTimeoutError) Error() string {
+	return fmt.Sprintf("%s after %s", e.Err, e.Limit)
+}
+
+func (e *StreamTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports true, so the error satisfies net.Error style timeout checks.
+func (e *StreamTimeoutError) Timeout() bool {
+	return true
+}
+
 type CompletionStream struct {
 	*streamReader[CompletionResponse]
 }
@@ -22,7 +46,7 @@ func (c *Client) CreateCompletionStream(
 	request CompletionRequest,
 ) (stream *CompletionStream, err error) {
 	urlSuffix := "/completions"
-	if !checkEndpointSupportsModel(urlSuffix, request.Model) {
+	if !c.checkEndpointSupportsModel(urlSuffix, request.Model) {
 		err = ErrCompletionUnsupportedModel
 		return
 	}
@@ -33,6 +57,9 @@ func (c *Client) CreateCompletionStream(
 	}
 
 	request.Stream = true
+	if err = c.validateCompletionRequest(request); err != nil {
+		return
+	}
 	req, err := c.newRequest(ctx, "POST", c.fullURL(urlSuffix, request.Model), withBody(request))
 	if err != nil {
 		return nil, err
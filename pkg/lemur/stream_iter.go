@@ -0,0 +1,68 @@
+package lemur
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+)
+
+// All returns an iterator over the remaining chunks of the stream:
+//
+//	for chunk, err := range stream.All() {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// Iteration ends at the end of the stream, or after yielding the first error.
+// The stream is closed when iteration ends, including when the loop is exited early.
+func (stream *streamReader[T]) All() iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		defer stream.Close()
+		for {
+			chunk, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				yield(*new(T), err)
+				return
+			}
+			if !yield(chunk, nil) {
+				return
+			}
+		}
+	}
+}
+
+// StreamEvent is a chunk, or the error which ended the stream, delivered by Chan.
+type StreamEvent[T any] struct {
+	Chunk T
+	Err   error
+}
+
+// Chan returns a channel receiving the remaining chunks of the stream. The channel is closed
+// at the end of the stream, after an event carrying an error, or when ctx is done.
+// The stream is closed when the channel is closed; cancelling ctx also interrupts a pending read.
+// Callers which stop receiving before the channel is closed must cancel ctx.
+func (stream *streamReader[T]) Chan(ctx context.Context) <-chan StreamEvent[T] {
+	events := make(chan StreamEvent[T])
+	stop := context.AfterFunc(ctx, stream.Close)
+	go func() {
+		defer close(events)
+		defer stop()
+		for chunk, err := range stream.All() {
+			if err != nil && ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			select {
+			case events <- StreamEvent[T]{Chunk: chunk, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events
+}
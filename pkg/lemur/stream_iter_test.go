@@ -0,0 +1,163 @@
+package lemur_test
+
+import (
+	. "chatgpt-go/pkg/lemur"
+	"chatgpt-go/pkg/lemur/internal/test/checks"
+
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func chatStreamTestBody(n int) string {
+	body := ""
+	for i := 0; i < n; i++ {
+		//nolint:lll
+		body += fmt.Sprintf(`data: {"id":"%d","object":"chat.completion.chunk","created":1,"model":"gpt-3.5-turbo","choices":[{"index":0,"delta":{"content":"%d"}}]}`, i, i) + "\n\n"
+	}
+	return body + "data: [DONE]\n\n"
+}
+
+func createChatTestStream(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) (*ChatCompletionStream, func()) {
+	t.Helper()
+	client, server, teardown := setuplemurTestServer()
+	server.RegisterHandler("/v1/chat/completions", handler)
+	stream, err := client.CreateChatCompletionStream(context.Background(), ChatCompletionRequest{
+		Model:    GPT3Dot5Turbo,
+		Messages: []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "Hello!"}},
+	})
+	checks.NoError(t, err, "CreateChatCompletionStream error")
+	return stream, teardown
+}
+
+func TestChatCompletionStreamAll(t *testing.T) {
+	stream, teardown := createChatTestStream(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, chatStreamTestBody(3))
+	})
+	defer teardown()
+
+	content := ""
+	for chunk, err := range stream.All() {
+		checks.NoError(t, err, "iteration error")
+		content += chunk.Choices[0].Delta.Content
+	}
+	if content != "012" {
+		t.Errorf("Expected content 012, got %q", content)
+	}
+
+	_, err := stream.Recv()
+	checks.ErrorIs(t, err, io.EOF, "stream should be finished after iteration")
+}
+
+func TestChatCompletionStreamAllStopsEarly(t *testing.T) {
+	stalled := make(chan struct{})
+	stream, teardown := createChatTestStream(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `data: {"id":"0","choices":[{"index":0,"delta":{"content":"0"}}]}`+"\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-stalled:
+		case <-r.Context().Done():
+		}
+	})
+	defer teardown()
+	defer close(stalled)
+
+	for range stream.All() {
+		break
+	}
+
+	_, err := stream.Recv()
+	checks.HasError(t, err, "stream should be closed after breaking out of the loop")
+	if errors.Is(err, io.EOF) {
+		t.Errorf("Expected a read error on the closed body, got EOF")
+	}
+}
+
+func TestChatCompletionStreamAllYieldsError(t *testing.T) {
+	stream, teardown := createChatTestStream(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "data: {\"id\":\n\n")
+	})
+	defer teardown()
+
+	var errs []error
+	for _, err := range stream.All() {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || errs[0] == nil {
+		t.Errorf("Expected a single error, got %v", errs)
+	}
+}
+
+func TestCompletionStreamAll(t *testing.T) {
+	client, server, teardown := setuplemurTestServer()
+	defer teardown()
+	server.RegisterHandler("/v1/completions", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `data: {"id":"1","choices":[{"text":"a"}]}`+"\n\n"+
+			`data: {"id":"2","choices":[{"text":"b"}]}`+"\n\ndata: [DONE]\n\n")
+	})
+
+	stream, err := client.CreateCompletionStream(context.Background(), CompletionRequest{
+		Model:  GPT3Ada,
+		Prompt: "Hello",
+	})
+	checks.NoError(t, err, "CreateCompletionStream error")
+
+	text := ""
+	for chunk, err := range stream.All() {
+		checks.NoError(t, err, "iteration error")
+		text += chunk.Choices[0].Text
+	}
+	if text != "ab" {
+		t.Errorf("Expected text ab, got %q", text)
+	}
+}
+
+func TestChatCompletionStreamChan(t *testing.T) {
+	stream, teardown := createChatTestStream(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, chatStreamTestBody(3))
+	})
+	defer teardown()
+
+	content := ""
+	for event := range stream.Chan(context.Background()) {
+		checks.NoError(t, event.Err, "stream event error")
+		content += event.Chunk.Choices[0].Delta.Content
+	}
+	if content != "012" {
+		t.Errorf("Expected content 012, got %q", content)
+	}
+}
+
+func TestChatCompletionStreamChanCancel(t *testing.T) {
+	stalled := make(chan struct{})
+	stream, teardown := createChatTestStream(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `data: {"id":"0","choices":[{"index":0,"delta":{"content":"0"}}]}`+"\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-stalled:
+		case <-r.Context().Done():
+		}
+	})
+	defer teardown()
+	defer close(stalled)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := stream.Chan(ctx)
+
+	event := <-events
+	checks.NoError(t, event.Err, "first event error")
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		for ok {
+			_, ok = <-events
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel was not closed after the context was cancelled")
+	}
+}
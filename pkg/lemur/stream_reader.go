@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	utils "chatgpt-go/pkg/lemur/internal"
 )
@@ -13,20 +15,39 @@ import (
 var (
 	headerData  = []byte("data: ")
 	errorPrefix = []byte(`data: {"error":`)
+	doneData    = []byte("[DONE]")
 )
 
 type streamable interface {
-	ChatCompletionStreamResponse | CompletionResponse
+	ChatCompletionStreamResponse | CompletionResponse | LemurResponseSEC
+}
+
+// frameDecoder turns the payload of a "data:" line into the frames it carries.
+// A frame is either a JSON object to unmarshal or the [DONE] marker.
+type frameDecoder func(data []byte, unmarshaler utils.Unmarshaler) ([][]byte, error)
+
+// decodeSingleFrame is the default frameDecoder: every data line is one frame.
+func decodeSingleFrame(data []byte, _ utils.Unmarshaler) ([][]byte, error) {
+	return [][]byte{data}, nil
 }
 
 type streamReader[T streamable] struct {
+	ResponseMetadata
+
 	emptyMessagesLimit uint
 	isFinished         bool
 
+	idleTimeout time.Duration
+	idleTimer   *time.Timer
+	totalTimer  *time.Timer
+	timeoutErr  atomic.Pointer[StreamTimeoutError]
+
 	reader         *bufio.Reader
 	response       *http.Response
 	errAccumulator utils.ErrorAccumulator
 	unmarshaler    utils.Unmarshaler
+	decodeFrames   frameDecoder
+	pendingFrames  [][]byte
 }
 
 func (stream *streamReader[T]) Recv() (response T, err error) {
@@ -47,7 +68,13 @@ func (stream *streamReader[T]) processLines() (T, error) {
 	)
 
 	for {
-		rawLine, readErr := stream.reader.ReadBytes('\n')
+		if len(stream.pendingFrames) > 0 {
+			frame := stream.pendingFrames[0]
+			stream.pendingFrames = stream.pendingFrames[1:]
+			return stream.processFrame(frame)
+		}
+
+		rawLine, readErr := stream.readLine()
 		if readErr != nil || hasErrorPrefix {
 			respErr := stream.unmarshalError()
 			if respErr != nil {
@@ -77,19 +104,68 @@ func (stream *streamReader[T]) processLines() (T, error) {
 		}
 
 		noPrefixLine := bytes.TrimPrefix(noSpaceLine, headerData)
-		if string(noPrefixLine) == "[DONE]" {
-			stream.isFinished = true
-			return *new(T), io.EOF
+		if bytes.Equal(noPrefixLine, doneData) {
+			return stream.processFrame(noPrefixLine)
+		}
+
+		decodeFrames := stream.decodeFrames
+		if decodeFrames == nil {
+			decodeFrames = decodeSingleFrame
+		}
+		frames, decodeErr := decodeFrames(noPrefixLine, stream.unmarshaler)
+		if decodeErr != nil {
+			return *new(T), decodeErr
+		}
+		if len(frames) == 0 {
+			emptyMessagesCount++
+			if emptyMessagesCount > stream.emptyMessagesLimit {
+				return *new(T), ErrTooManyEmptyStreamMessages
+			}
+			continue
 		}
+		stream.pendingFrames = frames
+	}
+}
+
+// readLine reads the next line of the stream, closing the response body
+// if it takes longer than the idle timeout.
+func (stream *streamReader[T]) readLine() ([]byte, error) {
+	if stream.idleTimer != nil {
+		stream.idleTimer.Reset(stream.idleTimeout)
+	}
 
-		var response T
-		unmarshalErr := stream.unmarshaler.Unmarshal(noPrefixLine, &response)
-		if unmarshalErr != nil {
-			return *new(T), unmarshalErr
+	line, err := stream.reader.ReadBytes('\n')
+	if stream.idleTimer != nil {
+		stream.idleTimer.Stop()
+	}
+	if err != nil {
+		if timeoutErr := stream.timeoutErr.Load(); timeoutErr != nil {
+			return nil, timeoutErr
 		}
+	}
+	return line, err
+}
 
-		return response, nil
+// expire records the first timeout to fire and interrupts any pending read.
+func (stream *streamReader[T]) expire(err error, limit time.Duration) {
+	stream.timeoutErr.CompareAndSwap(nil, &StreamTimeoutError{Err: err, Limit: limit})
+	stream.response.Body.Close()
+}
+
+func (stream *streamReader[T]) processFrame(frame []byte) (T, error) {
+	if bytes.Equal(frame, doneData) {
+		stream.isFinished = true
+		stream.pendingFrames = nil
+		return *new(T), io.EOF
+	}
+
+	var response T
+	unmarshalErr := stream.unmarshaler.Unmarshal(frame, &response)
+	if unmarshalErr != nil {
+		return *new(T), unmarshalErr
 	}
+
+	return response, nil
 }
 
 func (stream *streamReader[T]) unmarshalError() (errResp *ErrorResponse) {
@@ -107,5 +183,11 @@ func (stream *streamReader[T]) unmarshalError() (errResp *ErrorResponse) {
 }
 
 func (stream *streamReader[T]) Close() {
+	if stream.idleTimer != nil {
+		stream.idleTimer.Stop()
+	}
+	if stream.totalTimer != nil {
+		stream.totalTimer.Stop()
+	}
 	stream.response.Body.Close()
 }
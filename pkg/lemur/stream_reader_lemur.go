@@ -1,24 +1,13 @@
 package lemur
 
 import (
-	"bufio"
 	"bytes"
 	utils "chatgpt-go/pkg/lemur/internal"
 	"fmt"
-	"io"
-	"net/http"
-	"strings"
 )
 
-type streamReaderLemur struct {
-	emptyMessagesLimit uint
-	isFinished         bool
-
-	reader         *bufio.Reader
-	response       *http.Response
-	errAccumulator utils.ErrorAccumulator
-	unmarshaler    utils.Unmarshaler
-}
+// LemurResponseST is the envelope of every Lemur stream line. Data holds one or
+// more server-sent events, each one carrying a LemurResponseSEC.
 type LemurResponseST struct {
 	Origin string `json:"origin"`
 	Data   string `json:"data"`
@@ -34,7 +23,7 @@ type LemurResponseSEC struct {
 type LemurResponseSecChoice struct {
 	Index        int                         `json:"index"`
 	Delta        LemurResponseSecChoiceDelta `json:"delta"`
-	FinishReason any                         `json:"finish_reason"`
+	FinishReason FinishReason                `json:"finish_reason"`
 }
 
 type LemurResponseSecChoiceDelta struct {
@@ -42,127 +31,41 @@ type LemurResponseSecChoiceDelta struct {
 	Content string `json:"content"`
 }
 
-var (
-	headerDataLemur  = []byte("data: ")
-	errorPrefixLemur = []byte(`data: {"error":`)
-)
-
-func (stream *streamReaderLemur) Recv() (response LemurResponseSEC, err error) {
-	if stream.isFinished {
-		err = io.EOF
-		return
-	}
-
-	response, err = stream.processLines()
-	return
+// LemurError is returned when a Lemur stream envelope carries a non-zero code.
+type LemurError struct {
+	Code    int
+	Origin  string
+	Message string
 }
 
-//nolint:gocognit
-func (stream *streamReaderLemur) processLines() (LemurResponseSEC, error) {
-	var (
-		emptyMessagesCount uint
-		hasErrorPrefix     bool
-	)
-
-	for {
-		rawLine, readErr := stream.reader.ReadBytes('\n')
-
-		if readErr != nil || hasErrorPrefix {
-			respErr := stream.unmarshalError()
-			if respErr != nil {
-				return *new(LemurResponseSEC), fmt.Errorf("respErr.Error, %w", respErr.Error)
-			}
-			return *new(LemurResponseSEC), fmt.Errorf("readErr, %w", readErr)
-		}
-
-		noSpaceLine := bytes.TrimSpace(rawLine)
-		if bytes.HasPrefix(noSpaceLine, errorPrefixLemur) {
-			hasErrorPrefix = true
-		}
-		if !bytes.HasPrefix(noSpaceLine, headerDataLemur) || hasErrorPrefix {
-			if hasErrorPrefix {
-				noSpaceLine = bytes.TrimPrefix(noSpaceLine, headerData)
-			}
-			writeErr := stream.errAccumulator.Write(noSpaceLine)
-			if writeErr != nil {
-				return *new(LemurResponseSEC), fmt.Errorf("error, %w", writeErr)
-			}
-			emptyMessagesCount++
-			if emptyMessagesCount > stream.emptyMessagesLimit {
-				return *new(LemurResponseSEC), ErrTooManyEmptyStreamMessages
-			}
-
-			continue
-		}
-
-		noPrefixLine := bytes.TrimPrefix(noSpaceLine, headerDataLemur)
-		if string(noPrefixLine) == "[DONE]" {
-			stream.isFinished = true
-			return *new(LemurResponseSEC), io.EOF
-		}
-
-		var responseST LemurResponseST
-
-		unmarshalErr := stream.unmarshaler.Unmarshal(noPrefixLine, &responseST)
-		if unmarshalErr != nil {
-			return *new(LemurResponseSEC), unmarshalErr
-		}
-
-		// if responseST.Code != 0 {
-		// 	return *new(LemurResponseSEC), fmt.Errorf(" responseST.Code=%d", responseST.Code)
-		// }
-		responseSec := LemurResponseSEC{
-			Choices: []LemurResponseSecChoice{
-				{
-					Delta: LemurResponseSecChoiceDelta{
-						Content: "",
-					},
-				},
-			},
-		}
-		for _, v := range strings.Split(responseST.Data, "\n\n") {
-			if len(v) == 0 {
-				continue
-			}
-			var responseSecTmp LemurResponseSEC
-			noPrefixLine02 := bytes.TrimPrefix([]byte(v), headerDataLemur)
-			err := stream.unmarshaler.Unmarshal(noPrefixLine02, &responseSecTmp)
-			if err != nil {
-				continue
-			}
-			responseSec.ID = responseSecTmp.ID
-			responseSec.Object = responseSecTmp.Object
-			responseSec.Created = responseSecTmp.Created
-			responseSec.Model = responseSecTmp.Model
-
-			if len(responseSecTmp.Choices) > 0 {
-				for _, v := range responseSecTmp.Choices {
-					responseSec.Choices[0].Delta.Content = responseSec.Choices[0].Delta.Content + v.Delta.Content
-				}
-			}
-
-		}
-
-		// fmt.Println("stream_reader_lemur.go/responseST=", responseSec)
-
-		return responseSec, nil
-	}
+func (e *LemurError) Error() string {
+	return fmt.Sprintf("lemur error, code: %d, message: %s", e.Code, e.Message)
 }
 
-func (stream *streamReaderLemur) unmarshalError() (errResp *ErrorResponse) {
-	errBytes := stream.errAccumulator.Bytes()
-	if len(errBytes) == 0 {
-		return
-	}
-
-	err := stream.unmarshaler.Unmarshal(errBytes, &errResp)
+// decodeLemurFrames unwraps a LemurResponseST envelope into the events of its Data field,
+// one per line, with or without a "data:" prefix.
+func decodeLemurFrames(data []byte, unmarshaler utils.Unmarshaler) ([][]byte, error) {
+	var envelope LemurResponseST
+	err := unmarshaler.Unmarshal(data, &envelope)
 	if err != nil {
-		errResp = nil
+		return nil, err
 	}
 
-	return
-}
+	if envelope.Code != 0 {
+		return nil, &LemurError{
+			Code:    envelope.Code,
+			Origin:  envelope.Origin,
+			Message: envelope.Data,
+		}
+	}
 
-func (stream *streamReaderLemur) Close() {
-	stream.response.Body.Close()
+	// Events are usually "data: " lines, but some envelopes carry bare JSON events.
+	var frames [][]byte
+	for _, line := range bytes.Split([]byte(envelope.Data), []byte("\n")) {
+		frame := bytes.TrimSpace(bytes.TrimPrefix(bytes.TrimSpace(line), []byte("data:")))
+		if len(frame) > 0 {
+			frames = append(frames, frame)
+		}
+	}
+	return frames, nil
 }
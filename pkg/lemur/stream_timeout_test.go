@@ -0,0 +1,111 @@
+package lemur_test
+
+import (
+	. "chatgpt-go/pkg/lemur"
+	"chatgpt-go/pkg/lemur/internal/test"
+	"chatgpt-go/pkg/lemur/internal/test/checks"
+
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func createTimeoutTestStream(
+	t *testing.T,
+	idle, total time.Duration,
+	handler func(w http.ResponseWriter, r *http.Request),
+) (*ChatCompletionStream, func()) {
+	t.Helper()
+	server := test.NewTestServer()
+	server.RegisterHandler("/v1/chat/completions", handler)
+	ts := server.LemurTestServer()
+	ts.Start()
+
+	config := DefaultConfig(test.GetTestToken())
+	config.BaseURL = ts.URL + "/v1"
+	config.StreamIdleTimeout = idle
+	config.StreamTotalTimeout = total
+	client := NewClientWithConfig(config)
+
+	stream, err := client.CreateChatCompletionStream(context.Background(), ChatCompletionRequest{
+		Model:    GPT3Dot5Turbo,
+		Messages: []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "Hello!"}},
+	})
+	checks.NoError(t, err, "CreateChatCompletionStream error")
+	return stream, ts.Close
+}
+
+// stallingHandler writes one chunk every interval, for count chunks, then stalls until the request is done.
+func stallingHandler(interval time.Duration, count int) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < count; i++ {
+			_, _ = io.WriteString(w, `data: {"id":"1","choices":[{"index":0,"delta":{"content":"a"}}]}`+"\n\n")
+			w.(http.Flusher).Flush()
+			select {
+			case <-time.After(interval):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		<-r.Context().Done()
+	}
+}
+
+func TestStreamIdleTimeout(t *testing.T) {
+	stream, teardown := createTimeoutTestStream(t, 50*time.Millisecond, 0, stallingHandler(0, 1))
+	defer teardown()
+	defer stream.Close()
+
+	_, err := stream.Recv()
+	checks.NoError(t, err, "first chunk should be received")
+
+	_, err = stream.Recv()
+	checks.ErrorIs(t, err, ErrStreamIdleTimeout, "stalled stream should hit the idle timeout")
+	var timeoutErr *StreamTimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Limit != 50*time.Millisecond || !timeoutErr.Timeout() {
+		t.Errorf("Expected a StreamTimeoutError with a 50ms limit, got %v", err)
+	}
+
+	_, err = stream.Recv()
+	checks.ErrorIs(t, err, ErrStreamIdleTimeout, "timeout error should be sticky")
+}
+
+func TestStreamIdleTimeoutNotExceeded(t *testing.T) {
+	stream, teardown := createTimeoutTestStream(t, time.Second, 0, func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			_, _ = io.WriteString(w, `data: {"id":"1","choices":[{"index":0,"delta":{"content":"a"}}]}`+"\n\n")
+			w.(http.Flusher).Flush()
+			time.Sleep(10 * time.Millisecond)
+		}
+		_, _ = io.WriteString(w, "data: [DONE]\n\n")
+	})
+	defer teardown()
+
+	count := 0
+	for _, err := range stream.All() {
+		checks.NoError(t, err, "stream error")
+		count++
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 chunks, got %d", count)
+	}
+}
+
+func TestStreamTotalTimeout(t *testing.T) {
+	stream, teardown := createTimeoutTestStream(t, time.Second, 100*time.Millisecond,
+		stallingHandler(20*time.Millisecond, 100))
+	defer teardown()
+	defer stream.Close()
+
+	var err error
+	for err == nil {
+		_, err = stream.Recv()
+	}
+	checks.ErrorIs(t, err, ErrStreamTotalTimeout, "stream should hit the total timeout")
+	if errors.Is(err, ErrStreamIdleTimeout) {
+		t.Errorf("Chunks arrive faster than the idle timeout, got %v", err)
+	}
+}
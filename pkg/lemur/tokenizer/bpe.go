@@ -0,0 +1,65 @@
+package tokenizer
+
+import "math"
+
+// bytePairMerge encodes a single pre-tokenized piece. Starting from single bytes, the adjacent
+// pair with the lowest rank is merged until no mergeable pair is left, like tiktoken does.
+func bytePairMerge(piece string, ranks map[string]int) []int {
+	if rank, ok := ranks[piece]; ok {
+		return []int{rank}
+	}
+
+	type part struct {
+		start int
+		rank  int
+	}
+	// parts holds the start of every current token, plus the end of the piece.
+	parts := make([]part, len(piece)+1)
+	for i := range parts {
+		parts[i] = part{start: i, rank: math.MaxInt}
+	}
+
+	// pairRank returns the rank of the token made of parts[i] and parts[i+1].
+	pairRank := func(i int) int {
+		if i+2 >= len(parts) {
+			return math.MaxInt
+		}
+		if rank, ok := ranks[piece[parts[i].start:parts[i+2].start]]; ok {
+			return rank
+		}
+		return math.MaxInt
+	}
+	for i := 0; i < len(parts)-2; i++ {
+		parts[i].rank = pairRank(i)
+	}
+
+	for len(parts) > 2 {
+		minIndex, minRank := -1, math.MaxInt
+		for i, p := range parts[:len(parts)-2] {
+			if p.rank < minRank {
+				minIndex, minRank = i, p.rank
+			}
+		}
+		if minIndex < 0 {
+			break
+		}
+
+		parts = append(parts[:minIndex+1], parts[minIndex+2:]...)
+		parts[minIndex].rank = pairRank(minIndex)
+		if minIndex > 0 {
+			parts[minIndex-1].rank = pairRank(minIndex - 1)
+		}
+	}
+
+	tokens := make([]int, 0, len(parts)-1)
+	for i := 0; i < len(parts)-1; i++ {
+		rank, ok := ranks[piece[parts[i].start:parts[i+1].start]]
+		if !ok {
+			// Every single byte is a token in the supported encodings, so this can
+			// only happen with a broken rank table.
+			panic("tokenizer: no rank for byte sequence")
+		}
+		tokens = append(tokens, rank)
+	}
+	return tokens
+}
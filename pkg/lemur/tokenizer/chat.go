@@ -0,0 +1,123 @@
+package tokenizer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// modelEncodings maps models to the name of their encoding.
+var modelEncodings = map[string]string{
+	"gpt-4":                  CL100KBase,
+	"gpt-3.5-turbo":          CL100KBase,
+	"gpt-35-turbo":           CL100KBase,
+	"davinci-002":            CL100KBase,
+	"babbage-002":            CL100KBase,
+	"text-embedding-ada-002": CL100KBase,
+	"text-davinci-003":       P50KBase,
+	"text-davinci-002":       P50KBase,
+	"code-davinci-002":       P50KBase,
+	"code-davinci-001":       P50KBase,
+	"code-cushman-002":       P50KBase,
+	"code-cushman-001":       P50KBase,
+	"davinci-codex":          P50KBase,
+	"cushman-codex":          P50KBase,
+}
+
+// modelPrefixEncodings maps model families to the name of their encoding.
+var modelPrefixEncodings = []struct {
+	prefix   string
+	encoding string
+}{
+	{"gpt-4-", CL100KBase},
+	{"gpt-3.5-turbo-", CL100KBase},
+	{"gpt-35-turbo-", CL100KBase},
+	{"text-embedding-3-", CL100KBase},
+}
+
+// ForModel returns the encoding used by model. Fine-tuned models ("ft:gpt-3.5-turbo:...")
+// use the encoding of their base model.
+func ForModel(model string) (*Encoding, error) {
+	base := baseModel(model)
+	if name, ok := modelEncodings[base]; ok {
+		return Get(name)
+	}
+	for _, family := range modelPrefixEncodings {
+		if strings.HasPrefix(base, family.prefix) {
+			return Get(family.encoding)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownModel, model)
+}
+
+func baseModel(model string) string {
+	if rest, ok := strings.CutPrefix(model, "ft:"); ok {
+		base, _, _ := strings.Cut(rest, ":")
+		return base
+	}
+	return model
+}
+
+// Message is the part of a chat message which counts towards the prompt.
+type Message struct {
+	Role    string
+	Name    string
+	Content string
+	// FunctionName and FunctionArguments hold the function call of an assistant message.
+	FunctionName      string
+	FunctionArguments string
+}
+
+// chatFormat is the per-message overhead of a chat model family.
+type chatFormat struct {
+	prefix string
+	// perMessage is added for every message, perName when the message has a name.
+	perMessage int
+	perName    int
+}
+
+// chatFormats holds the chat model families, the most specific first.
+var chatFormats = []chatFormat{
+	{"gpt-3.5-turbo-0301", 4, -1},
+	{"gpt-35-turbo-0301", 4, -1},
+	{"gpt-3.5-turbo", 3, 1},
+	{"gpt-35-turbo", 3, 1},
+	{"gpt-4", 3, 1},
+}
+
+// replyPriming is the number of tokens every reply is primed with (<|start|>assistant<|message|>).
+const replyPriming = 3
+
+// CountMessages returns the number of prompt tokens used by messages with a chat model,
+// following the counting rules OpenAI publishes for each model family.
+// Function calls are counted as their name and arguments, which is an estimate;
+// function definitions sent with the request are not counted.
+func CountMessages(model string, messages []Message) (int, error) {
+	base := baseModel(model)
+	for _, format := range chatFormats {
+		if !strings.HasPrefix(base, format.prefix) {
+			continue
+		}
+		encoding, err := ForModel(model)
+		if err != nil {
+			return 0, err
+		}
+		return countMessages(encoding, format, messages), nil
+	}
+	return 0, fmt.Errorf("%w: %s is not a chat model", ErrUnknownModel, model)
+}
+
+func countMessages(encoding *Encoding, format chatFormat, messages []Message) int {
+	count := replyPriming
+	for _, message := range messages {
+		count += format.perMessage
+		count += encoding.Count(message.Role)
+		count += encoding.Count(message.Content)
+		if message.Name != "" {
+			count += encoding.Count(message.Name) + format.perName
+		}
+		if message.FunctionName != "" || message.FunctionArguments != "" {
+			count += encoding.Count(message.FunctionName) + encoding.Count(message.FunctionArguments)
+		}
+	}
+	return count
+}
@@ -0,0 +1,80 @@
+package tokenizer //nolint:testpackage // testing private functions
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCountMessagesFormats(t *testing.T) {
+	e := testEncoding(t)
+	messages := []Message{
+		{Role: "system", Content: "hello"},
+		{Role: "user", Name: "ab", Content: "hello world"},
+		{Role: "assistant", FunctionName: "cd", FunctionArguments: "{}"},
+	}
+	// Content tokens: system 6 + hello 1, user 4 + name 1 + 2, assistant 9 + function 1 + 2.
+	const content = 6 + 1 + 4 + 1 + 2 + 9 + 1 + 2
+
+	if got, want := countMessages(e, chatFormats[2], messages), replyPriming+3*3+content+1; got != want {
+		t.Errorf("gpt-3.5-turbo count = %d, want %d", got, want)
+	}
+	if got, want := countMessages(e, chatFormats[0], messages), replyPriming+3*4+content-1; got != want {
+		t.Errorf("gpt-3.5-turbo-0301 count = %d, want %d", got, want)
+	}
+}
+
+func TestCountMessagesUnknownModel(t *testing.T) {
+	for _, model := range []string{"text-davinci-003", "whisper-1", ""} {
+		if _, err := CountMessages(model, nil); !errors.Is(err, ErrUnknownModel) {
+			t.Errorf("Expected ErrUnknownModel for %q, got %v", model, err)
+		}
+	}
+}
+
+func TestForModel(t *testing.T) {
+	tests := []struct {
+		model    string
+		encoding string
+	}{
+		{"gpt-4", CL100KBase},
+		{"gpt-4-32k-0613", CL100KBase},
+		{"gpt-3.5-turbo-16k", CL100KBase},
+		{"ft:gpt-3.5-turbo-0613:org::abc123", CL100KBase},
+		{"text-embedding-ada-002", CL100KBase},
+		{"text-davinci-003", P50KBase},
+		{"code-davinci-002", P50KBase},
+	}
+	for _, tt := range tests {
+		e, err := ForModel(tt.model)
+		if errors.Is(err, ErrEncodingNotEmbedded) {
+			continue
+		}
+		if err != nil {
+			t.Errorf("ForModel(%s) error: %v", tt.model, err)
+			continue
+		}
+		if e.Name() != tt.encoding {
+			t.Errorf("ForModel(%s) = %s, want %s", tt.model, e.Name(), tt.encoding)
+		}
+	}
+
+	if _, err := ForModel("text-davinci-001"); !errors.Is(err, ErrUnknownModel) {
+		t.Errorf("Expected ErrUnknownModel, got %v", err)
+	}
+}
+
+func TestCountMessagesGolden(t *testing.T) {
+	e := embeddedEncoding(t, CL100KBase)
+	messages := []Message{
+		{Role: "system", Content: "You are a helpful assistant."},
+		{Role: "user", Name: "example_user", Content: "hello world"},
+	}
+	want := replyPriming + 2*3 + 1
+	for _, m := range messages {
+		want += len(e.Encode(m.Role)) + len(e.Encode(m.Content)) + len(e.Encode(m.Name))
+	}
+	got, err := CountMessages("gpt-4-0613", messages)
+	if err != nil || got != want {
+		t.Errorf("CountMessages = %d, %v, want %d", got, err, want)
+	}
+}
@@ -0,0 +1,121 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:generate go run gen.go
+
+// data holds the rank files of the encodings, gzipped. They are written by gen.go.
+//
+//go:embed data
+var data embed.FS
+
+// ErrEncodingNotEmbedded is returned by Get when the rank file of a known encoding is missing
+// from the data directory, which happens when gen.go wasn't run before committing.
+var ErrEncodingNotEmbedded = errors.New("encoding data is not embedded, run go generate in pkg/lemur/tokenizer")
+
+type encodingSpec struct {
+	name    string
+	file    string
+	special map[string]int
+	split   func(string) []string
+	// vocabSize is the expected number of tokens, special tokens included, or 0 if unchecked.
+	vocabSize int
+}
+
+var encodings = map[string]func() (*Encoding, error){
+	CL100KBase: sync.OnceValues(func() (*Encoding, error) {
+		return loadEncoding(encodingSpec{
+			name: CL100KBase,
+			file: "data/cl100k_base.tiktoken.gz",
+			special: map[string]int{
+				EndOfText:   100257,
+				FIMPrefix:   100258,
+				FIMMiddle:   100259,
+				FIMSuffix:   100260,
+				EndOfPrompt: 100276,
+			},
+			split: splitCL100K,
+		})
+	}),
+	P50KBase: sync.OnceValues(func() (*Encoding, error) {
+		return loadEncoding(encodingSpec{
+			name:      P50KBase,
+			file:      "data/p50k_base.tiktoken.gz",
+			special:   map[string]int{EndOfText: 50256},
+			split:     splitP50K,
+			vocabSize: 50281,
+		})
+	}),
+}
+
+// Get returns the encoding with the given name. Encodings are loaded on first use.
+func Get(name string) (*Encoding, error) {
+	load, ok := encodings[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEncoding, name)
+	}
+	return load()
+}
+
+func loadEncoding(spec encodingSpec) (*Encoding, error) {
+	compressed, err := data.ReadFile(spec.file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrEncodingNotEmbedded, spec.name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", spec.file, err)
+	}
+	ranks, err := parseRanks(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", spec.file, err)
+	}
+	if spec.vocabSize > 0 && len(ranks)+len(spec.special) != spec.vocabSize {
+		return nil, fmt.Errorf("encoding %s has %d tokens, expected %d",
+			spec.name, len(ranks)+len(spec.special), spec.vocabSize)
+	}
+	return newEncoding(spec.name, ranks, spec.special, spec.split)
+}
+
+// parseRanks reads a rank file in the tiktoken format, made of "<base64 token> <rank>" lines.
+func parseRanks(r io.Reader) (map[string]int, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" {
+			continue
+		}
+		encoded, rankText, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing rank", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rank, err := strconv.Atoi(rankText)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		ranks[string(token)] = rank
+	}
+	return ranks, scanner.Err()
+}
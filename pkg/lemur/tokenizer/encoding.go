@@ -0,0 +1,148 @@
+// Package tokenizer is an offline byte pair encoding tokenizer compatible with the
+// cl100k_base and p50k_base encodings of tiktoken. The encodings are embedded in the
+// binary, so counting tokens never needs network access.
+package tokenizer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrUnknownEncoding = errors.New("unknown encoding")
+	ErrUnknownModel    = errors.New("no encoding is known for this model")
+	ErrUnknownToken    = errors.New("unknown token")
+)
+
+// Encoding names.
+const (
+	CL100KBase = "cl100k_base"
+	P50KBase   = "p50k_base"
+)
+
+// Special tokens.
+const (
+	EndOfText   = "<|endoftext|>"
+	FIMPrefix   = "<|fim_prefix|>"
+	FIMMiddle   = "<|fim_middle|>"
+	FIMSuffix   = "<|fim_suffix|>"
+	EndOfPrompt = "<|endofprompt|>"
+)
+
+// Encoding turns text into tokens and back. It is safe for concurrent use.
+type Encoding struct {
+	name          string
+	ranks         map[string]int
+	decoder       map[int]string
+	special       map[string]int
+	specialTokens map[int]string
+	split         func(string) []string
+}
+
+func newEncoding(name string, ranks, special map[string]int, split func(string) []string) (*Encoding, error) {
+	for b := 0; b < 256; b++ {
+		if _, ok := ranks[string([]byte{byte(b)})]; !ok {
+			return nil, fmt.Errorf("encoding %s has no token for byte %#x", name, b)
+		}
+	}
+
+	e := &Encoding{
+		name:          name,
+		ranks:         ranks,
+		decoder:       make(map[int]string, len(ranks)),
+		special:       special,
+		specialTokens: make(map[int]string, len(special)),
+		split:         split,
+	}
+	for piece, rank := range ranks {
+		if _, ok := e.decoder[rank]; ok {
+			return nil, fmt.Errorf("encoding %s has duplicate rank %d", name, rank)
+		}
+		e.decoder[rank] = piece
+	}
+	for text, rank := range special {
+		if _, ok := e.decoder[rank]; ok {
+			return nil, fmt.Errorf("encoding %s has special token %s with a used rank %d", name, text, rank)
+		}
+		e.specialTokens[rank] = text
+	}
+	return e, nil
+}
+
+// Name returns the name of the encoding, such as cl100k_base.
+func (e *Encoding) Name() string {
+	return e.name
+}
+
+// Encode returns the tokens of text. Special tokens in text are encoded as plain text.
+func (e *Encoding) Encode(text string) []int {
+	var tokens []int
+	for _, piece := range e.split(text) {
+		tokens = append(tokens, bytePairMerge(piece, e.ranks)...)
+	}
+	return tokens
+}
+
+// EncodeWithSpecialTokens returns the tokens of text, encoding special tokens such as
+// <|endoftext|> as their own token.
+func (e *Encoding) EncodeWithSpecialTokens(text string) []int {
+	var tokens []int
+	for text != "" {
+		start, special := e.nextSpecialToken(text)
+		if start < 0 {
+			break
+		}
+		tokens = append(tokens, e.Encode(text[:start])...)
+		tokens = append(tokens, e.special[special])
+		text = text[start+len(special):]
+	}
+	return append(tokens, e.Encode(text)...)
+}
+
+// nextSpecialToken returns the position and text of the first special token in text,
+// preferring the longest at the same position, or -1.
+func (e *Encoding) nextSpecialToken(text string) (int, string) {
+	start, found := -1, ""
+	for special := range e.special {
+		i := strings.Index(text, special)
+		if i < 0 {
+			continue
+		}
+		if start < 0 || i < start || (i == start && len(special) > len(found)) {
+			start, found = i, special
+		}
+	}
+	return start, found
+}
+
+// Count returns the number of tokens of text, encoding special tokens as plain text.
+func (e *Encoding) Count(text string) int {
+	count := 0
+	for _, piece := range e.split(text) {
+		if _, ok := e.ranks[piece]; ok {
+			count++
+			continue
+		}
+		count += len(bytePairMerge(piece, e.ranks))
+	}
+	return count
+}
+
+// Decode returns the text of tokens. A token can end in the middle of a multi-byte
+// character, so decoding only part of a token list may give invalid UTF-8.
+func (e *Encoding) Decode(tokens []int) (string, error) {
+	var b strings.Builder
+	for _, token := range tokens {
+		if piece, ok := e.decoder[token]; ok {
+			b.WriteString(piece)
+			continue
+		}
+		if special, ok := e.specialTokens[token]; ok {
+			b.WriteString(special)
+			continue
+		}
+		return "", fmt.Errorf("%w: %d", ErrUnknownToken, token)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,225 @@
+package tokenizer //nolint:testpackage // testing private functions
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testEncoding returns a small encoding made of every single byte and a few merges.
+func testEncoding(tb testing.TB) *Encoding {
+	tb.Helper()
+	ranks := make(map[string]int)
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	merges := []string{"ab", "cd", "abcd", "he", "ll", "hell", "hello", " w", "or", " wor", "ld", " world"}
+	for i, merge := range merges {
+		ranks[merge] = 256 + i
+	}
+	e, err := newEncoding("test", ranks, map[string]int{EndOfText: 1000}, splitCL100K)
+	if err != nil {
+		tb.Fatalf("newEncoding error: %v", err)
+	}
+	return e
+}
+
+// embeddedEncoding returns an embedded encoding. A build without the generated data can't count
+// tokens, so the test fails rather than skips.
+func embeddedEncoding(tb testing.TB, name string) *Encoding {
+	tb.Helper()
+	e, err := Get(name)
+	if errors.Is(err, ErrEncodingNotEmbedded) {
+		tb.Fatalf("%s is not embedded, run go generate ./pkg/lemur/tokenizer and commit the data", name)
+	}
+	if err != nil {
+		tb.Fatalf("Get(%s) error: %v", name, err)
+	}
+	return e
+}
+
+func TestBytePairMerge(t *testing.T) {
+	e := testEncoding(t)
+	tests := []struct {
+		piece string
+		want  []int
+	}{
+		{"hello", []int{262}},
+		{"hellos", []int{262, 's'}},
+		{"abcde", []int{258, 'e'}},
+		{"xyz", []int{'x', 'y', 'z'}},
+		{"a", []int{'a'}},
+	}
+	for _, tt := range tests {
+		if got := bytePairMerge(tt.piece, e.ranks); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("bytePairMerge(%q) = %v, want %v", tt.piece, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	e := testEncoding(t)
+
+	tokens := e.Encode("hello world")
+	if !reflect.DeepEqual(tokens, []int{262, 267}) {
+		t.Errorf("Unexpected tokens %v", tokens)
+	}
+	if count := e.Count("hello world"); count != 2 {
+		t.Errorf("Expected 2 tokens, got %d", count)
+	}
+
+	text := "hello wörld, 你好 <|endoftext|>"
+	decoded, err := e.Decode(e.Encode(text))
+	if err != nil || decoded != text {
+		t.Errorf("Round trip of %q gave %q, %v", text, decoded, err)
+	}
+	if count := e.Count(text); count != len(e.Encode(text)) {
+		t.Errorf("Count %d doesn't match the encoding length %d", count, len(e.Encode(text)))
+	}
+
+	_, err = e.Decode([]int{262, 5000})
+	if !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("Expected ErrUnknownToken, got %v", err)
+	}
+}
+
+func TestEncodeWithSpecialTokens(t *testing.T) {
+	e := testEncoding(t)
+
+	tokens := e.EncodeWithSpecialTokens("hi<|endoftext|>hello")
+	if !reflect.DeepEqual(tokens, []int{'h', 'i', 1000, 262}) {
+		t.Errorf("Unexpected tokens %v", tokens)
+	}
+	for _, token := range e.Encode("hi<|endoftext|>hello") {
+		if token == 1000 {
+			t.Errorf("Encode should not produce special tokens")
+		}
+	}
+
+	decoded, err := e.Decode(tokens)
+	if err != nil || decoded != "hi<|endoftext|>hello" {
+		t.Errorf("Unexpected decoded text %q, %v", decoded, err)
+	}
+}
+
+func TestNewEncodingErrors(t *testing.T) {
+	if _, err := newEncoding("broken", map[string]int{"a": 0}, nil, splitP50K); err == nil {
+		t.Errorf("Expected an error for missing single bytes")
+	}
+
+	ranks := make(map[string]int)
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	ranks["ab"] = 0
+	if _, err := newEncoding("broken", ranks, nil, splitP50K); err == nil {
+		t.Errorf("Expected an error for a duplicate rank")
+	}
+
+	delete(ranks, "ab")
+	if _, err := newEncoding("broken", ranks, map[string]int{EndOfText: 1}, splitP50K); err == nil {
+		t.Errorf("Expected an error for a special token reusing a rank")
+	}
+}
+
+func TestParseRanks(t *testing.T) {
+	ranks, err := parseRanks(strings.NewReader("YQ== 0\nYg== 1\n\nYWI= 2\n"))
+	if err != nil {
+		t.Fatalf("parseRanks error: %v", err)
+	}
+	if !reflect.DeepEqual(ranks, map[string]int{"a": 0, "b": 1, "ab": 2}) {
+		t.Errorf("Unexpected ranks %v", ranks)
+	}
+
+	for _, input := range []string{"YQ==", "!!! 0", "YQ== x"} {
+		if _, err = parseRanks(strings.NewReader(input)); err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+}
+
+func TestGetUnknownEncoding(t *testing.T) {
+	if _, err := Get("r50k_base"); !errors.Is(err, ErrUnknownEncoding) {
+		t.Errorf("Expected ErrUnknownEncoding, got %v", err)
+	}
+}
+
+func TestGoldenCL100K(t *testing.T) {
+	e := embeddedEncoding(t, CL100KBase)
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{"hello world", []int{15339, 1917}},
+		{"Hello, world!", []int{9906, 11, 1917, 0}},
+		{"tiktoken is great!", []int{83, 1609, 5963, 374, 2294, 0}},
+	}
+	for _, tt := range tests {
+		if got := e.Encode(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Encode(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+	if got := e.EncodeWithSpecialTokens(EndOfText); !reflect.DeepEqual(got, []int{100257}) {
+		t.Errorf("Unexpected special token %v", got)
+	}
+}
+
+func TestGoldenP50K(t *testing.T) {
+	e := embeddedEncoding(t, P50KBase)
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{"hello world", []int{31373, 995}},
+		{"tiktoken is great!", []int{83, 1134, 30001, 318, 1049, 0}},
+	}
+	for _, tt := range tests {
+		if got := e.Encode(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Encode(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+	if got := e.EncodeWithSpecialTokens(EndOfText); !reflect.DeepEqual(got, []int{50256}) {
+		t.Errorf("Unexpected special token %v", got)
+	}
+}
+
+func TestGoldenRoundTrip(t *testing.T) {
+	for _, name := range []string{CL100KBase, P50KBase} {
+		e := embeddedEncoding(t, name)
+		text := "Multilingual 文本, émojis 🎉 and\ttabs\n\n  indented code() {}"
+		decoded, err := e.Decode(e.Encode(text))
+		if err != nil || decoded != text {
+			t.Errorf("%s round trip of %q gave %q, %v", name, text, decoded, err)
+		}
+	}
+}
+
+var benchmarkText = strings.Repeat("The quick brown fox jumps over the lazy dog. "+
+	"Numbers like 1234567 and punctuation!? Mixed 中文 text.\n\n", 50)
+
+func BenchmarkEncode(b *testing.B) {
+	e := testEncoding(b)
+	b.SetBytes(int64(len(benchmarkText)))
+	for i := 0; i < b.N; i++ {
+		e.Encode(benchmarkText)
+	}
+}
+
+func BenchmarkEncodeCL100K(b *testing.B) {
+	e := embeddedEncoding(b, CL100KBase)
+	b.SetBytes(int64(len(benchmarkText)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.Encode(benchmarkText)
+	}
+}
+
+func BenchmarkCountCL100K(b *testing.B) {
+	e := embeddedEncoding(b, CL100KBase)
+	b.SetBytes(int64(len(benchmarkText)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.Count(benchmarkText)
+	}
+}
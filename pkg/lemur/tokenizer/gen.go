@@ -0,0 +1,87 @@
+//go:build ignore
+
+// gen.go downloads the rank files of the embedded encodings, checks them against the hashes
+// published with tiktoken and writes them gzipped to the data directory. The generated files
+// are committed; run it by hand only to refresh them.
+//
+//	go generate ./pkg/lemur/tokenizer
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+var files = []struct {
+	name string
+	url  string
+	hash string
+}{
+	{
+		name: "cl100k_base",
+		url:  "https://openaipublic.blob.core.windows.net/encodings/cl100k_base.tiktoken",
+		hash: "223921b76ee99bde995b7ff738513eef100fb51d18c93597a113bcffe865b2a7",
+	},
+	{
+		name: "p50k_base",
+		url:  "https://openaipublic.blob.core.windows.net/encodings/p50k_base.tiktoken",
+		hash: "94b5ca7dff4d00767bc256fdd1b27e5b17361d7b8a5f968547f9f23eb70d2069",
+	},
+}
+
+func main() {
+	for _, f := range files {
+		if err := fetch(f.url, f.hash, filepath.Join("data", f.name+".tiktoken.gz")); err != nil {
+			log.Fatalf("%s: %v", f.name, err)
+		}
+	}
+}
+
+func fetch(url, hash, path string) error {
+	resp, err := http.Get(url) //nolint:gosec,noctx // fixed URLs, run by hand
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(body)
+	if got := hex.EncodeToString(sum[:]); got != hash {
+		return fmt.Errorf("hash mismatch, got %s, expected %s", got, hash)
+	}
+
+	// Write next to the target and rename, so a failed run leaves the committed file intact.
+	out, err := os.CreateTemp(filepath.Dir(path), ".tiktoken-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	writer, err := gzip.NewWriterLevel(out, gzip.BestCompression)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	if _, err = writer.Write(body); err == nil {
+		err = writer.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), path)
+}
@@ -0,0 +1,206 @@
+package tokenizer
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The splitters below are hand-written equivalents of the pre-tokenization regular expressions
+// used by tiktoken. Both patterns rely on a negative lookahead (\s+(?!\S)), which Go's regexp
+// package does not support, so every alternative is matched in order with the same
+// backtracking behaviour the original engine has.
+
+// splitCL100K splits text like the cl100k_base pattern:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+func splitCL100K(text string) []string {
+	var pieces []string
+	for i := 0; i < len(text); {
+		n := matchCL100K(text, i)
+		pieces = append(pieces, text[i:i+n])
+		i += n
+	}
+	return pieces
+}
+
+func matchCL100K(text string, i int) int {
+	r, size := utf8.DecodeRuneInString(text[i:])
+
+	if r == '\'' {
+		for _, contraction := range []string{"s", "t", "re", "ve", "m", "ll", "d"} {
+			if n := matchFold(text[i+size:], contraction); n > 0 {
+				return size + n
+			}
+		}
+	}
+
+	if isLetter(r) {
+		return size + letterRun(text[i+size:])
+	}
+	if r != '\r' && r != '\n' && !isNumber(r) {
+		if n := letterRun(text[i+size:]); n > 0 {
+			return size + n
+		}
+	}
+
+	if isNumber(r) {
+		n := size
+		for count := 1; count < 3 && i+n < len(text); count++ {
+			next, nextSize := utf8.DecodeRuneInString(text[i+n:])
+			if !isNumber(next) {
+				break
+			}
+			n += nextSize
+		}
+		return n
+	}
+
+	if n := punctuationRun(text, i); n > 0 {
+		for i+n < len(text) && (text[i+n] == '\r' || text[i+n] == '\n') {
+			n++
+		}
+		return n
+	}
+
+	// r is whitespace from here on.
+	end := i + spaceRun(text[i:])
+	if newline := strings.LastIndexAny(text[i:end], "\r\n"); newline >= 0 {
+		return newline + 1
+	}
+	return trailingSpace(text, i, end)
+}
+
+// splitP50K splits text like the r50k_base and p50k_base pattern:
+//
+//	's|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+
+func splitP50K(text string) []string {
+	var pieces []string
+	for i := 0; i < len(text); {
+		n := matchP50K(text, i)
+		pieces = append(pieces, text[i:i+n])
+		i += n
+	}
+	return pieces
+}
+
+func matchP50K(text string, i int) int {
+	if text[i] == '\'' {
+		for _, contraction := range []string{"s", "t", "re", "ve", "m", "ll", "d"} {
+			if strings.HasPrefix(text[i+1:], contraction) {
+				return 1 + len(contraction)
+			}
+		}
+	}
+
+	start := i
+	if text[i] == ' ' && i+1 < len(text) {
+		start = i + 1
+	}
+	next, _ := utf8.DecodeRuneInString(text[start:])
+	switch {
+	case isLetter(next):
+		return start - i + letterRun(text[start:])
+	case isNumber(next):
+		return start - i + numberRun(text[start:])
+	}
+	if n := punctuationRun(text, i); n > 0 {
+		return n
+	}
+
+	end := i + spaceRun(text[i:])
+	return trailingSpace(text, i, end)
+}
+
+// punctuationRun matches " ?[^\s\p{L}\p{N}]+" at i and returns its length, or 0.
+func punctuationRun(text string, i int) int {
+	start := i
+	if text[i] == ' ' {
+		start++
+	}
+	n := 0
+	for start+n < len(text) {
+		r, size := utf8.DecodeRuneInString(text[start+n:])
+		if unicode.IsSpace(r) || isLetter(r) || isNumber(r) {
+			break
+		}
+		n += size
+	}
+	if n == 0 {
+		return 0
+	}
+	return start - i + n
+}
+
+// trailingSpace matches "\s+(?!\S)|\s+" for the whitespace run text[i:end]. A run followed by
+// a non-space character leaves its last character to the next piece, unless that would leave
+// the match empty.
+func trailingSpace(text string, i, end int) int {
+	if end == len(text) {
+		return end - i
+	}
+	_, lastSize := utf8.DecodeLastRuneInString(text[i:end])
+	if end-lastSize > i {
+		return end - lastSize - i
+	}
+	return end - i
+}
+
+// matchFold returns the length of the prefix of s matching the ASCII word under simple
+// case folding, or 0.
+func matchFold(s, word string) int {
+	n := 0
+	for _, want := range word {
+		if n >= len(s) {
+			return 0
+		}
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if !equalFoldRune(r, want) {
+			return 0
+		}
+		n += size
+	}
+	return n
+}
+
+func equalFoldRune(r, want rune) bool {
+	for f := unicode.SimpleFold(want); f != want; f = unicode.SimpleFold(f) {
+		if f == r {
+			return true
+		}
+	}
+	return r == want
+}
+
+func letterRun(s string) int {
+	return runWhile(s, isLetter)
+}
+
+func numberRun(s string) int {
+	return runWhile(s, isNumber)
+}
+
+func spaceRun(s string) int {
+	return runWhile(s, unicode.IsSpace)
+}
+
+func runWhile(s string, f func(rune) bool) int {
+	n := 0
+	for n < len(s) {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if !f(r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+func isLetter(r rune) bool {
+	return unicode.IsLetter(r)
+}
+
+// isNumber reports whether r is in the Unicode category N, like \p{N}.
+func isNumber(r rune) bool {
+	return unicode.IsNumber(r)
+}
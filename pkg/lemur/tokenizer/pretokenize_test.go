@@ -0,0 +1,80 @@
+package tokenizer //nolint:testpackage // testing private functions
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitCL100K(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"hello world", []string{"hello", " world"}},
+		{
+			"Hello, world!  How's it\n\n going 12345?",
+			[]string{"Hello", ",", " world", "!", " ", " How", "'s", " it", "\n\n", " going", " ", "123", "45", "?"},
+		},
+		{"I'LL don't", []string{"I", "'LL", " don", "'t"}},
+		{"itſs it'ſ", []string{"itſs", " it", "'ſ"}},
+		{"foo.\n\nbar", []string{"foo", ".\n\n", "bar"}},
+		{"$100 and 1234567", []string{"$", "100", " and", " ", "123", "456", "7"}},
+		{"hi  ", []string{"hi", "  "}},
+		{"a\t\tb", []string{"a", "\t", "\tb"}},
+		{"x \n y", []string{"x", " \n", " y"}},
+		{"你好世界 ok", []string{"你好世界", " ok"}},
+		{"'quoted'", []string{"'quoted", "'"}},
+	}
+	for _, tt := range tests {
+		if got := splitCL100K(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitCL100K(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSplitP50K(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"hello world", []string{"hello", " world"}},
+		{
+			"Hello, world!  How's it\n\n going 12345?",
+			[]string{"Hello", ",", " world", "!", " ", " How", "'s", " it", "\n\n", " going", " 12345", "?"},
+		},
+		{"I'LL don't", []string{"I", "'", "LL", " don", "'t"}},
+		{"foo.\n\nbar", []string{"foo", ".", "\n", "\n", "bar"}},
+		{"hi  ", []string{"hi", "  "}},
+		{"a\t\tb", []string{"a", "\t", "\t", "b"}},
+		{"   x", []string{"  ", " x"}},
+		{" !?", []string{" !?"}},
+	}
+	for _, tt := range tests {
+		if got := splitP50K(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitP50K(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSplitCoversInput(t *testing.T) {
+	texts := []string{
+		"mixed 中文 and émojis 🎉🎉 with\r\n\tcontrol separators ",
+		string([]byte{0xff, 'a', 0xfe, ' ', '1'}),
+	}
+	for _, text := range texts {
+		for name, split := range map[string]func(string) []string{"cl100k": splitCL100K, "p50k": splitP50K} {
+			pieces := split(text)
+			if joined := strings.Join(pieces, ""); joined != text {
+				t.Errorf("%s pieces of %q join to %q", name, text, joined)
+			}
+			for _, piece := range pieces {
+				if piece == "" {
+					t.Errorf("%s split of %q has an empty piece", name, text)
+				}
+			}
+		}
+	}
+}
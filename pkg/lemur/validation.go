@@ -0,0 +1,330 @@
+package lemur
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"chatgpt-go/pkg/lemur/tokenizer"
+)
+
+// ValidationError lists every problem found by the pre-flight validation of a request.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid request: " + strings.Join(e.Problems, "; ")
+}
+
+// validator collects the problems of a request.
+type validator struct {
+	problems []string
+}
+
+func (v *validator) addf(format string, args ...any) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+var functionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// ValidateChatCompletionRequest checks request without sending it, and returns a *ValidationError
+// listing every problem found. The prompt is only checked against the context window when the
+// model is in the registry; without its tokenizer the prompt tokens are estimated.
+//
+// It runs before every chat completion request when ClientConfig.ValidateRequests is set.
+func (c *Client) ValidateChatCompletionRequest(request ChatCompletionRequest) error {
+	var v validator
+	v.checkSampling(request.Temperature, request.TopP, request.N, request.Stream)
+	v.checkLogitBias(request.LogitBias)
+	v.checkMessages(request.Messages)
+	for i, function := range request.Functions {
+		if !functionNamePattern.MatchString(function.Name) {
+			v.addf("functions[%d]: name %q must be 1 to 64 letters, digits, underscores or dashes", i, function.Name)
+		}
+	}
+	v.checkTools(request.Tools)
+	v.checkResponseFormat(request.ResponseFormat, request.Messages)
+
+	if info, ok := c.models().Lookup(request.Model); ok {
+		if (len(request.Functions) > 0 || len(request.Tools) > 0) && !info.SupportsFunctions {
+			v.addf("model %s does not support functions", request.Model)
+		}
+		if !info.SupportsVision && slices.ContainsFunc(request.Messages, ChatCompletionMessage.hasImages) {
+			v.addf("model %s does not support images", request.Model)
+		}
+		promptTokens, err := countChatPromptTokens(request)
+		v.checkContext(request.Model, info, promptTokens, request.MaxTokens, err != nil)
+	}
+	return v.err()
+}
+
+// ValidateCompletionRequest checks request without sending it, like ValidateChatCompletionRequest.
+//
+// It runs before every completion request when ClientConfig.ValidateRequests is set.
+func (c *Client) ValidateCompletionRequest(request CompletionRequest) error {
+	var v validator
+	v.checkSampling(request.Temperature, request.TopP, request.N, request.Stream)
+	v.checkLogitBias(request.LogitBias)
+	if request.BestOf > 0 && request.Stream {
+		v.addf("best_of can't be used with streaming")
+	}
+
+	info, ok := c.models().Lookup(request.Model)
+	if !ok {
+		return v.err()
+	}
+	count, estimated := estimatePromptTokens, true
+	if encoding, err := tokenizer.ForModel(request.Model); err == nil {
+		count, estimated = encoding.Count, false
+	}
+	var prompts []string
+	switch prompt := request.Prompt.(type) {
+	case string:
+		prompts = []string{prompt}
+	case []string:
+		prompts = prompt
+	}
+	for _, prompt := range prompts {
+		v.checkContext(request.Model, info, count(prompt), request.MaxTokens, estimated)
+	}
+	return v.err()
+}
+
+func (v *validator) checkSampling(temperature, topP float32, n int, stream bool) {
+	if temperature < 0 || temperature > 2 {
+		v.addf("temperature %g must be between 0 and 2", temperature)
+	}
+	if topP < 0 || topP > 1 {
+		v.addf("top_p %g must be between 0 and 1", topP)
+	}
+	if n < 0 {
+		v.addf("n %d must not be negative", n)
+	}
+	if n > 1 && stream {
+		v.addf("n %d can't be used with streaming, the chunks of every choice would be interleaved", n)
+	}
+}
+
+func (v *validator) checkLogitBias(logitBias map[string]int) {
+	tokens := make([]string, 0, len(logitBias))
+	for token := range logitBias {
+		tokens = append(tokens, token)
+	}
+	slices.Sort(tokens)
+	for _, token := range tokens {
+		bias := logitBias[token]
+		if id, err := strconv.Atoi(token); err != nil || id < 0 {
+			v.addf("logit_bias key %q must be a token id", token)
+		}
+		if bias < -100 || bias > 100 {
+			v.addf("logit_bias of token %s is %d, it must be between -100 and 100", token, bias)
+		}
+	}
+}
+
+func (v *validator) checkMessages(messages []ChatCompletionMessage) {
+	if len(messages) == 0 {
+		v.addf("messages must not be empty")
+		return
+	}
+
+	var (
+		lastCall *FunctionCall
+		// toolCallIDs holds the tool calls of the last assistant message, which
+		// the tool messages following it may answer.
+		toolCallIDs map[string]bool
+	)
+	for i, message := range messages {
+		switch message.Role {
+		case ChatMessageRoleSystem, ChatMessageRoleUser:
+		case ChatMessageRoleAssistant:
+			if message.FunctionCall != nil && !functionNamePattern.MatchString(message.FunctionCall.Name) {
+				v.addf("messages[%d]: function call name %q is not a valid function name", i, message.FunctionCall.Name)
+			}
+			for j, call := range message.ToolCalls {
+				if call.ID == "" {
+					v.addf("messages[%d]: tool_calls[%d] has no id", i, j)
+				}
+				if !functionNamePattern.MatchString(call.Function.Name) {
+					v.addf("messages[%d]: tool_calls[%d] name %q is not a valid function name", i, j, call.Function.Name)
+				}
+			}
+		case ChatMessageRoleFunction:
+			switch {
+			case message.Name == "":
+				v.addf("messages[%d]: function messages need the name of the function", i)
+			case lastCall == nil:
+				v.addf("messages[%d]: function message %s does not follow an assistant function call", i, message.Name)
+			case lastCall.Name != message.Name:
+				v.addf("messages[%d]: function message %s answers a call to %s", i, message.Name, lastCall.Name)
+			}
+		case ChatMessageRoleTool:
+			switch {
+			case message.ToolCallID == "":
+				v.addf("messages[%d]: tool messages need a tool_call_id", i)
+			case !toolCallIDs[message.ToolCallID]:
+				v.addf("messages[%d]: tool message %s does not answer a tool call of the previous assistant message",
+					i, message.ToolCallID)
+			}
+		default:
+			v.addf("messages[%d]: unknown role %q", i, message.Role)
+		}
+		if message.Name != "" && !functionNamePattern.MatchString(message.Name) {
+			v.addf("messages[%d]: name %q must be 1 to 64 letters, digits, underscores or dashes", i, message.Name)
+		}
+		v.checkContent(i, message)
+
+		switch message.Role {
+		case ChatMessageRoleAssistant:
+			lastCall = message.FunctionCall
+			toolCallIDs = make(map[string]bool, len(message.ToolCalls))
+			for _, call := range message.ToolCalls {
+				toolCallIDs[call.ID] = true
+			}
+		case ChatMessageRoleTool:
+			lastCall = nil
+		default:
+			lastCall, toolCallIDs = nil, nil
+		}
+	}
+}
+
+func (v *validator) checkContent(i int, message ChatCompletionMessage) {
+	if message.Content != "" && message.MultiContent != nil {
+		v.addf("messages[%d]: Content and MultiContent can't both be set", i)
+	}
+	for j, part := range message.MultiContent {
+		switch part.Type {
+		case ChatMessagePartTypeText:
+		case ChatMessagePartTypeImageURL:
+			if part.ImageURL == nil || part.ImageURL.URL == "" {
+				v.addf("messages[%d]: content[%d] has no image url", i, j)
+			}
+		default:
+			v.addf("messages[%d]: content[%d] has unknown type %q", i, j, part.Type)
+		}
+	}
+}
+
+func (v *validator) checkTools(tools []Tool) {
+	for i, tool := range tools {
+		if tool.Type != ToolTypeFunction {
+			v.addf("tools[%d]: unknown type %q", i, tool.Type)
+		}
+		if tool.Function == nil {
+			v.addf("tools[%d]: function is missing", i)
+			continue
+		}
+		if !functionNamePattern.MatchString(tool.Function.Name) {
+			v.addf("tools[%d]: name %q must be 1 to 64 letters, digits, underscores or dashes", i, tool.Function.Name)
+		}
+	}
+}
+
+func (v *validator) checkResponseFormat(format *ChatCompletionResponseFormat, messages []ChatCompletionMessage) {
+	if format == nil {
+		return
+	}
+	switch format.Type {
+	case "", ChatCompletionResponseFormatTypeText:
+	case ChatCompletionResponseFormatTypeJSONObject:
+		// The API refuses JSON mode unless the model is told to answer with JSON.
+		if !slices.ContainsFunc(messages, func(m ChatCompletionMessage) bool {
+			return strings.Contains(strings.ToLower(m.text()), "json")
+		}) {
+			v.addf("response_format json_object needs the word JSON in the messages")
+		}
+	case ChatCompletionResponseFormatTypeJSONSchema:
+		switch {
+		case format.JSONSchema == nil:
+			v.addf("response_format json_schema needs a json_schema")
+		case !functionNamePattern.MatchString(format.JSONSchema.Name):
+			v.addf("response_format: name %q must be 1 to 64 letters, digits, underscores or dashes", format.JSONSchema.Name)
+		case format.JSONSchema.Schema == nil:
+			v.addf("response_format: json_schema %s has no schema", format.JSONSchema.Name)
+		}
+	default:
+		v.addf("response_format: unknown type %q", format.Type)
+	}
+}
+
+// checkContext checks that the prompt and max_tokens fit in the context of the model.
+// estimated tells that promptTokens was estimated because the model's tokenizer isn't available.
+func (v *validator) checkContext(model string, info ModelInfo, promptTokens, maxTokens int, estimated bool) {
+	if info.MaxOutputTokens > 0 && maxTokens > info.MaxOutputTokens {
+		v.addf("max_tokens %d is more than the %d output tokens of %s", maxTokens, info.MaxOutputTokens, model)
+	}
+	if info.ContextWindow > 0 && promptTokens+maxTokens > info.ContextWindow {
+		about := ""
+		if estimated {
+			about = "about "
+		}
+		v.addf("prompt of %s%d tokens and max_tokens %d don't fit in the %d token context of %s",
+			about, promptTokens, maxTokens, info.ContextWindow, model)
+	}
+}
+
+// estimatePromptTokens underestimates the number of tokens of s, for when no tokenizer is
+// available. Unlike estimateTokens it errs low, so that only prompts which clearly don't fit
+// in the context are rejected.
+func estimatePromptTokens(s string) int {
+	return len(s) / 4
+}
+
+// countChatPromptTokens counts the prompt tokens of request. Function and tool definitions
+// and images are not counted. When the model has no known tokenizer or its data isn't
+// embedded, the count is estimated and the error tells why.
+func countChatPromptTokens(request ChatCompletionRequest) (int, error) {
+	messages := make([]tokenizer.Message, len(request.Messages))
+	for i, message := range request.Messages {
+		messages[i] = tokenizer.Message{
+			Role:    message.Role,
+			Name:    message.Name,
+			Content: message.text(),
+		}
+		if message.FunctionCall != nil {
+			messages[i].FunctionName = message.FunctionCall.Name
+			messages[i].FunctionArguments = message.FunctionCall.Arguments
+		}
+		// Tool calls are counted like a function call made of all of them.
+		for _, call := range message.ToolCalls {
+			messages[i].FunctionName += call.Function.Name
+			messages[i].FunctionArguments += call.Function.Arguments
+		}
+	}
+	count, err := tokenizer.CountMessages(request.Model, messages)
+	if err == nil {
+		return count, nil
+	}
+	for _, message := range messages {
+		count += estimatePromptTokens(message.Role + message.Name + message.Content +
+			message.FunctionName + message.FunctionArguments)
+	}
+	return count, err
+}
+
+// validateChatCompletionRequest runs ValidateChatCompletionRequest if the client is configured to.
+func (c *Client) validateChatCompletionRequest(request ChatCompletionRequest) error {
+	if !c.config.ValidateRequests {
+		return nil
+	}
+	return c.ValidateChatCompletionRequest(request)
+}
+
+// validateCompletionRequest runs ValidateCompletionRequest if the client is configured to.
+func (c *Client) validateCompletionRequest(request CompletionRequest) error {
+	if !c.config.ValidateRequests {
+		return nil
+	}
+	return c.ValidateCompletionRequest(request)
+}
@@ -0,0 +1,28 @@
+package lemur //nolint:testpackage // testing private functions
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidatorCheckContext(t *testing.T) {
+	info := ModelInfo{ContextWindow: 1000, MaxOutputTokens: 300}
+	tests := []struct {
+		promptTokens int
+		maxTokens    int
+		problems     []string
+	}{
+		{600, 300, nil},
+		{900, 0, nil},
+		{1001, 0, []string{"prompt of 1001 tokens and max_tokens 0 don't fit in the 1000 token context of m"}},
+		{800, 250, []string{"prompt of 800 tokens and max_tokens 250 don't fit in the 1000 token context of m"}},
+		{100, 400, []string{"max_tokens 400 is more than the 300 output tokens of m"}},
+	}
+	for _, tt := range tests {
+		var v validator
+		v.checkContext("m", info, tt.promptTokens, tt.maxTokens, false)
+		if !reflect.DeepEqual(v.problems, tt.problems) {
+			t.Errorf("checkContext(%d, %d) = %v, want %v", tt.promptTokens, tt.maxTokens, v.problems, tt.problems)
+		}
+	}
+}
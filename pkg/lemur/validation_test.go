@@ -0,0 +1,210 @@
+package lemur_test
+
+import (
+	. "chatgpt-go/pkg/lemur"
+	"chatgpt-go/pkg/lemur/internal/test/checks"
+	"chatgpt-go/pkg/lemur/tokenizer"
+
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newValidatingClient() *Client {
+	config := DefaultConfig("whatever")
+	config.BaseURL = "http://localhost/v1"
+	config.ValidateRequests = true
+	return NewClientWithConfig(config)
+}
+
+func TestValidateChatCompletionRequest(t *testing.T) {
+	client := newValidatingClient()
+	err := client.ValidateChatCompletionRequest(ChatCompletionRequest{
+		Model:       GPT40314,
+		Temperature: 2.5,
+		TopP:        -0.1,
+		N:           2,
+		Stream:      true,
+		LogitBias:   map[string]int{"You": 6, "1639": 101},
+		Messages: []ChatCompletionMessage{
+			{Role: ChatMessageRoleSystem, Content: "Be helpful."},
+			{Role: "bot", Content: "Hi"},
+			{Role: ChatMessageRoleAssistant, FunctionCall: &FunctionCall{Name: "get_weather", Arguments: "{}"}},
+			{Role: ChatMessageRoleFunction, Name: "get_time", Content: "12:00"},
+			{Role: ChatMessageRoleFunction, Content: "sunny"},
+		},
+		Functions: []FunctionDefinition{{Name: "get weather"}},
+	})
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	expected := []string{
+		"temperature 2.5 must be between 0 and 2",
+		"top_p -0.1 must be between 0 and 1",
+		"n 2 can't be used with streaming, the chunks of every choice would be interleaved",
+		"logit_bias of token 1639 is 101, it must be between -100 and 100",
+		`logit_bias key "You" must be a token id`,
+		`messages[1]: unknown role "bot"`,
+		"messages[3]: function message get_time answers a call to get_weather",
+		"messages[4]: function messages need the name of the function",
+		`functions[0]: name "get weather" must be 1 to 64 letters, digits, underscores or dashes`,
+		"model gpt-4-0314 does not support functions",
+	}
+	if !reflect.DeepEqual(validationErr.Problems, expected) {
+		t.Errorf("Unexpected problems:\n%s\nexpected:\n%s",
+			strings.Join(validationErr.Problems, "\n"), strings.Join(expected, "\n"))
+	}
+	if !strings.HasPrefix(err.Error(), "invalid request: temperature") {
+		t.Errorf("Unexpected error message %q", err.Error())
+	}
+}
+
+func TestValidateChatCompletionRequestValid(t *testing.T) {
+	client := newValidatingClient()
+	err := client.ValidateChatCompletionRequest(ChatCompletionRequest{
+		Model:       GPT3Dot5Turbo,
+		Temperature: 0.7,
+		LogitBias:   map[string]int{"1639": -100},
+		Messages: []ChatCompletionMessage{
+			{Role: ChatMessageRoleUser, Name: "example_user", Content: "What's the weather?"},
+			{Role: ChatMessageRoleAssistant, FunctionCall: &FunctionCall{Name: "get_weather", Arguments: "{}"}},
+			{Role: ChatMessageRoleFunction, Name: "get_weather", Content: "sunny"},
+		},
+		Functions: []FunctionDefinition{{Name: "get_weather"}},
+	})
+	checks.NoError(t, err, "valid request should pass")
+
+	err = client.ValidateChatCompletionRequest(ChatCompletionRequest{Model: GPT3Dot5Turbo})
+	checks.HasError(t, err, "empty messages should fail")
+}
+
+func TestValidateChatCompletionRequestTools(t *testing.T) {
+	client := newValidatingClient()
+	call := func(id string) ToolCall {
+		return ToolCall{ID: id, Type: ToolTypeFunction, Function: FunctionCall{Name: "get_weather", Arguments: "{}"}}
+	}
+
+	err := client.ValidateChatCompletionRequest(ChatCompletionRequest{
+		Model: GPT3Dot5Turbo1106,
+		Messages: []ChatCompletionMessage{
+			{Role: ChatMessageRoleUser, Content: "Weather in Paris and Tokyo?"},
+			{Role: ChatMessageRoleAssistant, ToolCalls: []ToolCall{call("call_1"), call("call_2")}},
+			{Role: ChatMessageRoleTool, ToolCallID: "call_1", Content: "sunny"},
+			{Role: ChatMessageRoleTool, ToolCallID: "call_2", Content: "rainy"},
+		},
+		Tools: []Tool{{Type: ToolTypeFunction, Function: &FunctionDefinition{Name: "get_weather"}}},
+	})
+	checks.NoError(t, err, "parallel tool calls should be valid")
+
+	err = client.ValidateChatCompletionRequest(ChatCompletionRequest{
+		Model: GPT3Dot5Turbo0301,
+		Messages: []ChatCompletionMessage{
+			{Role: ChatMessageRoleAssistant, ToolCalls: []ToolCall{call("")}},
+			{Role: ChatMessageRoleTool, Content: "sunny"},
+			{Role: ChatMessageRoleUser, Content: "And now?"},
+			{Role: ChatMessageRoleTool, ToolCallID: "call_1", Content: "rainy"},
+		},
+		Tools: []Tool{{Type: "retrieval"}},
+	})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	expected := []string{
+		"messages[0]: tool_calls[0] has no id",
+		"messages[1]: tool messages need a tool_call_id",
+		"messages[3]: tool message call_1 does not answer a tool call of the previous assistant message",
+		`tools[0]: unknown type "retrieval"`,
+		"tools[0]: function is missing",
+		"model gpt-3.5-turbo-0301 does not support functions",
+	}
+	if !reflect.DeepEqual(validationErr.Problems, expected) {
+		t.Errorf("Unexpected problems:\n%s\nexpected:\n%s",
+			strings.Join(validationErr.Problems, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestValidateChatCompletionRequestContext(t *testing.T) {
+	if _, err := tokenizer.Get(tokenizer.CL100KBase); err != nil {
+		t.Skipf("tokenizer not available: %v", err)
+	}
+	client := newValidatingClient()
+	err := client.ValidateChatCompletionRequest(ChatCompletionRequest{
+		Model:     GPT3Dot5Turbo,
+		MaxTokens: 4090,
+		Messages:  []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "Hello, world!"}},
+	})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Problems) != 1 ||
+		!strings.Contains(validationErr.Problems[0], "4096 token context") {
+		t.Errorf("Expected a context window problem, got %v", err)
+	}
+}
+
+func TestValidateLongPrompt(t *testing.T) {
+	// The prompt is rejected whether or not the tokenizer data is embedded.
+	client := newValidatingClient()
+	prompt := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 2000)
+	err := client.ValidateChatCompletionRequest(ChatCompletionRequest{
+		Model:    GPT3Dot5Turbo,
+		Messages: []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: prompt}},
+	})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || !strings.Contains(validationErr.Problems[0], "4096 token context") {
+		t.Errorf("Expected a context window problem, got %v", err)
+	}
+
+	err = client.ValidateCompletionRequest(CompletionRequest{Model: GPT3TextDavinci003, Prompt: prompt})
+	if !errors.As(err, &validationErr) || !strings.Contains(validationErr.Problems[0], "token context") {
+		t.Errorf("Expected a context window problem, got %v", err)
+	}
+}
+
+func TestValidateCompletionRequest(t *testing.T) {
+	client := newValidatingClient()
+	err := client.ValidateCompletionRequest(CompletionRequest{
+		Model:  GPT3TextDavinci003,
+		Prompt: "Hello",
+		BestOf: 2,
+		Stream: true,
+	})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) ||
+		!reflect.DeepEqual(validationErr.Problems, []string{"best_of can't be used with streaming"}) {
+		t.Errorf("Unexpected validation result %v", err)
+	}
+}
+
+func TestValidateRequestsBeforeSending(t *testing.T) {
+	client := newValidatingClient()
+	ctx := context.Background()
+	request := ChatCompletionRequest{
+		Model:       GPT3Dot5Turbo,
+		Temperature: 3,
+		Messages:    []ChatCompletionMessage{{Role: ChatMessageRoleUser, Content: "Hello!"}},
+	}
+
+	var validationErr *ValidationError
+	_, err := client.CreateChatCompletion(ctx, request)
+	if !errors.As(err, &validationErr) {
+		t.Errorf("CreateChatCompletion should fail validation, got %v", err)
+	}
+	_, err = client.CreateChatCompletionStream(ctx, request)
+	if !errors.As(err, &validationErr) {
+		t.Errorf("CreateChatCompletionStream should fail validation, got %v", err)
+	}
+
+	completion := CompletionRequest{Model: GPT3TextDavinci003, Prompt: "Hello", TopP: 2}
+	_, err = client.CreateCompletion(ctx, completion)
+	if !errors.As(err, &validationErr) {
+		t.Errorf("CreateCompletion should fail validation, got %v", err)
+	}
+	_, err = client.CreateCompletionStream(ctx, completion)
+	if !errors.As(err, &validationErr) {
+		t.Errorf("CreateCompletionStream should fail validation, got %v", err)
+	}
+}
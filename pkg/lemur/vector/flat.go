@@ -0,0 +1,118 @@
+package vector
+
+import "sync"
+
+// Flat is an index searching every vector. Searches are exact and take a time proportional
+// to the number of vectors, which is fast enough for up to about a hundred thousand vectors.
+type Flat struct {
+	dim int
+
+	mu sync.RWMutex
+	// data holds the vectors one after another, so that a search reads contiguous memory.
+	data      []float32
+	ids       []string
+	metadata  []Metadata
+	positions map[string]int
+}
+
+// NewFlat returns an empty index of vectors of dim dimensions.
+func NewFlat(dim int) *Flat {
+	return &Flat{dim: dim, positions: make(map[string]int)}
+}
+
+func (f *Flat) Dim() int {
+	return f.dim
+}
+
+func (f *Flat) Len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.ids)
+}
+
+func (f *Flat) Add(id string, vector []float32, metadata Metadata) error {
+	if id == "" {
+		return ErrEmptyID
+	}
+	if err := checkDim(f.dim, vector); err != nil {
+		return err
+	}
+	normalized := Normalize(vector)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if i, ok := f.positions[id]; ok {
+		copy(f.vector(i), normalized)
+		f.metadata[i] = metadata
+		return nil
+	}
+	f.positions[id] = len(f.ids)
+	f.data = append(f.data, normalized...)
+	f.ids = append(f.ids, id)
+	f.metadata = append(f.metadata, metadata)
+	return nil
+}
+
+func (f *Flat) Remove(id string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i, ok := f.positions[id]
+	if !ok {
+		return false
+	}
+	// The last vector takes the place of the removed one.
+	last := len(f.ids) - 1
+	if i != last {
+		copy(f.vector(i), f.vector(last))
+		f.ids[i] = f.ids[last]
+		f.metadata[i] = f.metadata[last]
+		f.positions[f.ids[i]] = i
+	}
+	f.data = f.data[:last*f.dim]
+	f.ids[last] = ""
+	f.ids = f.ids[:last]
+	f.metadata[last] = nil
+	f.metadata = f.metadata[:last]
+	delete(f.positions, id)
+	return true
+}
+
+func (f *Flat) Search(query []float32, k int, filter Filter) ([]Result, error) {
+	if err := checkDim(f.dim, query); err != nil {
+		return nil, err
+	}
+	if k <= 0 {
+		return nil, nil
+	}
+	query = Normalize(query)
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	top := newTopK(min(k, len(f.ids)))
+	for i, id := range f.ids {
+		if filter != nil && !filter(f.metadata[i]) {
+			continue
+		}
+		score := Dot(query, f.vector(i))
+		if top.full() && score <= top.min() {
+			continue
+		}
+		top.push(Result{ID: id, Score: score, Metadata: f.metadata[i]})
+	}
+	return top.sorted(), nil
+}
+
+func (f *Flat) Items() []Item {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	items := make([]Item, len(f.ids))
+	for i, id := range f.ids {
+		items[i] = Item{ID: id, Vector: append([]float32(nil), f.vector(i)...), Metadata: f.metadata[i]}
+	}
+	return items
+}
+
+// vector returns the vector at position i.
+func (f *Flat) vector(i int) []float32 {
+	return f.data[i*f.dim : (i+1)*f.dim : (i+1)*f.dim]
+}
@@ -0,0 +1,372 @@
+package vector
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"sync"
+)
+
+const (
+	defaultHNSWM              = 16
+	defaultHNSWEfConstruction = 200
+	defaultHNSWEfSearch       = 64
+)
+
+// HNSWConfig controls the trade-off between the speed, memory and recall of an HNSW index.
+// The zero value uses the defaults.
+type HNSWConfig struct {
+	// M is the number of neighbors of a vector in the graph, twice as many in the lowest layer.
+	// Defaults to 16.
+	M int
+	// EfConstruction is the number of candidates considered when adding a vector. Defaults to 200.
+	EfConstruction int
+	// EfSearch is the number of candidates considered by a search, at least k. Defaults to 64.
+	EfSearch int
+	// Seed seeds the random levels of the vectors, for reproducible graphs.
+	Seed int64
+}
+
+func (c HNSWConfig) withDefaults() HNSWConfig {
+	if c.M <= 0 {
+		c.M = defaultHNSWM
+	}
+	if c.EfConstruction <= 0 {
+		c.EfConstruction = defaultHNSWEfConstruction
+	}
+	if c.EfSearch <= 0 {
+		c.EfSearch = defaultHNSWEfSearch
+	}
+	return c
+}
+
+// HNSW is an index searching a hierarchical navigable small world graph (Malkov and Yashunin, 2016).
+// Searches take a time roughly logarithmic in the number of vectors but may miss some of the most
+// similar ones; raise EfSearch to improve recall.
+//
+// Removed vectors are only marked as such and keep linking the graph. Their memory is reclaimed
+// when the index is loaded again after Save, which then builds the graph from the remaining vectors.
+type HNSW struct {
+	dim    int
+	config HNSWConfig
+	// levelFactor normalizes the random levels of the vectors.
+	levelFactor float64
+
+	mu       sync.RWMutex
+	rng      *rand.Rand
+	nodes    []hnswNode
+	ids      map[string]int32
+	entry    int32
+	maxLevel int
+}
+
+type hnswNode struct {
+	id       string
+	vector   []float32
+	metadata Metadata
+	// neighbors holds the neighbors of the node in every layer it belongs to.
+	neighbors [][]int32
+	removed   bool
+}
+
+// candidate is a node found by a search, with its similarity to the query.
+type candidate struct {
+	node  int32
+	score float32
+}
+
+// NewHNSW returns an empty HNSW index of vectors of dim dimensions.
+func NewHNSW(dim int, config HNSWConfig) *HNSW {
+	config = config.withDefaults()
+	return &HNSW{
+		dim:         dim,
+		config:      config,
+		levelFactor: 1 / math.Log(float64(config.M)),
+		rng:         rand.New(rand.NewSource(config.Seed)), //nolint:gosec // levels don't need a secure source
+		ids:         make(map[string]int32),
+		entry:       -1,
+	}
+}
+
+func (h *HNSW) Dim() int {
+	return h.dim
+}
+
+func (h *HNSW) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.ids)
+}
+
+func (h *HNSW) Add(id string, vector []float32, metadata Metadata) error {
+	if id == "" {
+		return ErrEmptyID
+	}
+	if err := checkDim(h.dim, vector); err != nil {
+		return err
+	}
+	normalized := Normalize(vector)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if old, ok := h.ids[id]; ok {
+		h.nodes[old].removed = true
+	}
+	h.insert(id, normalized, metadata)
+	return nil
+}
+
+func (h *HNSW) insert(id string, vector []float32, metadata Metadata) {
+	level := int(-math.Log(1-h.rng.Float64()) * h.levelFactor)
+	node := int32(len(h.nodes))
+	h.nodes = append(h.nodes, hnswNode{
+		id:        id,
+		vector:    vector,
+		metadata:  metadata,
+		neighbors: make([][]int32, level+1),
+	})
+	h.ids[id] = node
+	if h.entry < 0 {
+		h.entry, h.maxLevel = node, level
+		return
+	}
+
+	entries := []candidate{{h.entry, Dot(vector, h.nodes[h.entry].vector)}}
+	for l := h.maxLevel; l > level; l-- {
+		entries = h.searchLayer(vector, entries, 1, l, nil)[:1]
+	}
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		candidates := h.searchLayer(vector, entries, h.config.EfConstruction, l, nil)
+		neighbors := h.selectNeighbors(candidates, h.config.M)
+		h.nodes[node].neighbors[l] = neighbors
+		for _, neighbor := range neighbors {
+			h.link(neighbor, node, l)
+		}
+		entries = candidates
+	}
+	if level > h.maxLevel {
+		h.entry, h.maxLevel = node, level
+	}
+}
+
+// maxNeighbors returns the maximum number of neighbors of a node in layer level.
+func (h *HNSW) maxNeighbors(level int) int {
+	if level == 0 {
+		return 2 * h.config.M
+	}
+	return h.config.M
+}
+
+// link adds to in the neighbors of from in layer level, pruning them if there are too many.
+func (h *HNSW) link(from, to int32, level int) {
+	neighbors := append(h.nodes[from].neighbors[level], to)
+	if len(neighbors) > h.maxNeighbors(level) {
+		vector := h.nodes[from].vector
+		candidates := make([]candidate, len(neighbors))
+		for i, neighbor := range neighbors {
+			candidates[i] = candidate{neighbor, Dot(vector, h.nodes[neighbor].vector)}
+		}
+		sortCandidates(candidates)
+		neighbors = h.selectNeighbors(candidates, h.maxNeighbors(level))
+	}
+	h.nodes[from].neighbors[level] = neighbors
+}
+
+// selectNeighbors picks up to m of candidates, sorted by decreasing score, preferring the candidates
+// which are closer to the node than to the neighbors already picked, so that the graph links distant
+// regions. The remaining places are filled with the closest candidates left.
+func (h *HNSW) selectNeighbors(candidates []candidate, m int) []int32 {
+	selected := make([]int32, 0, m)
+	var pruned []int32
+	for _, c := range candidates {
+		if len(selected) == m {
+			break
+		}
+		diverse := true
+		for _, s := range selected {
+			if Dot(h.nodes[c.node].vector, h.nodes[s].vector) > c.score {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, c.node)
+		} else {
+			pruned = append(pruned, c.node)
+		}
+	}
+	for _, node := range pruned {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, node)
+	}
+	return selected
+}
+
+// searchLayer returns up to ef nodes of layer level most similar to query and accepted by allowed,
+// sorted by decreasing score. Nodes which aren't allowed are still traversed.
+func (h *HNSW) searchLayer(
+	query []float32,
+	entries []candidate,
+	ef int,
+	level int,
+	allowed func(node int32) bool,
+) []candidate {
+	visited := make(map[int32]struct{}, ef*h.config.M)
+	// frontier is a max-heap of the nodes to visit, results a min-heap of the best nodes found.
+	var frontier, results candidateHeap
+	frontier.max = true
+	for _, e := range entries {
+		visited[e.node] = struct{}{}
+		frontier.push(e)
+		if allowed == nil || allowed(e.node) {
+			results.push(e)
+		}
+	}
+	for len(frontier.items) > 0 {
+		current := frontier.pop()
+		if len(results.items) >= ef && current.score < results.top().score {
+			break
+		}
+		for _, neighbor := range h.nodes[current.node].neighbors[level] {
+			if _, ok := visited[neighbor]; ok {
+				continue
+			}
+			visited[neighbor] = struct{}{}
+			score := Dot(query, h.nodes[neighbor].vector)
+			if len(results.items) >= ef && score <= results.top().score {
+				continue
+			}
+			frontier.push(candidate{neighbor, score})
+			if allowed == nil || allowed(neighbor) {
+				results.push(candidate{neighbor, score})
+				if len(results.items) > ef {
+					results.pop()
+				}
+			}
+		}
+	}
+	sortCandidates(results.items)
+	return results.items
+}
+
+func (h *HNSW) Remove(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	node, ok := h.ids[id]
+	if !ok {
+		return false
+	}
+	h.nodes[node].removed = true
+	delete(h.ids, id)
+	return true
+}
+
+func (h *HNSW) Search(query []float32, k int, filter Filter) ([]Result, error) {
+	if err := checkDim(h.dim, query); err != nil {
+		return nil, err
+	}
+	if k <= 0 {
+		return nil, nil
+	}
+	query = Normalize(query)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.entry < 0 {
+		return nil, nil
+	}
+	entries := []candidate{{h.entry, Dot(query, h.nodes[h.entry].vector)}}
+	for l := h.maxLevel; l > 0; l-- {
+		entries = h.searchLayer(query, entries, 1, l, nil)[:1]
+	}
+	allowed := func(node int32) bool {
+		n := &h.nodes[node]
+		return !n.removed && (filter == nil || filter(n.metadata))
+	}
+	candidates := h.searchLayer(query, entries, max(h.config.EfSearch, k), 0, allowed)
+
+	results := make([]Result, 0, min(k, len(candidates)))
+	for _, c := range candidates[:min(k, len(candidates))] {
+		n := &h.nodes[c.node]
+		results = append(results, Result{ID: n.id, Score: c.score, Metadata: n.metadata})
+	}
+	return results, nil
+}
+
+func (h *HNSW) Items() []Item {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	items := make([]Item, 0, len(h.ids))
+	for _, n := range h.nodes {
+		if !n.removed {
+			items = append(items, Item{ID: n.id, Vector: slices.Clone(n.vector), Metadata: n.metadata})
+		}
+	}
+	return items
+}
+
+func sortCandidates(candidates []candidate) {
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		switch {
+		case a.score > b.score:
+			return -1
+		case a.score < b.score:
+			return 1
+		default:
+			return 0
+		}
+	})
+}
+
+// candidateHeap is a min-heap of candidates by score, or a max-heap if max is set.
+type candidateHeap struct {
+	max   bool
+	items []candidate
+}
+
+func (h *candidateHeap) less(i, j int) bool {
+	if h.max {
+		return h.items[i].score > h.items[j].score
+	}
+	return h.items[i].score < h.items[j].score
+}
+
+func (h *candidateHeap) top() candidate {
+	return h.items[0]
+}
+
+func (h *candidateHeap) push(c candidate) {
+	h.items = append(h.items, c)
+	for i := len(h.items) - 1; i > 0; {
+		parent := (i - 1) / 2
+		if !h.less(i, parent) {
+			break
+		}
+		h.items[i], h.items[parent] = h.items[parent], h.items[i]
+		i = parent
+	}
+}
+
+func (h *candidateHeap) pop() candidate {
+	top := h.items[0]
+	last := len(h.items) - 1
+	h.items[0] = h.items[last]
+	h.items = h.items[:last]
+	for i := 0; ; {
+		first, left, right := i, 2*i+1, 2*i+2
+		if left < len(h.items) && h.less(left, first) {
+			first = left
+		}
+		if right < len(h.items) && h.less(right, first) {
+			first = right
+		}
+		if first == i {
+			break
+		}
+		h.items[i], h.items[first] = h.items[first], h.items[i]
+		i = first
+	}
+	return top
+}
@@ -0,0 +1,315 @@
+package vector
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+)
+
+const snapshotVersion = 1
+
+const (
+	kindFlat = "flat"
+	kindHNSW = "hnsw"
+)
+
+var (
+	ErrUnknownIndex     = errors.New("unknown vector index type")
+	ErrSnapshotVersion  = errors.New("unsupported vector index snapshot version")
+	ErrInvalidTableName = errors.New("invalid vector table name")
+)
+
+// tableNamePattern matches the table names accepted by SaveSQL and LoadSQL, which can't be query parameters.
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// snapshot is the gob encoding of an index.
+type snapshot struct {
+	Version int
+	Kind    string
+	Dim     int
+	Items   []Item
+	HNSW    *hnswSnapshot
+}
+
+// hnswSnapshot holds the graph of an HNSW index. Its nodes are the items of the snapshot, in order.
+type hnswSnapshot struct {
+	Config    HNSWConfig
+	Neighbors [][][]int32
+	Entry     int32
+	MaxLevel  int
+}
+
+// Save writes index to w. Flat and HNSW indexes are supported; the graph of an HNSW index is
+// saved with it, so that loading it doesn't need to build the graph again, unless vectors were
+// removed from the index.
+func Save(w io.Writer, index Index) error {
+	s := snapshot{Version: snapshotVersion, Dim: index.Dim()}
+	switch index := index.(type) {
+	case *Flat:
+		s.Kind = kindFlat
+		s.Items = index.Items()
+	case *HNSW:
+		s.Kind = kindHNSW
+		s.Items, s.HNSW = index.snapshot()
+	default:
+		return fmt.Errorf("%w: %T", ErrUnknownIndex, index)
+	}
+	return gob.NewEncoder(w).Encode(s)
+}
+
+// Load reads an index written by Save.
+func Load(r io.Reader) (Index, error) {
+	var s snapshot
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.Version != snapshotVersion {
+		return nil, fmt.Errorf("%w: %d", ErrSnapshotVersion, s.Version)
+	}
+	switch s.Kind {
+	case kindFlat:
+		index := NewFlat(s.Dim)
+		if err := addItems(index, s.Items); err != nil {
+			return nil, err
+		}
+		return index, nil
+	case kindHNSW:
+		if s.HNSW == nil {
+			return nil, errors.New("vector index snapshot has no valid graph")
+		}
+		if s.HNSW.Neighbors == nil {
+			index := NewHNSW(s.Dim, s.HNSW.Config)
+			if err := addItems(index, s.Items); err != nil {
+				return nil, err
+			}
+			return index, nil
+		}
+		if len(s.HNSW.Neighbors) != len(s.Items) {
+			return nil, errors.New("vector index snapshot has no valid graph")
+		}
+		return restoreHNSW(s.Dim, s.Items, s.HNSW)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownIndex, s.Kind)
+	}
+}
+
+// SaveFile saves index to the file at path. The file is replaced atomically, so that a failure
+// leaves the previous file intact.
+func SaveFile(path string, index Index) (err error) {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+	buffered := bufio.NewWriter(file)
+	if err = Save(buffered, index); err != nil {
+		return err
+	}
+	if err = buffered.Flush(); err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// LoadFile loads an index from the file at path written by SaveFile.
+func LoadFile(path string) (Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Load(bufio.NewReader(file))
+}
+
+// SaveSQL saves the vectors of index to table, which is created if needed and whose previous
+// rows are replaced. Every vector is a row with the columns id, vector, a blob of little-endian
+// float32, and metadata, a JSON object.
+//
+// Only the vectors are saved, so that the table can be read by other programs; an HNSW index
+// builds its graph again when it is loaded.
+func SaveSQL(ctx context.Context, db *sql.DB, table string, index Index) (err error) {
+	if !tableNamePattern.MatchString(table) {
+		return fmt.Errorf("%w: %q", ErrInvalidTableName, table)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	//nolint:gosec // the table name is validated
+	if _, err = tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+table+
+		` (id TEXT PRIMARY KEY, vector BLOB NOT NULL, metadata TEXT NOT NULL)`); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM `+table); err != nil { //nolint:gosec // the table name is validated
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO `+table+` (id, vector, metadata) VALUES (?, ?, ?)`) //nolint:gosec,lll
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, item := range index.Items() {
+		metadata, marshalErr := json.Marshal(item.Metadata)
+		if marshalErr != nil {
+			return marshalErr
+		}
+		if _, err = stmt.ExecContext(ctx, item.ID, encodeVector(item.Vector), string(metadata)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadSQL adds the vectors of table written by SaveSQL to index.
+func LoadSQL(ctx context.Context, db *sql.DB, table string, index Index) error {
+	if !tableNamePattern.MatchString(table) {
+		return fmt.Errorf("%w: %q", ErrInvalidTableName, table)
+	}
+	rows, err := db.QueryContext(ctx, `SELECT id, vector, metadata FROM `+table) //nolint:gosec // the table name is validated
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id       string
+			blob     []byte
+			encoded  string
+			metadata Metadata
+		)
+		if err = rows.Scan(&id, &blob, &encoded); err != nil {
+			return err
+		}
+		if err = json.Unmarshal([]byte(encoded), &metadata); err != nil {
+			return fmt.Errorf("metadata of vector %q: %w", id, err)
+		}
+		vector, decodeErr := decodeVector(blob)
+		if decodeErr != nil {
+			return fmt.Errorf("vector %q: %w", id, decodeErr)
+		}
+		if err = index.Add(id, vector, metadata); err != nil {
+			return fmt.Errorf("vector %q: %w", id, err)
+		}
+	}
+	return rows.Err()
+}
+
+func encodeVector(vector []float32) []byte {
+	blob := make([]byte, 4*len(vector))
+	for i, x := range vector {
+		binary.LittleEndian.PutUint32(blob[4*i:], math.Float32bits(x))
+	}
+	return blob
+}
+
+func decodeVector(blob []byte) ([]float32, error) {
+	if len(blob)%4 != 0 {
+		return nil, fmt.Errorf("vector blob has %d bytes, not a multiple of 4", len(blob))
+	}
+	vector := make([]float32, len(blob)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(blob[4*i:]))
+	}
+	return vector, nil
+}
+
+func addItems(index Index, items []Item) error {
+	for _, item := range items {
+		if err := index.Add(item.ID, item.Vector, item.Metadata); err != nil {
+			return fmt.Errorf("vector %q: %w", item.ID, err)
+		}
+	}
+	return nil
+}
+
+// snapshot returns the nodes of the index which aren't removed, and their graph. When vectors
+// were removed, the graph is left out: dropping the links to the removed nodes could split it,
+// so Load builds it again from the remaining vectors.
+func (h *HNSW) snapshot() ([]Item, *hnswSnapshot) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	graph := &hnswSnapshot{Config: h.config, Entry: -1}
+	items := make([]Item, 0, len(h.ids))
+	for _, n := range h.nodes {
+		if !n.removed {
+			items = append(items, Item{ID: n.id, Vector: n.vector, Metadata: n.metadata})
+		}
+	}
+	if len(items) != len(h.nodes) {
+		return items, graph
+	}
+
+	graph.Neighbors = make([][][]int32, len(h.nodes))
+	for i, n := range h.nodes {
+		// The layers are copied, Add may change them once the lock is released.
+		graph.Neighbors[i] = make([][]int32, len(n.neighbors))
+		for l, layer := range n.neighbors {
+			graph.Neighbors[i][l] = slices.Clone(layer)
+		}
+		if graph.Entry < 0 || len(n.neighbors)-1 > graph.MaxLevel {
+			graph.Entry, graph.MaxLevel = int32(i), len(n.neighbors)-1
+		}
+	}
+	return items, graph
+}
+
+func restoreHNSW(dim int, items []Item, graph *hnswSnapshot) (*HNSW, error) {
+	h := NewHNSW(dim, graph.Config)
+	h.nodes = make([]hnswNode, len(items))
+	for i, item := range items {
+		if item.ID == "" {
+			return nil, ErrEmptyID
+		}
+		if err := checkDim(dim, item.Vector); err != nil {
+			return nil, fmt.Errorf("vector %q: %w", item.ID, err)
+		}
+		if _, ok := h.ids[item.ID]; ok || len(graph.Neighbors[i]) == 0 {
+			return nil, fmt.Errorf("vector %q has an invalid graph node", item.ID)
+		}
+		for l, layer := range graph.Neighbors[i] {
+			for _, neighbor := range layer {
+				// A neighbor in layer l belongs to layer l too.
+				if neighbor < 0 || int(neighbor) >= len(items) || len(graph.Neighbors[neighbor]) <= l {
+					return nil, fmt.Errorf("vector %q has an invalid neighbor %d", item.ID, neighbor)
+				}
+			}
+		}
+		h.nodes[i] = hnswNode{id: item.ID, vector: item.Vector, metadata: item.Metadata, neighbors: graph.Neighbors[i]}
+		h.ids[item.ID] = int32(i)
+	}
+	if len(items) > 0 {
+		if graph.Entry < 0 || int(graph.Entry) >= len(items) {
+			return nil, fmt.Errorf("vector index snapshot has an invalid entry point %d", graph.Entry)
+		}
+		h.entry, h.maxLevel = graph.Entry, len(graph.Neighbors[graph.Entry])-1
+	}
+	return h, nil
+}
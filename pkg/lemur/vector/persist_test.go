@@ -0,0 +1,171 @@
+package vector_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	_ "modernc.org/sqlite"
+
+	. "chatgpt-go/pkg/lemur/vector"
+)
+
+func fillIndex(t *testing.T, index Index, n int) {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	for i, v := range randomVectors(rng, n, index.Dim()) {
+		if err := index.Add(strconv.Itoa(i), v, Metadata{"n": strconv.Itoa(i)}); err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+	}
+}
+
+// checkSameSearch checks that got returns the same results as want.
+func checkSameSearch(t *testing.T, want, got Index) {
+	t.Helper()
+	if got.Len() != want.Len() || got.Dim() != want.Dim() {
+		t.Fatalf("Expected %d vectors of %d dimensions, got %d of %d", want.Len(), want.Dim(), got.Len(), got.Dim())
+	}
+	rng := rand.New(rand.NewSource(2))
+	for _, query := range randomVectors(rng, 10, want.Dim()) {
+		expected, _ := want.Search(query, 5, nil)
+		results, err := got.Search(query, 5, nil)
+		if err != nil {
+			t.Fatalf("Search error: %v", err)
+		}
+		if !reflect.DeepEqual(resultIDs(results), resultIDs(expected)) {
+			t.Errorf("Expected results %v, got %v", resultIDs(expected), resultIDs(results))
+		}
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	for _, index := range []Index{NewFlat(8), NewHNSW(8, HNSWConfig{M: 4})} {
+		fillIndex(t, index, 200)
+		index.Remove("7")
+
+		var buf bytes.Buffer
+		if err := Save(&buf, index); err != nil {
+			t.Fatalf("Save error: %v", err)
+		}
+		loaded, err := Load(&buf)
+		if err != nil {
+			t.Fatalf("Load error: %v", err)
+		}
+		if reflect.TypeOf(loaded) != reflect.TypeOf(index) {
+			t.Errorf("Expected a %T, got a %T", index, loaded)
+		}
+		checkSameSearch(t, index, loaded)
+	}
+}
+
+func TestSaveLoadFile(t *testing.T) {
+	index := NewHNSW(8, HNSWConfig{})
+	fillIndex(t, index, 100)
+	path := filepath.Join(t.TempDir(), "index.gob")
+	if err := SaveFile(path, index); err != nil {
+		t.Fatalf("SaveFile error: %v", err)
+	}
+	loaded, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile error: %v", err)
+	}
+	checkSameSearch(t, index, loaded)
+
+	if err = loaded.Add("new", make([]float32, 8), nil); err != nil || loaded.Len() != 101 {
+		t.Errorf("Expected a loaded index to accept new vectors, got %v", err)
+	}
+}
+
+func TestSaveLoadSQL(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "vectors.db"))
+	if err != nil {
+		t.Fatalf("sql.Open error: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	index := NewFlat(8)
+	fillIndex(t, index, 50)
+	if err = SaveSQL(ctx, db, "vectors", index); err != nil {
+		t.Fatalf("SaveSQL error: %v", err)
+	}
+	// Saving again replaces the rows.
+	index.Remove("3")
+	if err = SaveSQL(ctx, db, "vectors", index); err != nil {
+		t.Fatalf("SaveSQL error: %v", err)
+	}
+
+	loaded := NewHNSW(8, HNSWConfig{})
+	if err = LoadSQL(ctx, db, "vectors", loaded); err != nil {
+		t.Fatalf("LoadSQL error: %v", err)
+	}
+	checkSameSearch(t, index, loaded)
+	results, _ := loaded.Search(index.Items()[0].Vector, 1, nil)
+	if len(results) != 1 || results[0].Metadata["n"] != results[0].ID {
+		t.Errorf("Expected the metadata to be loaded, got %+v", results)
+	}
+
+	if err = SaveSQL(ctx, db, "vectors; DROP TABLE x", index); !errors.Is(err, ErrInvalidTableName) {
+		t.Errorf("Expected ErrInvalidTableName, got %v", err)
+	}
+}
+
+func TestSaveLoadAfterRemovals(t *testing.T) {
+	const (
+		n   = 2000
+		dim = 16
+		k   = 10
+	)
+	rng := rand.New(rand.NewSource(1))
+	flat := NewFlat(dim)
+	index := NewHNSW(dim, HNSWConfig{M: 4, Seed: 1})
+	for i, v := range randomVectors(rng, n, dim) {
+		_ = index.Add(strconv.Itoa(i), v, nil)
+		// Most vectors are removed, which would leave the saved graph split into parts.
+		if i%5 == 0 {
+			_ = flat.Add(strconv.Itoa(i), v, nil)
+		} else {
+			index.Remove(strconv.Itoa(i))
+		}
+	}
+	path := filepath.Join(t.TempDir(), "index.gob")
+	if err := SaveFile(path, index); err != nil {
+		t.Fatalf("SaveFile error: %v", err)
+	}
+	loaded, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile error: %v", err)
+	}
+	if loaded.Len() != flat.Len() {
+		t.Fatalf("Expected %d vectors, got %d", flat.Len(), loaded.Len())
+	}
+
+	found := 0
+	queries := randomVectors(rng, 50, dim)
+	for _, query := range queries {
+		exact, _ := flat.Search(query, k, nil)
+		approximate, searchErr := loaded.Search(query, k, nil)
+		if searchErr != nil {
+			t.Fatalf("Search error: %v", searchErr)
+		}
+		ids := make(map[string]bool)
+		for _, result := range approximate {
+			ids[result.ID] = true
+		}
+		for _, result := range exact {
+			if ids[result.ID] {
+				found++
+			}
+		}
+	}
+	if recall := float64(found) / float64(len(queries)*k); recall < 0.9 {
+		t.Errorf("Expected a recall of at least 0.9 after loading, got %v", recall)
+	}
+}
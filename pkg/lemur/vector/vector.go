@@ -0,0 +1,198 @@
+// Package vector provides in-process similarity search over embeddings.
+//
+// Vectors are normalized when they are added, so that the cosine similarity of two vectors is
+// their dot product. Flat searches every vector and is exact; HNSW searches a graph and is much
+// faster for large sets, at the cost of a small loss of recall. Both can be saved to a file with
+// Save or to a SQL database with SaveSQL.
+package vector
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	ErrDimensionMismatch = errors.New("vector has the wrong number of dimensions")
+	ErrEmptyID           = errors.New("vector id must not be empty")
+)
+
+// Metadata is attached to the vectors of an index, and can be used to filter search results.
+type Metadata map[string]string
+
+// Filter reports whether a vector with the given metadata may be returned by a search.
+type Filter func(metadata Metadata) bool
+
+// Match returns a filter accepting the vectors whose metadata has key set to value.
+func Match(key, value string) Filter {
+	return func(metadata Metadata) bool {
+		v, ok := metadata[key]
+		return ok && v == value
+	}
+}
+
+// All returns a filter accepting the vectors accepted by every filter.
+func All(filters ...Filter) Filter {
+	return func(metadata Metadata) bool {
+		for _, filter := range filters {
+			if !filter(metadata) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Item is a vector stored in an index.
+type Item struct {
+	ID       string
+	Vector   []float32
+	Metadata Metadata
+}
+
+// Result is a vector found by a search, with its cosine similarity to the query.
+type Result struct {
+	ID       string
+	Score    float32
+	Metadata Metadata
+}
+
+// Index stores vectors and finds the ones most similar to a query. Implementations are safe for concurrent use.
+type Index interface {
+	// Dim returns the number of dimensions of the vectors.
+	Dim() int
+	// Len returns the number of vectors.
+	Len() int
+	// Add adds a vector, replacing the vector with the same id if any.
+	Add(id string, vector []float32, metadata Metadata) error
+	// Remove removes the vector with the given id, and reports whether it was there.
+	Remove(id string) bool
+	// Search returns the k vectors most similar to query which are accepted by filter,
+	// most similar first. A nil filter accepts every vector.
+	Search(query []float32, k int, filter Filter) ([]Result, error)
+	// Items returns every vector of the index, normalized.
+	Items() []Item
+}
+
+// Dot returns the dot product of a and b, which must have the same length.
+//
+// The loop is unrolled with independent accumulators, so that the compiler can eliminate bounds
+// checks and the CPU can pipeline the multiplications.
+func Dot(a, b []float32) float32 {
+	if len(a) != len(b) {
+		panic(fmt.Sprintf("vector: dot product of vectors of lengths %d and %d", len(a), len(b)))
+	}
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		x, y := a[i:i+4:i+4], b[i:i+4:i+4]
+		s0 += x[0] * y[0]
+		s1 += x[1] * y[1]
+		s2 += x[2] * y[2]
+		s3 += x[3] * y[3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return s0 + s1 + s2 + s3
+}
+
+// Normalize returns a copy of v scaled to a length of 1. The zero vector stays zero.
+func Normalize(v []float32) []float32 {
+	normalized := make([]float32, len(v))
+	norm := math.Sqrt(float64(Dot(v, v)))
+	if norm == 0 {
+		return normalized
+	}
+	scale := float32(1 / norm)
+	for i, x := range v {
+		normalized[i] = x * scale
+	}
+	return normalized
+}
+
+// Cosine returns the cosine similarity of a and b, which must have the same length.
+func Cosine(a, b []float32) float32 {
+	return Dot(Normalize(a), Normalize(b))
+}
+
+func checkDim(dim int, vector []float32) error {
+	if len(vector) != dim {
+		return fmt.Errorf("%w: %d instead of %d", ErrDimensionMismatch, len(vector), dim)
+	}
+	return nil
+}
+
+// topK keeps the k results with the highest scores, in a min-heap.
+type topK struct {
+	k       int
+	results []Result
+}
+
+func newTopK(k int) *topK {
+	return &topK{k: k, results: make([]Result, 0, k)}
+}
+
+// full reports whether k results are kept, so that only better results can be pushed.
+func (t *topK) full() bool {
+	return len(t.results) == t.k
+}
+
+// min returns the lowest score kept.
+func (t *topK) min() float32 {
+	return t.results[0].Score
+}
+
+func (t *topK) push(result Result) {
+	if t.k <= 0 {
+		return
+	}
+	if !t.full() {
+		t.results = append(t.results, result)
+		up(t.results, len(t.results)-1)
+		return
+	}
+	if result.Score <= t.min() {
+		return
+	}
+	t.results[0] = result
+	down(t.results, 0)
+}
+
+// sorted returns the results kept, highest score first. The heap is consumed.
+func (t *topK) sorted() []Result {
+	results := t.results
+	for n := len(results) - 1; n > 0; n-- {
+		results[0], results[n] = results[n], results[0]
+		down(results[:n], 0)
+	}
+	return results
+}
+
+func up(h []Result, i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if h[parent].Score <= h[i].Score {
+			return
+		}
+		h[parent], h[i] = h[i], h[parent]
+		i = parent
+	}
+}
+
+func down(h []Result, i int) {
+	for {
+		smallest, left, right := i, 2*i+1, 2*i+2
+		if left < len(h) && h[left].Score < h[smallest].Score {
+			smallest = left
+		}
+		if right < len(h) && h[right].Score < h[smallest].Score {
+			smallest = right
+		}
+		if smallest == i {
+			return
+		}
+		h[i], h[smallest] = h[smallest], h[i]
+		i = smallest
+	}
+}
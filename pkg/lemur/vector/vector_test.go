@@ -0,0 +1,180 @@
+package vector_test
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	. "chatgpt-go/pkg/lemur/vector"
+)
+
+func randomVectors(rng *rand.Rand, n, dim int) [][]float32 {
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = make([]float32, dim)
+		for j := range vectors[i] {
+			vectors[i][j] = float32(rng.NormFloat64())
+		}
+	}
+	return vectors
+}
+
+func resultIDs(results []Result) []string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	return ids
+}
+
+func TestDot(t *testing.T) {
+	a := []float32{1, 2, 3, 4, 5}
+	b := []float32{5, 4, 3, 2, 1}
+	if got := Dot(a, b); got != 35 {
+		t.Errorf("Expected 35, got %v", got)
+	}
+	if got := Cosine([]float32{3, 0}, []float32{1, 1}); math.Abs(float64(got)-math.Sqrt2/2) > 1e-6 {
+		t.Errorf("Expected sqrt(2)/2, got %v", got)
+	}
+	if got := Normalize([]float32{0, 0}); got[0] != 0 || got[1] != 0 {
+		t.Errorf("Expected the zero vector, got %v", got)
+	}
+}
+
+func TestFlat(t *testing.T) {
+	index := NewFlat(2)
+	for _, item := range []Item{
+		{ID: "east", Vector: []float32{1, 0}, Metadata: Metadata{"lang": "en"}},
+		{ID: "north", Vector: []float32{0, 2}, Metadata: Metadata{"lang": "fr"}},
+		{ID: "north-east", Vector: []float32{3, 3}, Metadata: Metadata{"lang": "en", "kind": "diagonal"}},
+		{ID: "west", Vector: []float32{-1, 0}},
+	} {
+		if err := index.Add(item.ID, item.Vector, item.Metadata); err != nil {
+			t.Fatalf("Add(%s) error: %v", item.ID, err)
+		}
+	}
+
+	results, err := index.Search([]float32{1, 0.1}, 2, nil)
+	if err != nil {
+		t.Fatalf("Search error: %v", err)
+	}
+	if ids := resultIDs(results); len(ids) != 2 || ids[0] != "east" || ids[1] != "north-east" {
+		t.Errorf("Unexpected results %v", ids)
+	}
+	if math.Abs(float64(results[1].Score)-float64(Cosine([]float32{1, 0.1}, []float32{1, 1}))) > 1e-6 {
+		t.Errorf("Unexpected score %v", results[1].Score)
+	}
+
+	results, _ = index.Search([]float32{1, 0}, 10, All(Match("lang", "en"), Match("kind", "diagonal")))
+	if ids := resultIDs(results); len(ids) != 1 || ids[0] != "north-east" {
+		t.Errorf("Unexpected filtered results %v", ids)
+	}
+
+	if !index.Remove("east") || index.Remove("east") || index.Len() != 3 {
+		t.Errorf("Unexpected Remove result, %d vectors left", index.Len())
+	}
+	_ = index.Add("west", []float32{1, 0.2}, nil)
+	results, _ = index.Search([]float32{1, 0}, 1, nil)
+	if ids := resultIDs(results); len(ids) != 1 || ids[0] != "west" || index.Len() != 3 {
+		t.Errorf("Expected the replaced vector, got %v", ids)
+	}
+
+	if _, err = index.Search([]float32{1}, 1, nil); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+	if err = index.Add("", []float32{1, 0}, nil); !errors.Is(err, ErrEmptyID) {
+		t.Errorf("Expected ErrEmptyID, got %v", err)
+	}
+	if results, _ = index.Search([]float32{1, 0}, 0, nil); len(results) != 0 {
+		t.Errorf("Expected no results for k = 0, got %v", results)
+	}
+}
+
+func TestHNSWRecall(t *testing.T) {
+	const (
+		n   = 2000
+		dim = 32
+		k   = 10
+	)
+	rng := rand.New(rand.NewSource(1))
+	vectors := randomVectors(rng, n, dim)
+	flat := NewFlat(dim)
+	hnsw := NewHNSW(dim, HNSWConfig{Seed: 1})
+	for i, v := range vectors {
+		metadata := Metadata{"parity": []string{"even", "odd"}[i%2]}
+		_ = flat.Add(strconv.Itoa(i), v, metadata)
+		_ = hnsw.Add(strconv.Itoa(i), v, metadata)
+	}
+
+	recall := func(filter Filter) float64 {
+		found := 0
+		queries := randomVectors(rng, 50, dim)
+		for _, query := range queries {
+			exact, _ := flat.Search(query, k, filter)
+			approximate, err := hnsw.Search(query, k, filter)
+			if err != nil {
+				t.Fatalf("Search error: %v", err)
+			}
+			ids := make(map[string]bool)
+			for _, result := range approximate {
+				if filter != nil && !filter(result.Metadata) {
+					t.Fatalf("Result %s isn't accepted by the filter", result.ID)
+				}
+				ids[result.ID] = true
+			}
+			for _, result := range exact {
+				if ids[result.ID] {
+					found++
+				}
+			}
+		}
+		return float64(found) / float64(len(queries)*k)
+	}
+	if r := recall(nil); r < 0.9 {
+		t.Errorf("Expected a recall of at least 0.9, got %v", r)
+	}
+	if r := recall(Match("parity", "odd")); r < 0.9 {
+		t.Errorf("Expected a filtered recall of at least 0.9, got %v", r)
+	}
+}
+
+func TestHNSWRemove(t *testing.T) {
+	index := NewHNSW(2, HNSWConfig{})
+	_ = index.Add("east", []float32{1, 0}, nil)
+	_ = index.Add("north", []float32{0, 1}, nil)
+	_ = index.Add("east", []float32{-1, 0}, Metadata{"moved": "true"})
+
+	results, _ := index.Search([]float32{1, 0}, 3, nil)
+	if ids := resultIDs(results); len(ids) != 2 || ids[0] != "north" || ids[1] != "east" || results[1].Metadata["moved"] != "true" {
+		t.Errorf("Expected the replaced vector, got %v", ids)
+	}
+	if !index.Remove("north") || index.Remove("north") || index.Len() != 1 || len(index.Items()) != 1 {
+		t.Errorf("Unexpected Remove result, %d vectors left", index.Len())
+	}
+	results, _ = index.Search([]float32{0, 1}, 3, nil)
+	if ids := resultIDs(results); len(ids) != 1 || ids[0] != "east" {
+		t.Errorf("Expected only the remaining vector, got %v", ids)
+	}
+}
+
+func benchmarkSearch(b *testing.B, index Index) {
+	rng := rand.New(rand.NewSource(1))
+	for i, v := range randomVectors(rng, 10000, 256) {
+		_ = index.Add(strconv.Itoa(i), v, nil)
+	}
+	queries := randomVectors(rng, 100, 256)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = index.Search(queries[i%len(queries)], 10, nil)
+	}
+}
+
+func BenchmarkFlatSearch(b *testing.B) {
+	benchmarkSearch(b, NewFlat(256))
+}
+
+func BenchmarkHNSWSearch(b *testing.B) {
+	benchmarkSearch(b, NewHNSW(256, HNSWConfig{}))
+}
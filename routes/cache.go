@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"chatgpt-go/model"
+	"chatgpt-go/service"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 回放缓存的回答时每帧的字符数
+const cacheReplayChunkSize = 16
+
+// lemurCacheScope 是 lemur 接口的缓存范围，lemur 接口的请求中没有模型名
+const lemurCacheScope = "lemur"
+
+// cacheBypassed 返回请求是否要求跳过缓存，options.noCache 为 true 或请求头带 Cache-Control: no-cache
+func cacheBypassed(c *gin.Context, req model.ChatRequest) bool {
+	return req.Options.NoCache || strings.Contains(strings.ToLower(c.GetHeader("Cache-Control")), "no-cache")
+}
+
+// lookupCache 在启用了语义缓存时查找问题的回答，并在响应头 X-Cache 中注明是否命中。
+// 返回的 query 不为 nil 时，应在得到上游的回答后保存到缓存。
+func lookupCache(c *gin.Context, req model.ChatRequest, scope string, contextParts ...string) (string, *service.CacheQuery, bool) {
+	cache := service.Cache()
+	if !cache.Enabled() {
+		return "", nil, false
+	}
+	if cacheBypassed(c, req) {
+		cache.Bypass()
+		c.Header("X-Cache", "BYPASS")
+		return "", nil, false
+	}
+
+	answer, query, ok, err := cache.Lookup(c.Request.Context(), scope, service.ContextHash(contextParts...), req.Prompt)
+	if err != nil {
+		fmt.Printf("Semantic cache lookup error: %v\n", err)
+		return "", nil, false
+	}
+	if ok {
+		c.Header("X-Cache", "HIT")
+	} else {
+		c.Header("X-Cache", "MISS")
+	}
+	return answer, query, ok
+}
+
+// replayAnswer 把缓存的回答分成多帧流式写出，frame 根据累计的文本和本帧的增量构造一帧
+func replayAnswer(c *gin.Context, flusher http.Flusher, answer string, frame func(text, delta string) any) error {
+	rc := http.NewResponseController(c.Writer)
+	runes := []rune(answer)
+	for start := 0; start < len(runes); start += cacheReplayChunkSize {
+		end := min(start+cacheReplayChunkSize, len(runes))
+		extendWriteDeadline(rc)
+		if err := writeFrame(c.Writer, flusher, frame(string(runes[:end]), string(runes[start:end]))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func CacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "Success",
+		"message": "",
+		"data":    service.Cache().Stats(),
+	})
+}
@@ -0,0 +1,254 @@
+package routes
+
+import (
+	"chatgpt-go/model"
+	"chatgpt-go/service"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"chatgpt-go/pkg/lemur"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// imageCommand 是在对话中生成图片的命令，如 /image 一只在月球上的猫
+const imageCommand = "/image"
+
+// ImagePath 是保存的图片对外的路径，由 ServeImages 处理
+const ImagePath = "/images"
+
+// 上传图片的请求大小上限，包括图片和遮罩
+const maxImageUploadSize = 2*service.MaxImageBytes + 1<<20
+
+const imageCommandUsage = "用法：" + imageCommand + " <图片描述>"
+
+// parseImageCommand 返回 /image 命令中的图片描述，prompt 不是 /image 命令时返回 false
+func parseImageCommand(prompt string) (string, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(prompt), imageCommand)
+	if !ok {
+		return "", false
+	}
+	if r, _ := utf8.DecodeRuneInString(rest); rest != "" && !unicode.IsSpace(r) {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
+
+// imageMarkdown 把图片写成 markdown，作为助手的回答记录在对话中
+func imageMarkdown(alt string, names []string) string {
+	alt = strings.NewReplacer("[", "", "]", "", "\n", " ").Replace(alt)
+	images := make([]string, len(names))
+	for i, name := range names {
+		images[i] = fmt.Sprintf("![%s](%s/%s)", alt, ImagePath, name)
+	}
+	return strings.Join(images, "\n\n")
+}
+
+// recordImages 把请求和生成的图片作为一问一答记录到对话中，返回两条消息的 id
+func recordImages(chatStorage *ChatStorage, parentMessageId, question, answer string) (string, string) {
+	if parentMessageId == "" {
+		parentMessageId = "chatcmpl-start"
+	}
+	questionId := uuid.NewString()
+	err := chatStorage.AddMessage(questionId, parentMessageId, lemur.ChatCompletionMessage{
+		Role:    lemur.ChatMessageRoleUser,
+		Content: question,
+	})
+	if err != nil {
+		fmt.Println("Error when chatStorage.AddMessage", err)
+	}
+	answerId := uuid.NewString()
+	err = chatStorage.AddMessage(answerId, questionId, lemur.ChatCompletionMessage{
+		Role:    lemur.ChatMessageRoleAssistant,
+		Content: answer,
+	})
+	if err != nil {
+		fmt.Println("Error when chatStorage.AddMessage", err)
+	}
+	return questionId, answerId
+}
+
+// abortImageError 返回生成图片的错误，图片格式不对是客户端的错误，其他的是上游的错误
+func abortImageError(c *gin.Context, err error) {
+	status := http.StatusBadGateway
+	if errors.Is(err, service.ErrUnsupportedImage) || errors.Is(err, service.ErrImageNotPNG) {
+		status = http.StatusBadRequest
+	}
+	c.AbortWithStatusJSON(status, gin.H{"status": "Error", "message": err.Error(), "data": nil})
+}
+
+// imageChat 处理对话中的 /image 命令：生成图片，记录到对话中，并把图片的 markdown 作为一帧回答写出。
+// frame 根据回答的 id、上一条消息的 id 和回答的文本构造一帧。
+func imageChat(c *gin.Context, flusher http.Flusher, chatStorage *ChatStorage, req model.ChatRequest, description string,
+	frame func(id, parentMessageId, text string) any) {
+	rc := http.NewResponseController(c.Writer)
+	if description == "" {
+		extendWriteDeadline(rc)
+		if err := writeFrame(c.Writer, flusher, frame(uuid.NewString(), req.Options.ParentMessageId, imageCommandUsage)); err != nil {
+			fmt.Printf("Error when Writing response: %v\n", err)
+		}
+		return
+	}
+
+	names, err := service.GenerateImages(c.Request.Context(), lemur.ImageRequest{Prompt: description})
+	if err != nil {
+		fmt.Printf("CreateImage error: %v\n", err)
+		abortImageError(c, err)
+		return
+	}
+	answer := imageMarkdown(description, names)
+	questionId, answerId := recordImages(chatStorage, req.Options.ParentMessageId, req.Prompt, answer)
+
+	extendWriteDeadline(rc)
+	if err = writeFrame(c.Writer, flusher, frame(answerId, questionId, answer)); err != nil {
+		fmt.Printf("Error when Writing response: %v\n", err)
+	}
+}
+
+// CreateImage 生成图片。JSON 请求根据描述生成图片；multipart 请求上传 image（可选 mask），
+// 有描述时按描述修改图片，没有时生成图片的变体。生成的图片保存在本地，并记录到对话中。
+func CreateImage(chatStorage *ChatStorage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var (
+			req      model.ImageRequest
+			names    []string
+			question string
+			err      error
+		)
+		if strings.HasPrefix(c.ContentType(), "multipart/") {
+			req, names, question, err = editImage(c)
+			if err != nil {
+				return
+			}
+		} else {
+			if err = c.BindJSON(&req); err != nil {
+				return
+			}
+			if strings.TrimSpace(req.Prompt) == "" {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "Error", "message": "Missing prompt", "data": nil})
+				return
+			}
+			names, err = service.GenerateImages(c.Request.Context(), lemur.ImageRequest{Prompt: req.Prompt, N: req.N, Size: req.Size})
+			if err != nil {
+				abortImageError(c, err)
+				return
+			}
+			question = imageCommand + " " + req.Prompt
+		}
+
+		answer := imageMarkdown(req.Prompt, names)
+		questionId, answerId := recordImages(chatStorage, req.Options.ParentMessageId, question, answer)
+		images := make([]string, len(names))
+		for i, name := range names {
+			images[i] = ImagePath + "/" + name
+		}
+		extendWriteDeadline(http.NewResponseController(c.Writer))
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "Success",
+			"message": "",
+			"data": model.ImageResponse{
+				Id:              answerId,
+				ParentMessageId: questionId,
+				Text:            answer,
+				Images:          images,
+			},
+		})
+	}
+}
+
+// editImage 处理上传图片的请求，返回请求参数、生成的图片和记录到对话中的问题。
+// 出错时已经向客户端返回了错误。
+func editImage(c *gin.Context) (req model.ImageRequest, names []string, question string, err error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImageUploadSize)
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["image"]) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "Error", "message": "No image uploaded", "data": nil})
+		return req, nil, "", errors.New("no image uploaded")
+	}
+	req.Prompt = strings.TrimSpace(c.PostForm("prompt"))
+	req.Size = c.PostForm("size")
+	req.Options.ParentMessageId = c.PostForm("parentMessageId")
+	if n := c.PostForm("n"); n != "" {
+		if req.N, err = strconv.Atoi(n); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "Error", "message": "Invalid n", "data": nil})
+			return req, nil, "", err
+		}
+	}
+
+	image, err := readUpload(form.File["image"][0])
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return req, nil, "", err
+	}
+	var mask []byte
+	if len(form.File["mask"]) > 0 {
+		if mask, err = readUpload(form.File["mask"][0]); err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return req, nil, "", err
+		}
+	}
+
+	if req.Prompt != "" {
+		names, err = service.EditImages(c.Request.Context(), req.Prompt, image, mask, req.N, req.Size)
+	} else {
+		names, err = service.ImageVariations(c.Request.Context(), image, req.N, req.Size)
+	}
+	if err != nil {
+		abortImageError(c, err)
+		return req, nil, "", err
+	}
+
+	// 生成成功后再保存上传的图片，记录在对话的问题中，避免失败的请求留下无用的图片
+	uploaded, err := service.SaveImage(image)
+	if err != nil {
+		abortImageError(c, err)
+		return req, nil, "", err
+	}
+	question = imageMarkdown(req.Prompt, []string{uploaded})
+	if req.Prompt != "" {
+		question += "\n\n" + req.Prompt
+	}
+	return req, names, question, nil
+}
+
+// ServeImages 返回保存的图片。根路径已经由前端的静态文件占用，gin 不允许再注册 GET 路由，
+// 所以用中间件在静态文件之前处理 ImagePath 下的请求。
+func ServeImages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+		name, ok := strings.CutPrefix(c.Request.URL.Path, ImagePath+"/")
+		if !ok {
+			c.Next()
+			return
+		}
+		// 只允许 SaveImage 生成的文件名，避免访问目录外的文件
+		if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		c.File(filepath.Join(service.ImageDir(), name))
+		c.Abort()
+	}
+}
+
+func readUpload(header *multipart.FileHeader) ([]byte, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
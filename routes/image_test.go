@@ -0,0 +1,176 @@
+package routes
+
+import (
+	"bytes"
+	"chatgpt-go/global"
+	"chatgpt-go/service"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseImageCommand(t *testing.T) {
+	for prompt, want := range map[string]string{
+		"/image 一只猫":     "一只猫",
+		"  /image\t一只猫 ": "一只猫",
+		"/image":         "",
+	} {
+		if description, ok := parseImageCommand(prompt); !ok || description != want {
+			t.Errorf("parseImageCommand(%q) = %q, %v", prompt, description, ok)
+		}
+	}
+	for _, prompt := range []string{"/images 一只猫", "画一只猫", "image 一只猫"} {
+		if _, ok := parseImageCommand(prompt); ok {
+			t.Errorf("expected %q not to be a command", prompt)
+		}
+	}
+}
+
+func TestImageMarkdown(t *testing.T) {
+	got := imageMarkdown("一只[猫]", []string{"a.png", "b.png"})
+	want := "![一只猫](/images/a.png)\n\n![一只猫](/images/b.png)"
+	if got != want {
+		t.Errorf("imageMarkdown = %q, want %q", got, want)
+	}
+}
+
+func testImage(t *testing.T, encode func(*bytes.Buffer, image.Image) error) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.White)
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testPNG(t *testing.T) []byte {
+	return testImage(t, func(buf *bytes.Buffer, img image.Image) error { return png.Encode(buf, img) })
+}
+
+func testJPEG(t *testing.T) []byte {
+	return testImage(t, func(buf *bytes.Buffer, img image.Image) error { return jpeg.Encode(buf, img, nil) })
+}
+
+func TestServeImages(t *testing.T) {
+	defer func(config global.SystemConfig) { global.Config = config }(global.Config)
+	root := t.TempDir()
+	global.Config.System.ImageDir = filepath.Join(root, "images")
+
+	data := testPNG(t)
+	name, err := service.SaveImage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 图片目录外的文件和临时文件都不能访问
+	if err = os.WriteFile(filepath.Join(root, "config.yaml"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(service.ImageDir(), ".image-tmp"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ServeImages())
+	for path, want := range map[string]int{
+		ImagePath + "/../config.yaml":     http.StatusNotFound,
+		ImagePath + "/%2e%2e/config.yaml": http.StatusNotFound,
+		ImagePath + "/.image-tmp":         http.StatusNotFound,
+		ImagePath + "/missing.png":        http.StatusNotFound,
+		ImagePath + "/" + name:            http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Errorf("GET %s: got %d, want %d", path, w.Code, want)
+		}
+		if strings.Contains(w.Body.String(), "secret") {
+			t.Errorf("GET %s returned a file outside the image directory", path)
+		}
+		if want == http.StatusOK && !bytes.Equal(w.Body.Bytes(), data) {
+			t.Errorf("GET %s: unexpected body", path)
+		}
+	}
+}
+
+func TestCreateImageBadRequest(t *testing.T) {
+	defer func(config global.SystemConfig) { global.Config = config }(global.Config)
+	global.Config.System.ImageDir = t.TempDir()
+	chatStorage, err := NewChatStorage(filepath.Join(t.TempDir(), "database.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chatStorage.Close()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/image", CreateImage(chatStorage))
+
+	multipartBody := func(fields map[string]string, files map[string][]byte) (string, *bytes.Buffer) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for key, value := range fields {
+			mw.WriteField(key, value)
+		}
+		for key, data := range files {
+			fw, _ := mw.CreateFormFile(key, key+".png")
+			fw.Write(data)
+		}
+		mw.Close()
+		return mw.FormDataContentType(), &body
+	}
+
+	for _, test := range []struct {
+		name        string
+		contentType string
+		body        *bytes.Buffer
+	}{
+		{"invalid json", "application/json", bytes.NewBufferString("{")},
+		{"missing prompt", "application/json", bytes.NewBufferString(`{"prompt":" "}`)},
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/image", test.body)
+		req.Header.Set("Content-Type", test.contentType)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", test.name, w.Code)
+		}
+	}
+
+	for _, test := range []struct {
+		name   string
+		fields map[string]string
+		files  map[string][]byte
+	}{
+		{"no image", map[string]string{"prompt": "一只猫"}, nil},
+		{"invalid n", map[string]string{"n": "two"}, map[string][]byte{"image": testPNG(t)}},
+		{"jpeg edit", map[string]string{"prompt": "一只猫"}, map[string][]byte{"image": testJPEG(t)}},
+		{"jpeg mask", map[string]string{"prompt": "一只猫"}, map[string][]byte{"image": testPNG(t), "mask": testJPEG(t)}},
+	} {
+		contentType, body := multipartBody(test.fields, test.files)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/image", body)
+		req.Header.Set("Content-Type", contentType)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400: %s", test.name, w.Code, w.Body)
+		}
+	}
+
+	// 失败的请求不保存上传的图片
+	if entries, _ := os.ReadDir(service.ImageDir()); len(entries) != 0 {
+		t.Errorf("expected no saved images, got %d", len(entries))
+	}
+}
@@ -0,0 +1,479 @@
+package routes
+
+import (
+	"chatgpt-go/model"
+	"chatgpt-go/service"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"chatgpt-go/pkg/lemur/vector"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 上传文档的请求体大小上限
+const maxKnowledgeUploadSize = 20 << 20
+
+var (
+	ErrKnowledgeBaseNotFound = errors.New("knowledge base not found")
+	// ErrEmbeddingDimension 表示向量的维度与知识库的不同，通常是更换了向量模型
+	ErrEmbeddingDimension = errors.New("embedding dimension doesn't match the knowledge base, " +
+		"the embedding model was probably changed: create a new knowledge base for it")
+)
+
+// KnowledgeStorage 保存知识库和文档片段，与聊天记录使用同一个数据库
+type KnowledgeStorage struct {
+	db *sql.DB
+
+	mu sync.Mutex
+	// indexes 缓存各知识库片段的向量索引，第一次检索时从数据库加载，上传文档后失效
+	indexes map[int64]*vector.Flat
+}
+
+func NewKnowledgeStorage(chatStorage *ChatStorage) (*KnowledgeStorage, error) {
+	_, err := chatStorage.db.Exec(`
+        CREATE TABLE IF NOT EXISTS knowledge_base (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name varchar(255) NOT NULL UNIQUE,
+            description TEXT NOT NULL DEFAULT '',
+            created_at INTEGER NOT NULL,
+            embedding_dim INTEGER NOT NULL DEFAULT 0
+        );
+        CREATE TABLE IF NOT EXISTS knowledge_chunk (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            knowledge_base_id INTEGER NOT NULL,
+            source varchar(255) NOT NULL,
+            chunk_index INTEGER NOT NULL,
+            content TEXT NOT NULL,
+            embedding BLOB NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS knowledge_chunk_base ON knowledge_chunk (knowledge_base_id, source);
+    `)
+	if err != nil {
+		return nil, err
+	}
+	// 之前创建的数据库没有 embedding_dim 列
+	var hasDim int
+	err = chatStorage.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('knowledge_base') WHERE name = 'embedding_dim'").Scan(&hasDim)
+	if err == nil && hasDim == 0 {
+		_, err = chatStorage.db.Exec("ALTER TABLE knowledge_base ADD COLUMN embedding_dim INTEGER NOT NULL DEFAULT 0")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &KnowledgeStorage{db: chatStorage.db, indexes: make(map[int64]*vector.Flat)}, nil
+}
+
+func (k *KnowledgeStorage) CreateKnowledgeBase(name, description string) (model.KnowledgeBase, error) {
+	kb := model.KnowledgeBase{Name: name, Description: description, CreatedAt: time.Now().Unix()}
+	result, err := k.db.Exec("INSERT INTO knowledge_base (name,description,created_at) VALUES (?,?,?)",
+		kb.Name, kb.Description, kb.CreatedAt)
+	if err != nil {
+		return model.KnowledgeBase{}, err
+	}
+	kb.Id, err = result.LastInsertId()
+	return kb, err
+}
+
+func (k *KnowledgeStorage) ListKnowledgeBases() ([]model.KnowledgeBase, error) {
+	rows, err := k.db.Query(`
+        SELECT b.id, b.name, b.description, b.created_at, b.embedding_dim,
+            (SELECT COUNT(*) FROM knowledge_chunk c WHERE c.knowledge_base_id = b.id)
+        FROM knowledge_base b ORDER BY b.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	knowledgeBases := make([]model.KnowledgeBase, 0)
+	for rows.Next() {
+		var kb model.KnowledgeBase
+		if err = rows.Scan(&kb.Id, &kb.Name, &kb.Description, &kb.CreatedAt, &kb.EmbeddingDim, &kb.Chunks); err != nil {
+			return nil, err
+		}
+		knowledgeBases = append(knowledgeBases, kb)
+	}
+	return knowledgeBases, rows.Err()
+}
+
+// GetKnowledgeBase 按名称查找知识库
+func (k *KnowledgeStorage) GetKnowledgeBase(name string) (model.KnowledgeBase, error) {
+	return k.getKnowledgeBase("name = ?", name)
+}
+
+// GetKnowledgeBaseById 按 id 查找知识库
+func (k *KnowledgeStorage) GetKnowledgeBaseById(id int64) (model.KnowledgeBase, error) {
+	return k.getKnowledgeBase("id = ?", id)
+}
+
+func (k *KnowledgeStorage) getKnowledgeBase(where string, arg any) (model.KnowledgeBase, error) {
+	var kb model.KnowledgeBase
+	err := k.db.QueryRow("SELECT id, name, description, created_at, embedding_dim FROM knowledge_base WHERE "+where, arg).
+		Scan(&kb.Id, &kb.Name, &kb.Description, &kb.CreatedAt, &kb.EmbeddingDim)
+	if errors.Is(err, sql.ErrNoRows) {
+		return kb, fmt.Errorf("%w: %v", ErrKnowledgeBaseNotFound, arg)
+	}
+	return kb, err
+}
+
+// KnowledgeDocument 是一个文档的片段和对应的向量
+type KnowledgeDocument struct {
+	Source     string
+	Chunks     []string
+	Embeddings [][]float32
+}
+
+// AddDocuments 在一个事务中保存文档的片段和向量，替换同名文档之前的片段。
+// 任何一个文档保存失败时，所有文档都不会保存。向量的维度与知识库的不同时返回 ErrEmbeddingDimension。
+func (k *KnowledgeStorage) AddDocuments(knowledgeBaseId int64, documents []KnowledgeDocument) (err error) {
+	for _, document := range documents {
+		if len(document.Chunks) != len(document.Embeddings) {
+			return fmt.Errorf("%s: %d embeddings for %d chunks", document.Source, len(document.Embeddings), len(document.Chunks))
+		}
+	}
+	tx, err := k.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 知识库的维度由第一次上传的向量决定。之前的知识库没有记录维度，以已有的片段为准。
+	var dim int
+	if err = tx.QueryRow("SELECT embedding_dim FROM knowledge_base WHERE id = ?", knowledgeBaseId).Scan(&dim); err != nil {
+		return err
+	}
+	if dim == 0 {
+		err = tx.QueryRow("SELECT length(embedding) / 4 FROM knowledge_chunk WHERE knowledge_base_id = ? LIMIT 1", knowledgeBaseId).Scan(&dim)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+	for _, document := range documents {
+		for _, embedding := range document.Embeddings {
+			if dim == 0 {
+				dim = len(embedding)
+			}
+			if len(embedding) != dim {
+				err = fmt.Errorf("%w: %s has %d dimensions instead of %d", ErrEmbeddingDimension, document.Source, len(embedding), dim)
+				return err
+			}
+		}
+	}
+	if _, err = tx.Exec("UPDATE knowledge_base SET embedding_dim = ? WHERE id = ?", dim, knowledgeBaseId); err != nil {
+		return err
+	}
+
+	for _, document := range documents {
+		_, err = tx.Exec("DELETE FROM knowledge_chunk WHERE knowledge_base_id = ? AND source = ?", knowledgeBaseId, document.Source)
+		if err != nil {
+			return err
+		}
+		for i, chunk := range document.Chunks {
+			_, err = tx.Exec("INSERT INTO knowledge_chunk (knowledge_base_id,source,chunk_index,content,embedding) VALUES (?,?,?,?,?)",
+				knowledgeBaseId, document.Source, i, chunk, encodeEmbedding(document.Embeddings[i]))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	delete(k.indexes, knowledgeBaseId)
+	k.mu.Unlock()
+	return nil
+}
+
+// Search 返回知识库中与 embedding 最相似的 topK 个片段
+func (k *KnowledgeStorage) Search(knowledgeBaseId int64, embedding []float32, topK int) ([]model.KnowledgeSource, error) {
+	index, err := k.index(knowledgeBaseId)
+	if err != nil || index == nil {
+		return nil, err
+	}
+	if index.Dim() != len(embedding) {
+		return nil, fmt.Errorf("%w: the question has %d dimensions instead of %d", ErrEmbeddingDimension, len(embedding), index.Dim())
+	}
+	results, err := index.Search(embedding, topK, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	// 一次查出所有片段，再按相似度的顺序排列
+	ids := make([]any, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	rows, err := k.db.Query("SELECT id, source, chunk_index, content FROM knowledge_chunk WHERE id IN (?"+
+		strings.Repeat(",?", len(ids)-1)+")", ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	chunks := make(map[string]model.KnowledgeSource, len(results))
+	for rows.Next() {
+		var (
+			id     int64
+			source model.KnowledgeSource
+		)
+		if err = rows.Scan(&id, &source.Source, &source.Chunk, &source.Content); err != nil {
+			return nil, err
+		}
+		chunks[strconv.FormatInt(id, 10)] = source
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sources := make([]model.KnowledgeSource, 0, len(results))
+	for _, result := range results {
+		source, ok := chunks[result.ID]
+		if !ok {
+			return nil, fmt.Errorf("knowledge chunk %s not found", result.ID)
+		}
+		source.Index, source.Score = len(sources)+1, result.Score
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// index 返回知识库的向量索引，知识库没有片段时返回 nil
+func (k *KnowledgeStorage) index(knowledgeBaseId int64) (*vector.Flat, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if index, ok := k.indexes[knowledgeBaseId]; ok {
+		return index, nil
+	}
+
+	rows, err := k.db.Query("SELECT id, embedding FROM knowledge_chunk WHERE knowledge_base_id = ?", knowledgeBaseId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var index *vector.Flat
+	for rows.Next() {
+		var (
+			id   int64
+			blob []byte
+		)
+		if err = rows.Scan(&id, &blob); err != nil {
+			return nil, err
+		}
+		embedding := decodeEmbedding(blob)
+		if index == nil {
+			index = vector.NewFlat(len(embedding))
+		}
+		if err = index.Add(strconv.FormatInt(id, 10), embedding, nil); err != nil {
+			if errors.Is(err, vector.ErrDimensionMismatch) {
+				err = ErrEmbeddingDimension
+			}
+			return nil, fmt.Errorf("knowledge chunk %d: %w", id, err)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if index != nil {
+		k.indexes[knowledgeBaseId] = index
+	}
+	return index, nil
+}
+
+// encodeEmbedding 把向量编码为小端序的 float32 序列
+func encodeEmbedding(embedding []float32) []byte {
+	blob := make([]byte, 4*len(embedding))
+	for i, x := range embedding {
+		binary.LittleEndian.PutUint32(blob[4*i:], math.Float32bits(x))
+	}
+	return blob
+}
+
+func decodeEmbedding(blob []byte) []float32 {
+	embedding := make([]float32, len(blob)/4)
+	for i := range embedding {
+		embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(blob[4*i:]))
+	}
+	return embedding
+}
+
+// retrieveKnowledge 检索知识库中与问题最相关的片段，返回加入上下文的提示和引用的片段
+func retrieveKnowledge(ctx context.Context, knowledge *KnowledgeStorage, name, question string) (string, []model.KnowledgeSource, error) {
+	kb, err := knowledge.GetKnowledgeBase(name)
+	if err != nil {
+		return "", nil, err
+	}
+	embeddings, err := service.Embed(ctx, []string{question})
+	if err != nil {
+		return "", nil, err
+	}
+	sources, err := knowledge.Search(kb.Id, embeddings[0], service.KnowledgeTopK())
+	if err != nil || len(sources) == 0 {
+		return "", nil, err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("请根据以下资料回答用户的问题，引用资料时用方括号注明编号，如 [1]。资料中没有相关内容时，请说明资料中没有提到。\n")
+	for _, source := range sources {
+		fmt.Fprintf(&sb, "\n[%d] 来源：%s\n%s\n", source.Index, source.Source, source.Content)
+	}
+	return sb.String(), sources, nil
+}
+
+func CreateKnowledgeBase(knowledge *KnowledgeStorage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req model.KnowledgeBaseRequest
+		if err := c.BindJSON(&req); err != nil {
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"status":  "Error",
+				"message": "Knowledge base name is required",
+				"data":    nil,
+			})
+			return
+		}
+
+		kb, err := knowledge.CreateKnowledgeBase(req.Name, req.Description)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"status":  "Error",
+				"message": err.Error(),
+				"data":    nil,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "Success",
+			"message": "",
+			"data":    kb,
+		})
+	}
+}
+
+func ListKnowledgeBases(knowledge *KnowledgeStorage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		knowledgeBases, err := knowledge.ListKnowledgeBases()
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "Success",
+			"message": "",
+			"data":    knowledgeBases,
+		})
+	}
+}
+
+// UploadKnowledge 上传一个或多个文档到知识库，表单字段为 file。
+// 文档切分为片段并计算向量后保存，重复上传同名文档会替换之前的内容。
+func UploadKnowledge(knowledge *KnowledgeStorage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "Error", "message": "Invalid knowledge base id", "data": nil})
+			return
+		}
+		kb, err := knowledge.GetKnowledgeBaseById(id)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrKnowledgeBaseNotFound) {
+				status = http.StatusNotFound
+			}
+			c.AbortWithStatusJSON(status, gin.H{"status": "Error", "message": err.Error(), "data": nil})
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxKnowledgeUploadSize)
+		form, err := c.MultipartForm()
+		if err != nil || len(form.File["file"]) == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "Error", "message": "No file uploaded", "data": nil})
+			return
+		}
+
+		// 先提取和向量化所有文件，再一起保存，任何一个文件失败时都不会留下部分文档
+		rc := http.NewResponseController(c.Writer)
+		documents := make([]KnowledgeDocument, 0, len(form.File["file"]))
+		for _, header := range form.File["file"] {
+			file, err := header.Open()
+			if err != nil {
+				c.AbortWithError(http.StatusInternalServerError, err)
+				return
+			}
+			data, err := io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				c.AbortWithError(http.StatusInternalServerError, err)
+				return
+			}
+
+			text, err := service.ExtractText(header.Filename, data)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "Error", "message": err.Error(), "data": nil})
+				return
+			}
+			chunks := service.SplitDocument(text)
+			if len(chunks) == 0 {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"status":  "Error",
+					"message": fmt.Sprintf("%s has no text", header.Filename),
+					"data":    nil,
+				})
+				return
+			}
+			// 向量化大文件可能超过写超时，每个文件都延长一次
+			extendWriteDeadline(rc)
+			embeddings, err := service.Embed(c.Request.Context(), chunks)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{
+					"status":  "Error",
+					"message": fmt.Sprintf("%s: %v", header.Filename, err),
+					"data":    nil,
+				})
+				return
+			}
+			documents = append(documents, KnowledgeDocument{Source: header.Filename, Chunks: chunks, Embeddings: embeddings})
+		}
+		if err = knowledge.AddDocuments(kb.Id, documents); err != nil {
+			if errors.Is(err, ErrEmbeddingDimension) {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "Error", "message": err.Error(), "data": nil})
+				return
+			}
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		result := make([]gin.H, len(documents))
+		for i, document := range documents {
+			result[i] = gin.H{"source": document.Source, "chunks": len(document.Chunks)}
+		}
+		extendWriteDeadline(rc)
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "Success",
+			"message": "",
+			"data":    result,
+		})
+	}
+}
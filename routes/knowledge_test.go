@@ -0,0 +1,137 @@
+package routes
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestAddDocumentsIsAtomic(t *testing.T) {
+	chatStorage, err := NewChatStorage(filepath.Join(t.TempDir(), "database.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chatStorage.Close()
+	knowledge, err := NewKnowledgeStorage(chatStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, err := knowledge.CreateKnowledgeBase("docs", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 第二个文档出错时，第一个文档也不应该保存
+	err = knowledge.AddDocuments(kb.Id, []KnowledgeDocument{
+		{Source: "a.md", Chunks: []string{"a"}, Embeddings: [][]float32{{1, 0}}},
+		{Source: "b.md", Chunks: []string{"b"}},
+	})
+	if err == nil {
+		t.Fatal("expected an error for the mismatched document")
+	}
+	countChunks := func() (n int) {
+		if err := chatStorage.db.QueryRow("SELECT COUNT(*) FROM knowledge_chunk").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := countChunks(); n != 0 {
+		t.Fatalf("expected no chunks, got %d", n)
+	}
+
+	err = knowledge.AddDocuments(kb.Id, []KnowledgeDocument{
+		{Source: "a.md", Chunks: []string{"a"}, Embeddings: [][]float32{{1, 0}}},
+		{Source: "b.md", Chunks: []string{"b", "c"}, Embeddings: [][]float32{{0, 1}, {1, 1}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countChunks(); n != 3 {
+		t.Fatalf("expected 3 chunks, got %d", n)
+	}
+	sources, err := knowledge.Search(kb.Id, []float32{1, 0}, 3)
+	if err != nil || len(sources) != 3 {
+		t.Fatalf("unexpected search result %+v, %v", sources, err)
+	}
+	// 片段按相似度排列
+	for i, want := range []struct {
+		source string
+		chunk  int
+	}{{"a.md", 0}, {"b.md", 1}, {"b.md", 0}} {
+		if sources[i].Source != want.source || sources[i].Chunk != want.chunk || sources[i].Index != i+1 {
+			t.Errorf("unexpected source %d: %+v", i, sources[i])
+		}
+	}
+}
+
+func TestGetKnowledgeBase(t *testing.T) {
+	chatStorage, err := NewChatStorage(filepath.Join(t.TempDir(), "database.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chatStorage.Close()
+	knowledge, err := NewKnowledgeStorage(chatStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, err := knowledge.CreateKnowledgeBase("docs", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 名称为数字的知识库不会遮住 id 相同的知识库
+	named, err := knowledge.CreateKnowledgeBase(strconv.FormatInt(docs.Id, 10), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kb, err := knowledge.GetKnowledgeBase(named.Name); err != nil || kb.Id != named.Id {
+		t.Errorf("expected the knowledge base named %q, got %+v, %v", named.Name, kb, err)
+	}
+	if kb, err := knowledge.GetKnowledgeBaseById(docs.Id); err != nil || kb.Name != "docs" {
+		t.Errorf("expected the knowledge base %d, got %+v, %v", docs.Id, kb, err)
+	}
+	if _, err := knowledge.GetKnowledgeBase("missing"); !errors.Is(err, ErrKnowledgeBaseNotFound) {
+		t.Errorf("expected ErrKnowledgeBaseNotFound, got %v", err)
+	}
+}
+
+func TestEmbeddingDimension(t *testing.T) {
+	chatStorage, err := NewChatStorage(filepath.Join(t.TempDir(), "database.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chatStorage.Close()
+	knowledge, err := NewKnowledgeStorage(chatStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, err := knowledge.CreateKnowledgeBase("docs", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = knowledge.AddDocuments(kb.Id, []KnowledgeDocument{
+		{Source: "a.md", Chunks: []string{"a"}, Embeddings: [][]float32{{1, 0}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kb, err = knowledge.GetKnowledgeBase("docs"); err != nil || kb.EmbeddingDim != 2 {
+		t.Fatalf("expected 2 dimensions, got %+v, %v", kb, err)
+	}
+
+	// 更换向量模型后，上传和查询都返回 ErrEmbeddingDimension
+	err = knowledge.AddDocuments(kb.Id, []KnowledgeDocument{
+		{Source: "b.md", Chunks: []string{"b"}, Embeddings: [][]float32{{1, 0, 0}}},
+	})
+	if !errors.Is(err, ErrEmbeddingDimension) {
+		t.Errorf("expected ErrEmbeddingDimension on upload, got %v", err)
+	}
+	if _, err = knowledge.Search(kb.Id, []float32{1, 0, 0}, 3); !errors.Is(err, ErrEmbeddingDimension) {
+		t.Errorf("expected ErrEmbeddingDimension on search, got %v", err)
+	}
+	if sources, err := knowledge.Search(kb.Id, []float32{1, 0}, 3); err != nil || len(sources) != 1 {
+		t.Errorf("unexpected search result %+v, %v", sources, err)
+	}
+}
@@ -9,7 +9,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
+	"slices"
+	"time"
 
 	"chatgpt-go/pkg/lemur"
 
@@ -71,7 +72,52 @@ func GetConfig(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-func ChatProcess(chatStorage *ChatStorage) gin.HandlerFunc {
+// streamWriteTimeout 是流式响应单次写入的超时，代替 http.Server 的全局 WriteTimeout
+const streamWriteTimeout = 20 * time.Second
+
+// extendWriteDeadline 在每次写入流式数据前延长写超时，使长回答不会被全局写超时截断
+func extendWriteDeadline(rc *http.ResponseController) {
+	if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+		fmt.Printf("SetWriteDeadline error: %v\n", err)
+	}
+}
+
+// knowledgeContext 在请求指定了知识库时检索相关片段。
+// 出错时已经向客户端返回了错误，调用方直接结束请求即可。
+func knowledgeContext(c *gin.Context, knowledge *KnowledgeStorage, req model.ChatRequest) (string, []model.KnowledgeSource, error) {
+	if req.Options.KnowledgeBase == "" {
+		return "", nil, nil
+	}
+	prompt, sources, err := retrieveKnowledge(c.Request.Context(), knowledge, req.Options.KnowledgeBase, req.Prompt)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, ErrKnowledgeBaseNotFound) || errors.Is(err, ErrEmbeddingDimension) {
+			status = http.StatusBadRequest
+		}
+		c.AbortWithStatusJSON(status, gin.H{
+			"status":  "Error",
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return "", nil, err
+	}
+	return prompt, sources, nil
+}
+
+// writeFrame 写入流式响应的一帧，以换行结尾
+func writeFrame(w io.Writer, flusher http.Flusher, frame any) error {
+	jsonResp, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(append(jsonResp, '\n')); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
+
+func ChatProcess(chatStorage *ChatStorage, knowledge *KnowledgeStorage) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 设置响应头的 Content-Type 为 application/octet-stream
 		c.Header("Content-Type", "application/octet-stream")
@@ -95,36 +141,19 @@ func ChatProcess(chatStorage *ChatStorage) gin.HandlerFunc {
 			panic(errors.New("Missing OPENAI_API_KEY environment variable"))
 		}
 
-		config := lemur.DefaultConfig(global.Config.System.OpenAIKey)
-		socksHost := global.Config.System.SocksHost
-		socksPort := global.Config.System.SocksPort
-		httpsProxy := global.Config.System.HttpsProxy
-
-		if socksHost != "" && socksPort != "" {
-			proxyUrl, err := url.Parse("socks5://" + socksHost + ":" + socksPort)
-			if err != nil {
-				panic(err)
-			}
-			transport := &http.Transport{
-				Proxy: http.ProxyURL(proxyUrl),
-			}
-			config.HTTPClient = &http.Client{
-				Transport: transport,
-			}
-		} else if httpsProxy != "" {
-			proxyUrl, err := url.Parse("https://" + httpsProxy)
-			if err != nil {
-				panic(err)
-			}
-			transport := &http.Transport{
-				Proxy: http.ProxyURL(proxyUrl),
-			}
-			config.HTTPClient = &http.Client{
-				Transport: transport,
-			}
+		if description, ok := parseImageCommand(req.Prompt); ok {
+			imageChat(c, flusher, chatStorage, req, description, func(id, parentMessageId, text string) any {
+				return model.ChatResponse{Role: lemur.ChatMessageRoleAssistant, Id: id, ParentMessageId: parentMessageId, Text: text, Delta: text}
+			})
+			return
 		}
 
-		client := lemur.NewClientWithConfig(config)
+		client := service.Client()
+
+		knowledgePrompt, sources, err := knowledgeContext(c, knowledge, req)
+		if err != nil {
+			return
+		}
 
 		if req.Options.ParentMessageId == "" {
 			req.Options.ParentMessageId = uuid.NewString()
@@ -135,53 +164,86 @@ func ChatProcess(chatStorage *ChatStorage) gin.HandlerFunc {
 			Content: req.Prompt,
 		})
 		messages, err := chatStorage.GetMessages(newMessageId)
+		if knowledgePrompt != "" && len(messages) > 0 {
+			messages = slices.Insert(messages, len(messages)-1, lemur.ChatCompletionMessage{
+				Role:    lemur.ChatMessageRoleSystem,
+				Content: knowledgePrompt,
+			})
+		}
 		reqData := lemur.ChatCompletionRequest{
 			Model:    lemur.GPT3Dot5Turbo,
 			Messages: messages,
 			Stream:   true,
 		}
 
+		// 语义缓存按模型和问题之前的消息区分
+		var cacheContext []string
+		for _, message := range messages[:max(len(messages)-1, 0)] {
+			cacheContext = append(cacheContext, message.Role, message.Content)
+		}
+		cacheAnswer, cacheQuery, cacheHit := lookupCache(c, req, reqData.Model, cacheContext...)
+		if cacheHit {
+			cachedMessageId := uuid.NewString()
+			err = replayAnswer(c, flusher, cacheAnswer, func(text, delta string) any {
+				resp := model.ChatResponse{
+					Role:            lemur.ChatMessageRoleAssistant,
+					Id:              cachedMessageId,
+					ParentMessageId: newMessageId,
+					Text:            text,
+					Delta:           delta,
+					Cached:          true,
+				}
+				// 最后一帧带上引用的知识库片段
+				if text == cacheAnswer {
+					resp.Sources = sources
+				}
+				return resp
+			})
+			if err != nil {
+				fmt.Printf("Writing cached response error: %v\n", err)
+				return
+			}
+			chatStorage.AddMessage(cachedMessageId, newMessageId, lemur.ChatCompletionMessage{
+				Role:    lemur.ChatMessageRoleAssistant,
+				Content: cacheAnswer,
+			})
+			return
+		}
+
 		// fmt.Printf("Request data: %v\n", reqData)
-		stream, err := client.CreateChatCompletionStream(c, reqData)
+		stream, err := client.CreateChatCompletionStream(c.Request.Context(), reqData)
 		if err != nil {
 			fmt.Printf("CompletionStream error: %v\n", err)
 			return
 		}
-		defer stream.Close()
 
-		text := ""
+		rc := http.NewResponseController(c.Writer)
+		var acc lemur.ChatCompletionStreamAccumulator
 		messageId := ""
-		for {
-			response, err := stream.Recv()
-
-			if errors.Is(err, io.EOF) {
-				if messageId != "" {
-					chatStorage.AddMessage(messageId, newMessageId, lemur.ChatCompletionMessage{
-						Role:    lemur.ChatMessageRoleAssistant,
-						Content: text,
-					})
-				}
-				fmt.Println("Stream finished")
-				return
-			}
-
+		var last model.ChatResponse
+		for response, err := range stream.All() {
 			if err != nil {
 				fmt.Printf("Stream error: %v\n", err)
 				return
 			}
+			extendWriteDeadline(rc)
 
 			// fmt.Printf("		Stream response: %v\n", response)
 
 			messageId = response.ID
-			text = text + response.Choices[0].Delta.Content
+			acc.Add(response)
+			if len(response.Choices) == 0 {
+				continue
+			}
 			resp := model.ChatResponse{
 				Role:            lemur.ChatMessageRoleAssistant,
 				Id:              response.ID,
 				ParentMessageId: newMessageId,
-				Text:            text,
+				Text:            acc.Content(0),
 				Delta:           response.Choices[0].Delta.Content,
 				Detail:          response,
 			}
+			last = resp
 			jsonResp, err := json.Marshal(resp)
 			if err != nil {
 				fmt.Printf("JSON marshaling error: %v\n", err)
@@ -204,10 +266,29 @@ func ChatProcess(chatStorage *ChatStorage) gin.HandlerFunc {
 				return
 			}
 		}
+
+		// 最后一帧带上引用的知识库片段
+		if len(sources) > 0 && last.Id != "" {
+			last.Delta = ""
+			last.Sources = sources
+			if err = writeFrame(c.Writer, flusher, last); err != nil {
+				fmt.Printf("Writing sources error: %v\n", err)
+				return
+			}
+		}
+
+		if messageId != "" {
+			chatStorage.AddMessage(messageId, newMessageId, lemur.ChatCompletionMessage{
+				Role:    lemur.ChatMessageRoleAssistant,
+				Content: acc.Content(0),
+			})
+		}
+		service.Cache().Store(cacheQuery, acc.Content(0))
+		fmt.Println("Stream finished")
 	}
 }
 
-func ChatProcessV2(chatStorage *ChatStorage) gin.HandlerFunc {
+func ChatProcessV2(chatStorage *ChatStorage, knowledge *KnowledgeStorage) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 设置响应头的 Content-Type 为 application/octet-stream
 		c.Header("Content-Type", "application/octet-stream")
@@ -231,48 +312,20 @@ func ChatProcessV2(chatStorage *ChatStorage) gin.HandlerFunc {
 			panic(errors.New("Missing OPENAI_API_KEY environment variable"))
 		}
 
-		config := lemur.DefaultConfig(global.Config.System.OpenAIKey)
-		socksHost := global.Config.System.SocksHost
-		socksPort := global.Config.System.SocksPort
-		httpsProxy := global.Config.System.HttpsProxy
-		httpProxy := global.Config.System.HttpProxy
+		// /image 命令生成图片，不经过对话模型
+		if description, ok := parseImageCommand(req.Prompt); ok {
+			imageChat(c, flusher, chatStorage, req, description, func(id, parentMessageId, text string) any {
+				return model.ChatResponseLemur{Role: lemur.ChatMessageRoleAssistant, Id: id, ParentMessageId: parentMessageId, Text: text, Delta: text}
+			})
+			return
+		}
 
-		if socksHost != "" && socksPort != "" {
-			proxyUrl, err := url.Parse("socks5://" + socksHost + ":" + socksPort)
-			if err != nil {
-				panic(err)
-			}
-			transport := &http.Transport{
-				Proxy: http.ProxyURL(proxyUrl),
-			}
-			config.HTTPClient = &http.Client{
-				Transport: transport,
-			}
-		} else if httpsProxy != "" {
-			proxyUrl, err := url.Parse("https://" + httpsProxy)
-			if err != nil {
-				panic(err)
-			}
-			transport := &http.Transport{
-				Proxy: http.ProxyURL(proxyUrl),
-			}
-			config.HTTPClient = &http.Client{
-				Transport: transport,
-			}
-		} else if httpProxy != "" {
-			proxyUrl, err := url.Parse("http://" + httpProxy)
-			if err != nil {
-				panic(err)
-			}
-			transport := &http.Transport{
-				Proxy: http.ProxyURL(proxyUrl),
-			}
-			config.HTTPClient = &http.Client{
-				Transport: transport,
-			}
+		client := service.Client()
+
+		knowledgePrompt, sources, err := knowledgeContext(c, knowledge, req)
+		if err != nil {
+			return
 		}
-		config.BaseURL = "http://lemurchat.anfans.cn/api"
-		client := lemur.NewClientWithConfig(config)
 
 		/*
 		   1、从客户端解析请求，存入数据库
@@ -306,7 +359,51 @@ func ChatProcessV2(chatStorage *ChatStorage) gin.HandlerFunc {
 		for idx := range msgCtx {
 			messages = append(messages, lemur.ChatCompletionMessageLemur{Content: msgCtx[msgCtxLen-1-idx].Content, IsSensitive: false, NeedCheck: true, Role: msgCtx[msgCtxLen-1-idx].Role})
 		}
+		// 知识库片段放在用户的问题之前
+		if knowledgePrompt != "" {
+			messages = slices.Insert(messages, len(messages)-1, lemur.ChatCompletionMessageLemur{
+				Content: knowledgePrompt, IsSensitive: false, NeedCheck: false, Role: "system",
+			})
+		}
 		// messages = append(messages, lemur.ChatCompletionMessageLemur{Content: req.Prompt, IsSensitive: false, NeedCheck: true, Role: "user"})
+
+		// 语义缓存按问题之前的消息区分
+		var cacheContext []string
+		for _, message := range messages[:len(messages)-1] {
+			cacheContext = append(cacheContext, message.Role, message.Content)
+		}
+		cacheAnswer, cacheQuery, cacheHit := lookupCache(c, req, lemurCacheScope, cacheContext...)
+		if cacheHit {
+			cachedMessageId := uuid.NewString()
+			err = replayAnswer(c, flusher, cacheAnswer, func(text, delta string) any {
+				resp := model.ChatResponseLemur{
+					Role:            lemur.ChatMessageRoleAssistant,
+					Id:              cachedMessageId,
+					ParentMessageId: newMessageIdUser,
+					Text:            text,
+					Delta:           delta,
+					Cached:          true,
+				}
+				// 最后一帧带上引用的知识库片段
+				if text == cacheAnswer {
+					resp.Sources = sources
+				}
+				return resp
+			})
+			if err != nil {
+				fmt.Printf("Error when Writing cached response: %v\n", err)
+				return
+			}
+			err = chatStorage.AddMessage(cachedMessageId, newMessageIdUser, lemur.ChatCompletionMessage{
+				Role:    lemur.ChatMessageRoleAssistant,
+				Content: cacheAnswer,
+			})
+			if err != nil {
+				fmt.Println("Error when chatStorage.AddMessage", err)
+			}
+			return
+		}
+
 		msg, err := json.Marshal(messages)
 		if err != nil {
 			fmt.Printf("json.Marshal(messages) error: %v\n", err)
@@ -317,46 +414,35 @@ func ChatProcessV2(chatStorage *ChatStorage) gin.HandlerFunc {
 		}
 
 		// fmt.Printf("Request data: %v\n", reqBody)
-		stream, err := client.CreateChatCompletionStreamLemur(c, reqBody)
+		stream, err := client.CreateChatCompletionStreamLemur(c.Request.Context(), reqBody)
 		// stream, err := client.CreateChatCompletionStream(c, reqBody)
 		if err != nil {
 			fmt.Printf("CompletionStream error: %v\n", err)
 			return
 		}
-		defer stream.Close()
 
-		var text string                         // 全局变量
+		rc := http.NewResponseController(c.Writer)
+		var acc lemur.ChatCompletionStreamAccumulator
 		var currentMessageId = uuid.NewString() // 全局变量
-		for {
-			response, err := stream.Recv()
-
-			if errors.Is(err, io.EOF) {
-				if currentMessageId != "" {
-					err := chatStorage.AddMessage(currentMessageId, newMessageIdUser, lemur.ChatCompletionMessage{
-						Role:    lemur.ChatMessageRoleAssistant,
-						Content: text,
-					})
-					fmt.Println("Error when chatStorage.AddMessage=", err)
-				}
-				// fmt.Println("Stream finished")
-				// fmt.Println("text=", text)
-				return
-			}
-
+		var last model.ChatResponseLemur
+		for response, err := range stream.All() {
 			if err != nil {
 				fmt.Printf("Error when stream.Recv() : %v\n", err)
 				return
 			}
+			extendWriteDeadline(rc)
 
 			// fmt.Printf("		Stream response: %v\n", response)
-			json.Marshal(response)
+			acc.AddLemur(response)
+			if len(response.Choices) == 0 {
+				continue
+			}
 
-			text = text + response.Choices[0].Delta.Content
 			resp := model.ChatResponseLemur{
 				Role:            lemur.ChatMessageRoleAssistant,
 				Id:              currentMessageId, //response.ID,
 				ParentMessageId: newMessageIdUser,
-				Text:            text,
+				Text:            acc.Content(0),
 				Delta:           response.Choices[0].Delta.Content,
 				Detail: lemur.ChatCompletionStreamResponseLemur{
 					ID:      response.ID,
@@ -366,6 +452,7 @@ func ChatProcessV2(chatStorage *ChatStorage) gin.HandlerFunc {
 					// Choices: response.Choices,
 				},
 			}
+			last = resp
 			jsonResp, err := json.Marshal(resp)
 			if err != nil {
 				fmt.Printf("Error when JSON marshaling: %v\n", err)
@@ -389,5 +476,23 @@ func ChatProcessV2(chatStorage *ChatStorage) gin.HandlerFunc {
 			}
 		}
 
+		// 最后一帧带上引用的知识库片段
+		if len(sources) > 0 && last.Id != "" {
+			last.Delta = ""
+			last.Sources = sources
+			if err = writeFrame(c.Writer, flusher, last); err != nil {
+				fmt.Printf("Error when Writing sources: %v\n", err)
+				return
+			}
+		}
+
+		err = chatStorage.AddMessage(currentMessageId, newMessageIdUser, lemur.ChatCompletionMessage{
+			Role:    lemur.ChatMessageRoleAssistant,
+			Content: acc.Content(0),
+		})
+		if err != nil {
+			fmt.Println("Error when chatStorage.AddMessage", err)
+		}
+		service.Cache().Store(cacheQuery, acc.Content(0))
 	}
 }
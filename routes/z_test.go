@@ -2,15 +2,17 @@ package routes
 
 import (
 	"fmt"
+	"path/filepath"
 	"runtime"
 	"testing"
 )
 
 func TestXxx(t *testing.T) {
-	chatStorage, err := NewChatStorage(`D:\GOPATH\src\chatgpt-go\database.sqlite`)
+	chatStorage, err := NewChatStorage(filepath.Join(t.TempDir(), "database.sqlite"))
 	if err != nil {
 		panic(err)
 	}
+	defer chatStorage.Close()
 	chatStorage.GetContextMessages("52ffa8ad-3a30-41f1-8a85-fa8aaf8ccc3d")
 }
 func TestArch(t *testing.T) {
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"chatgpt-go/global"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"chatgpt-go/pkg/lemur/vector"
+)
+
+// 未配置时语义缓存的默认参数
+const (
+	defaultSemanticCacheThreshold  = 0.95
+	defaultSemanticCacheTTL        = 24 * time.Hour
+	defaultSemanticCacheMaxEntries = 10000
+)
+
+// SemanticCache 缓存上游的回答。问题的向量与之前某个问题足够相似，且模型和上下文相同时，直接返回之前的回答。
+type SemanticCache struct {
+	// embed 计算问题的向量，默认为 Embed
+	embed func(ctx context.Context, texts []string) ([][]float32, error)
+	now   func() time.Time
+
+	mu      sync.Mutex
+	index   *vector.Flat
+	entries map[string]cacheEntry
+	// order 按写入顺序记录缓存的 id，缓存满时淘汰最早的
+	order  []string
+	nextId int64
+
+	hits     atomic.Int64
+	misses   atomic.Int64
+	stores   atomic.Int64
+	bypasses atomic.Int64
+}
+
+type cacheEntry struct {
+	answer  string
+	expires time.Time
+}
+
+// CacheQuery 是一次缓存查询，未命中时用来保存上游的回答
+type CacheQuery struct {
+	Model     string
+	Context   string
+	embedding []float32
+}
+
+// CacheStats 是缓存的统计信息
+type CacheStats struct {
+	Enabled  bool    `json:"enabled"`
+	Entries  int     `json:"entries"`
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	Stores   int64   `json:"stores"`
+	Bypasses int64   `json:"bypasses"`
+	HitRate  float64 `json:"hitRate"`
+}
+
+var semanticCache = NewSemanticCache()
+
+// Cache 返回全局的语义缓存，是否启用由配置决定
+func Cache() *SemanticCache {
+	return semanticCache
+}
+
+func NewSemanticCache() *SemanticCache {
+	return &SemanticCache{
+		embed:   Embed,
+		now:     time.Now,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// Enabled 返回配置中是否启用了语义缓存
+func (c *SemanticCache) Enabled() bool {
+	return global.Config.System.SemanticCache
+}
+
+// ContextHash 计算问题之前的上下文（历史消息、系统提示等）的哈希，上下文不同的问题不共用缓存
+func ContextHash(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		// 写入长度，避免不同的切分得到相同的哈希
+		h.Write([]byte(strconv.Itoa(len(part))))
+		h.Write([]byte{0})
+		h.Write([]byte(part))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Lookup 查找模型 model 在上下文 contextHash 下与 question 相似的问题的回答。
+// 未命中时返回的 query 可以传给 Store 保存回答；计算向量失败时返回错误，此时不使用缓存。
+func (c *SemanticCache) Lookup(ctx context.Context, model, contextHash, question string) (answer string, query *CacheQuery, ok bool, err error) {
+	embeddings, err := c.embed(ctx, []string{question})
+	if err != nil {
+		return "", nil, false, err
+	}
+	query = &CacheQuery{Model: model, Context: contextHash, embedding: embeddings[0]}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.index != nil && c.index.Dim() == len(query.embedding) {
+		now := c.now()
+		filter := vector.All(vector.Match("model", model), vector.Match("context", contextHash), func(metadata vector.Metadata) bool {
+			return now.Before(c.entries[metadata["id"]].expires)
+		})
+		results, err := c.index.Search(query.embedding, 1, filter)
+		if err != nil {
+			return "", nil, false, err
+		}
+		if len(results) > 0 && results[0].Score >= c.threshold() {
+			c.hits.Add(1)
+			return c.entries[results[0].ID].answer, query, true, nil
+		}
+	}
+	c.misses.Add(1)
+	return "", query, false, nil
+}
+
+// Store 保存未命中的查询得到的回答
+func (c *SemanticCache) Store(query *CacheQuery, answer string) {
+	if query == nil || answer == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// 更换向量模型后维度不同，之前的缓存都不能再用
+	if c.index == nil || c.index.Dim() != len(query.embedding) {
+		c.index = vector.NewFlat(len(query.embedding))
+		c.entries = make(map[string]cacheEntry)
+		c.order = nil
+	}
+
+	c.nextId++
+	id := strconv.FormatInt(c.nextId, 10)
+	metadata := vector.Metadata{"model": query.Model, "context": query.Context, "id": id}
+	if err := c.index.Add(id, query.embedding, metadata); err != nil {
+		return
+	}
+	c.entries[id] = cacheEntry{answer: answer, expires: c.now().Add(c.ttl())}
+	c.order = append(c.order, id)
+	c.stores.Add(1)
+	c.evict()
+}
+
+// evict 删除过期的缓存，缓存仍然超过上限时淘汰最早写入的。
+// 每次 Store 都会调用，过期的缓存不会一直占用内存。
+func (c *SemanticCache) evict() {
+	maxEntries := global.Config.System.SemanticCacheMaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultSemanticCacheMaxEntries
+	}
+
+	now := c.now()
+	order := c.order[:0]
+	for _, id := range c.order {
+		if !now.Before(c.entries[id].expires) {
+			c.remove(id)
+			continue
+		}
+		order = append(order, id)
+	}
+	for len(order) > maxEntries {
+		c.remove(order[0])
+		order = order[1:]
+	}
+	c.order = append([]string(nil), order...)
+}
+
+func (c *SemanticCache) remove(id string) {
+	c.index.Remove(id)
+	delete(c.entries, id)
+}
+
+// Bypass 记录一次跳过缓存的请求
+func (c *SemanticCache) Bypass() {
+	c.bypasses.Add(1)
+}
+
+func (c *SemanticCache) Stats() CacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	stats := CacheStats{
+		Enabled:  c.Enabled(),
+		Entries:  entries,
+		Hits:     c.hits.Load(),
+		Misses:   c.misses.Load(),
+		Stores:   c.stores.Load(),
+		Bypasses: c.bypasses.Load(),
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
+
+func (c *SemanticCache) threshold() float32 {
+	if t := global.Config.System.SemanticCacheThreshold; t > 0 {
+		return float32(t)
+	}
+	return defaultSemanticCacheThreshold
+}
+
+func (c *SemanticCache) ttl() time.Duration {
+	return durationOrDefault(global.Config.System.SemanticCacheTTL, defaultSemanticCacheTTL)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"chatgpt-go/global"
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestCache 返回一个用固定向量代替上游的缓存，时间由 now 控制
+func newTestCache(embeddings map[string][]float32, now *time.Time) *SemanticCache {
+	cache := NewSemanticCache()
+	cache.embed = func(_ context.Context, texts []string) ([][]float32, error) {
+		return [][]float32{embeddings[texts[0]]}, nil
+	}
+	cache.now = func() time.Time { return *now }
+	return cache
+}
+
+func TestSemanticCache(t *testing.T) {
+	defer func(config global.SystemConfig) { global.Config = config }(global.Config)
+	global.Config.System.SemanticCacheThreshold = 0.9
+	global.Config.System.SemanticCacheTTL = time.Hour
+
+	now := time.Now()
+	cache := newTestCache(map[string][]float32{
+		"如何申请权限？": {1, 0, 0},
+		"怎样申请权限":  {0.98, 0.1, 0},
+		"如何报销？":   {0, 1, 0},
+	}, &now)
+	ctx := context.Background()
+
+	_, query, ok, err := cache.Lookup(ctx, "gpt", "ctx", "如何申请权限？")
+	if err != nil || ok {
+		t.Fatalf("expected a miss, got %v %v", ok, err)
+	}
+	cache.Store(query, "找管理员。")
+
+	answer, _, ok, _ := cache.Lookup(ctx, "gpt", "ctx", "怎样申请权限")
+	if !ok || answer != "找管理员。" {
+		t.Errorf("expected a hit for a similar question, got %v %q", ok, answer)
+	}
+	if _, _, ok, _ = cache.Lookup(ctx, "gpt", "ctx", "如何报销？"); ok {
+		t.Error("expected a miss for a different question")
+	}
+	if _, _, ok, _ = cache.Lookup(ctx, "other", "ctx", "如何申请权限？"); ok {
+		t.Error("expected a miss for another model")
+	}
+	if _, _, ok, _ = cache.Lookup(ctx, "gpt", "other", "如何申请权限？"); ok {
+		t.Error("expected a miss for another context")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, _, ok, _ = cache.Lookup(ctx, "gpt", "ctx", "如何申请权限？"); ok {
+		t.Error("expected a miss after the ttl")
+	}
+
+	cache.Bypass()
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.Misses != 5 || stats.Stores != 1 || stats.Bypasses != 1 || stats.Entries != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestSemanticCacheMaxEntries(t *testing.T) {
+	defer func(config global.SystemConfig) { global.Config = config }(global.Config)
+	global.Config.System.SemanticCacheMaxEntries = 2
+
+	now := time.Now()
+	questions := map[string][]float32{"a": {1, 0, 0}, "b": {0, 1, 0}, "c": {0, 0, 1}}
+	cache := newTestCache(questions, &now)
+	for _, question := range []string{"a", "b", "c"} {
+		_, query, _, _ := cache.Lookup(context.Background(), "gpt", "", question)
+		cache.Store(query, question)
+	}
+
+	if _, _, ok, _ := cache.Lookup(context.Background(), "gpt", "", "a"); ok {
+		t.Error("expected the oldest answer to be evicted")
+	}
+	if answer, _, ok, _ := cache.Lookup(context.Background(), "gpt", "", "c"); !ok || answer != "c" {
+		t.Errorf("expected the newest answer, got %v %q", ok, answer)
+	}
+	if entries := cache.Stats().Entries; entries != 2 {
+		t.Errorf("expected 2 entries, got %d", entries)
+	}
+}
+
+func TestSemanticCacheDropsExpired(t *testing.T) {
+	defer func(config global.SystemConfig) { global.Config = config }(global.Config)
+	global.Config.System.SemanticCacheTTL = time.Hour
+
+	now := time.Now()
+	cache := newTestCache(map[string][]float32{"a": {1, 0, 0}, "b": {0, 1, 0}}, &now)
+	_, query, _, _ := cache.Lookup(context.Background(), "gpt", "", "a")
+	cache.Store(query, "a")
+
+	// 缓存没有满时，过期的缓存也在下一次 Store 时删除
+	now = now.Add(2 * time.Hour)
+	_, query, _, _ = cache.Lookup(context.Background(), "gpt", "", "b")
+	cache.Store(query, "b")
+	if entries := cache.Stats().Entries; entries != 1 {
+		t.Errorf("expected 1 entry, got %d", entries)
+	}
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"chatgpt-go/global"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"chatgpt-go/pkg/lemur"
+)
+
+// 单张图片的大小上限，上传和下载的图片都不能超过
+const MaxImageBytes = 20 << 20
+
+// 下载上游返回的图片地址的超时
+const imageDownloadTimeout = 2 * time.Minute
+
+var (
+	ErrUnsupportedImage = errors.New("unsupported image format, expected png, jpeg, gif or webp")
+	ErrImageNotPNG      = errors.New("image edits need a png image and mask")
+)
+
+// 支持的图片类型及保存时的扩展名
+var imageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// ImageDir 返回保存图片的目录，未配置时为工作目录下的 images
+func ImageDir() string {
+	if dir := global.Config.System.ImageDir; dir != "" {
+		return dir
+	}
+	cwd, _ := os.Getwd()
+	return filepath.Join(cwd, "images")
+}
+
+// SaveImage 把图片保存到 ImageDir 中并返回文件名。文件名是内容的哈希，相同的图片只保存一份。
+func SaveImage(data []byte) (string, error) {
+	if len(data) > MaxImageBytes {
+		return "", fmt.Errorf("image is larger than %d bytes", MaxImageBytes)
+	}
+	ext, ok := imageExtensions[http.DetectContentType(data)]
+	if !ok {
+		return "", ErrUnsupportedImage
+	}
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:]) + ext
+
+	dir := ImageDir()
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return name, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	// 先写临时文件再改名，避免读到写了一半的图片
+	tmp, err := os.CreateTemp(dir, ".image-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+	if err = os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", err
+	}
+	return name, os.Rename(tmp.Name(), path)
+}
+
+// GenerateImages 根据描述生成图片，保存后返回文件名。未指定尺寸时使用配置的 ImageSize。
+func GenerateImages(ctx context.Context, request lemur.ImageRequest) ([]string, error) {
+	if request.Size == "" {
+		request.Size = global.Config.System.ImageSize
+	}
+	response, err := Client().CreateImage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return saveImageResponse(ctx, response)
+}
+
+// EditImages 按描述修改图片，mask 的透明区域是要修改的部分，可以为 nil。接口只接受 png 的图片和遮罩。
+func EditImages(ctx context.Context, prompt string, image, mask []byte, n int, size string) ([]string, error) {
+	if http.DetectContentType(image) != "image/png" || (mask != nil && http.DetectContentType(mask) != "image/png") {
+		return nil, ErrImageNotPNG
+	}
+	request := lemur.ImageEditRequest{Prompt: prompt, N: n, Size: size}
+	if request.Size == "" {
+		request.Size = global.Config.System.ImageSize
+	}
+
+	imageFile, err := tempImage(image)
+	if err != nil {
+		return nil, err
+	}
+	defer removeTempImage(imageFile)
+	request.Image = imageFile
+	if mask != nil {
+		maskFile, err := tempImage(mask)
+		if err != nil {
+			return nil, err
+		}
+		defer removeTempImage(maskFile)
+		request.Mask = maskFile
+	}
+
+	response, err := Client().CreateEditImage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return saveImageResponse(ctx, response)
+}
+
+// ImageVariations 生成图片的变体
+func ImageVariations(ctx context.Context, image []byte, n int, size string) ([]string, error) {
+	request := lemur.ImageVariRequest{N: n, Size: size}
+	if request.Size == "" {
+		request.Size = global.Config.System.ImageSize
+	}
+
+	imageFile, err := tempImage(image)
+	if err != nil {
+		return nil, err
+	}
+	defer removeTempImage(imageFile)
+	request.Image = imageFile
+
+	response, err := Client().CreateVariImage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return saveImageResponse(ctx, response)
+}
+
+// tempImage 把上传的图片写入临时文件，lemur 的接口只接受文件，并按文件的扩展名判断图片类型。
+// 返回的文件已经回到开头。
+func tempImage(data []byte) (*os.File, error) {
+	ext, ok := imageExtensions[http.DetectContentType(data)]
+	if !ok {
+		return nil, ErrUnsupportedImage
+	}
+	file, err := os.CreateTemp("", "image-*"+ext)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = file.Write(data); err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		removeTempImage(file)
+		return nil, err
+	}
+	return file, nil
+}
+
+func removeTempImage(file *os.File) {
+	file.Close()
+	os.Remove(file.Name())
+}
+
+// saveImageResponse 保存上游返回的图片，图片可以是 b64_json 也可以是需要下载的地址
+func saveImageResponse(ctx context.Context, response lemur.ImageResponse) ([]string, error) {
+	names := make([]string, 0, len(response.Data))
+	for _, image := range response.Data {
+		var data []byte
+		var err error
+		switch {
+		case image.B64JSON != "":
+			data, err = base64.StdEncoding.DecodeString(image.B64JSON)
+		case image.URL != "":
+			data, err = downloadImage(ctx, image.URL)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		name, err := SaveImage(data)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no image in the response")
+	}
+	return names, nil
+}
+
+// downloadImage 下载上游返回的图片地址，使用与上游客户端相同的代理
+func downloadImage(ctx context.Context, url string) ([]byte, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy := proxyFromConfig(); proxy != nil {
+		proxyFunc, err := proxy.ProxyFunc()
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy config: %w", err)
+		}
+		transport.Proxy = proxyFunc
+	}
+	client := &http.Client{Transport: transport, Timeout: imageDownloadTimeout}
+	defer client.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download image: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxImageBytes {
+		return nil, fmt.Errorf("image is larger than %d bytes", MaxImageBytes)
+	}
+	return data, nil
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"bytes"
+	"chatgpt-go/global"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"chatgpt-go/pkg/lemur"
+)
+
+func testPNG(t *testing.T, c color.Color) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, c)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSaveImage(t *testing.T) {
+	defer func(config global.SystemConfig) { global.Config = config }(global.Config)
+	global.Config.System.ImageDir = filepath.Join(t.TempDir(), "images")
+
+	data := testPNG(t, color.White)
+	name, err := SaveImage(data)
+	if err != nil || !strings.HasSuffix(name, ".png") {
+		t.Fatalf("expected a png, got %q %v", name, err)
+	}
+	saved, err := os.ReadFile(filepath.Join(ImageDir(), name))
+	if err != nil || !bytes.Equal(saved, data) {
+		t.Errorf("expected the image to be saved, got %v", err)
+	}
+	if again, _ := SaveImage(data); again != name {
+		t.Errorf("expected the same name for the same image, got %q and %q", name, again)
+	}
+	if _, err = SaveImage([]byte("<html></html>")); !errors.Is(err, ErrUnsupportedImage) {
+		t.Errorf("expected ErrUnsupportedImage, got %v", err)
+	}
+}
+
+func TestSaveImageResponse(t *testing.T) {
+	defer func(config global.SystemConfig) { global.Config = config }(global.Config)
+	global.Config.System.ImageDir = t.TempDir()
+
+	white, black := testPNG(t, color.White), testPNG(t, color.Black)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/black.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(black)
+	}))
+	defer server.Close()
+
+	names, err := saveImageResponse(context.Background(), lemur.ImageResponse{Data: []lemur.ImageResponseDataInner{
+		{B64JSON: base64.StdEncoding.EncodeToString(white)},
+		{URL: server.URL + "/black.png"},
+	}})
+	if err != nil || len(names) != 2 {
+		t.Fatalf("expected 2 images, got %v %v", names, err)
+	}
+	for i, want := range [][]byte{white, black} {
+		if saved, _ := os.ReadFile(filepath.Join(ImageDir(), names[i])); !bytes.Equal(saved, want) {
+			t.Errorf("image %d wasn't saved", i)
+		}
+	}
+
+	_, err = saveImageResponse(context.Background(), lemur.ImageResponse{Data: []lemur.ImageResponseDataInner{
+		{URL: server.URL + "/missing.png"},
+	}})
+	if err == nil {
+		t.Error("expected an error for a missing image")
+	}
+}
+
+func TestEditImagesNeedsPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2)), nil); err != nil {
+		t.Fatal(err)
+	}
+	jpg, pngData := buf.Bytes(), testPNG(t, color.White)
+	for _, images := range [][2][]byte{{jpg, nil}, {pngData, jpg}} {
+		if _, err := EditImages(context.Background(), "一只猫", images[0], images[1], 1, ""); !errors.Is(err, ErrImageNotPNG) {
+			t.Errorf("expected ErrImageNotPNG, got %v", err)
+		}
+	}
+
+	// 临时文件的扩展名与图片类型一致
+	file, err := tempImage(jpg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removeTempImage(file)
+	if filepath.Ext(file.Name()) != ".jpg" {
+		t.Errorf("expected a .jpg file, got %s", file.Name())
+	}
+}
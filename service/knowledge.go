@@ -0,0 +1,193 @@
+package service
+
+import (
+	"bytes"
+	"chatgpt-go/global"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"chatgpt-go/pkg/lemur"
+
+	"golang.org/x/net/html"
+)
+
+// 未配置时知识库的默认参数，片段长度按字符计
+const (
+	defaultKnowledgeChunkSize    = 800
+	defaultKnowledgeChunkOverlap = 100
+	defaultKnowledgeTopK         = 4
+	defaultEmbeddingModel        = lemur.SmallEmbedding3
+)
+
+var ErrUnsupportedDocument = errors.New("unsupported document type, only .txt, .md and .html files can be uploaded")
+
+// KnowledgeTopK 返回每次对话从知识库中检索的片段数
+func KnowledgeTopK() int {
+	if k := global.Config.System.KnowledgeTopK; k > 0 {
+		return k
+	}
+	return defaultKnowledgeTopK
+}
+
+// ExtractText 按扩展名提取文档的纯文本，Markdown 按原样保留，HTML 去掉标签、脚本和样式
+func ExtractText(filename string, data []byte) (string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".txt", ".text", ".md", ".markdown":
+		return string(data), nil
+	case ".html", ".htm":
+		return htmlText(data)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedDocument, filename)
+	}
+}
+
+// htmlBlocks 是结束后需要换行的块级元素
+var htmlBlocks = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "pre": true, "blockquote": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"section": true, "article": true, "table": true, "ul": true, "ol": true,
+}
+
+func htmlText(data []byte) (string, error) {
+	var sb strings.Builder
+	tokenizer := html.NewTokenizer(bytes.NewReader(data))
+	// skip 记录当前所在的 script、style 等不输出内容的元素的层数
+	skip := 0
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); !errors.Is(err, io.EOF) {
+				return "", err
+			}
+			return tidyLines(sb.String()), nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			switch tag := string(name); {
+			case tag == "script" || tag == "style" || tag == "noscript" || tag == "head":
+				skip++
+			case tag == "br":
+				sb.WriteString("\n")
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			tag := string(name)
+			switch {
+			case tag == "script" || tag == "style" || tag == "noscript" || tag == "head":
+				if skip > 0 {
+					skip--
+				}
+			case htmlBlocks[tag]:
+				sb.WriteString("\n\n")
+			}
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			text := strings.Join(strings.Fields(string(tokenizer.Text())), " ")
+			if text != "" {
+				sb.WriteString(text)
+				sb.WriteString(" ")
+			}
+		}
+	}
+}
+
+// tidyLines 去掉每行首尾的空白，并把连续的空行合并为一个
+func tidyLines(text string) string {
+	lines := strings.Split(text, "\n")
+	tidy := lines[:0]
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" && (len(tidy) == 0 || tidy[len(tidy)-1] == "") {
+			continue
+		}
+		tidy = append(tidy, line)
+	}
+	return strings.TrimSpace(strings.Join(tidy, "\n"))
+}
+
+// SplitDocument 按配置把文档切分为片段
+func SplitDocument(text string) []string {
+	size := global.Config.System.KnowledgeChunkSize
+	if size <= 0 {
+		size = defaultKnowledgeChunkSize
+	}
+	overlap := global.Config.System.KnowledgeChunkOverlap
+	if overlap <= 0 {
+		overlap = defaultKnowledgeChunkOverlap
+	}
+	return SplitText(text, size, overlap)
+}
+
+// SplitText 把文本切分为最多 size 个字符的片段，相邻片段重叠 overlap 个字符。
+// 片段尽量在段落、换行、句子或单词的结尾处断开，断点不会早于片段的一半。
+func SplitText(text string, size, overlap int) []string {
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+	runes := []rune(strings.TrimSpace(text))
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := min(start+size, len(runes))
+		if end < len(runes) {
+			end = chunkEnd(runes, start, end)
+		}
+		if chunk := strings.TrimSpace(string(runes[start:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if end == len(runes) {
+			break
+		}
+		start = max(end-overlap, start+1)
+	}
+	return chunks
+}
+
+// chunkBreaks 是按优先级排列的断点，每个函数判断能否在 runes[i] 之后断开
+var chunkBreaks = []func(runes []rune, i int) bool{
+	func(runes []rune, i int) bool { return runes[i] == '\n' && i > 0 && runes[i-1] == '\n' },
+	func(runes []rune, i int) bool { return runes[i] == '\n' },
+	func(runes []rune, i int) bool { return strings.ContainsRune(".!?。！？；;", runes[i]) },
+	func(runes []rune, i int) bool { return unicode.IsSpace(runes[i]) },
+}
+
+// chunkEnd 返回从 start 开始、不超过 end 的片段的结尾
+func chunkEnd(runes []rune, start, end int) int {
+	lowest := start + (end-start)/2
+	for _, isBreak := range chunkBreaks {
+		for i := end - 1; i >= lowest; i-- {
+			if isBreak(runes, i) {
+				return i + 1
+			}
+		}
+	}
+	return end
+}
+
+// Embed 计算每段文本的向量，文本过多时分批并发请求
+func Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	model := defaultEmbeddingModel
+	if name := global.Config.System.EmbeddingModel; name != "" {
+		if err := model.UnmarshalText([]byte(name)); err != nil || model == lemur.Unknown {
+			return nil, fmt.Errorf("unknown embedding model %q", name)
+		}
+	}
+
+	response, err := Client().CreateEmbeddingsBatch(ctx, lemur.EmbeddingRequestStrings{
+		Input: texts,
+		Model: model,
+	}, lemur.EmbeddingBatchOptions{})
+	if err != nil {
+		return nil, err
+	}
+	embeddings := make([][]float32, len(response.Data))
+	for i, embedding := range response.Data {
+		embeddings[i] = embedding.Embedding
+	}
+	return embeddings, nil
+}
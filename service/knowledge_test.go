@@ -0,0 +1,45 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitText(t *testing.T) {
+	text := "第一段的内容。\n\n第二段比较长，有两句话。这是第二句。\n\n第三段。"
+	chunks := SplitText(text, 12, 4)
+	if len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %q", chunks)
+	}
+	if chunks[0] != "第一段的内容。" {
+		t.Errorf("expected the first chunk to end at the paragraph, got %q", chunks[0])
+	}
+	for _, chunk := range chunks {
+		if n := len([]rune(chunk)); n > 12 {
+			t.Errorf("chunk %q has %d characters", chunk, n)
+		}
+	}
+	if last := chunks[len(chunks)-1]; !strings.HasSuffix(last, "第三段。") {
+		t.Errorf("expected the last chunk to end the text, got %q", last)
+	}
+
+	if chunks = SplitText(strings.Repeat("a", 25), 10, 3); len(chunks) != 4 || chunks[1] != strings.Repeat("a", 10) {
+		t.Errorf("expected overlapping chunks of 10 characters, got %q", chunks)
+	}
+}
+
+func TestExtractText(t *testing.T) {
+	page := `<html><head><title>标题</title><style>p{}</style></head>
+<body><h1>说明</h1><p>第一段 <b>加粗</b></p><script>alert(1)</script><p>第二段</p></body></html>`
+	text, err := ExtractText("doc.HTML", []byte(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "说明\n\n第一段 加粗\n\n第二段" {
+		t.Errorf("unexpected text %q", text)
+	}
+
+	if _, err = ExtractText("doc.pdf", nil); err == nil {
+		t.Error("expected an error for a pdf")
+	}
+}